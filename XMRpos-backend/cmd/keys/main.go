@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	db "github.com/monerokon/xmrpos/xmrpos-backend/internal/core/database"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/signing"
+	"gorm.io/gorm"
+)
+
+// Manages the key pairs tokens are signed with. Reads the same .env as the API.
+//
+//	keys list
+//	keys generate [-alg EdDSA|ES256] [-activate] [-grace 720h]
+//	keys activate [-grace 720h] <kid>
+//	keys rotate [-alg EdDSA|ES256] [-grace 720h]
+//	keys retire [-grace 720h] <kid>
+//	keys prune
+//
+// The grace period is how long a replaced key keeps verifying, by default REFRESH_TOKEN_TTL_HOURS
+// so sessions that were not refreshed in between stay valid.
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal("Failed to load config: ", err)
+	}
+
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	algorithm := flags.String("alg", "EdDSA", "key algorithm, EdDSA or ES256")
+	activate := flags.Bool("activate", false, "sign with the new key right away")
+	grace := flags.Duration("grace", cfg.RefreshTokenTTL, "how long a replaced key keeps verifying")
+	_ = flags.Parse(os.Args[2:])
+
+	database, err := db.NewPostgresClient(cfg)
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch command {
+	case "list":
+		err = list(ctx, database)
+	case "generate", "rotate":
+		key, generateErr := signing.GenerateKey(ctx, database, *algorithm, *activate || command == "rotate", *grace)
+		err = generateErr
+		if err == nil {
+			state := "published, activate it once verifiers refreshed their JWKS"
+			if key.ActivatedAt != nil {
+				state = "active"
+			}
+			fmt.Printf("Generated %s key %s, %s\n", key.Algorithm, key.KID, state)
+		}
+	case "activate":
+		err = signing.ActivateKey(ctx, database, kidArgument(flags), *grace)
+		if err == nil {
+			fmt.Println("Activated, the previous key keeps verifying for", *grace)
+		}
+	case "retire":
+		err = signing.RetireKey(ctx, database, kidArgument(flags), *grace)
+		if err == nil {
+			fmt.Println("Retired, the key keeps verifying for", *grace)
+		}
+	case "prune":
+		var deleted int64
+		deleted, err = signing.PruneKeys(ctx, database)
+		if err == nil {
+			fmt.Printf("Deleted %d expired keys\n", deleted)
+		}
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func list(ctx context.Context, database *gorm.DB) error {
+	keys, err := signing.ListKeys(ctx, database)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALGORITHM\tSTATE\tCREATED\tEXPIRES")
+	now := time.Now()
+	for _, key := range keys {
+		state := "published"
+		switch {
+		case key.ExpiresAt != nil && key.ExpiresAt.Before(now):
+			state = "expired"
+		case key.RetiredAt != nil:
+			state = "retired"
+		case key.ActivatedAt != nil:
+			state = "active"
+		}
+		expires := "-"
+		if key.ExpiresAt != nil {
+			expires = key.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", key.KID, key.Algorithm, state, key.CreatedAt.Format(time.RFC3339), expires)
+	}
+	return w.Flush()
+}
+
+func kidArgument(flags *flag.FlagSet) string {
+	if flags.NArg() != 1 {
+		usage()
+	}
+	return flags.Arg(0)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keys list | generate [-alg EdDSA|ES256] [-activate] [-grace 720h] | activate [-grace 720h] <kid> | rotate [-alg EdDSA|ES256] [-grace 720h] | retire [-grace 720h] <kid> | prune")
+	os.Exit(2)
+}
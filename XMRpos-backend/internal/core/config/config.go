@@ -2,19 +2,27 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/monerokon/xmrpos/xmrpos-backend/pkg/monero"
 )
 
 type Config struct {
-	// Admin Configuration
+	// Admin Configuration, only used to create the first admin
 	AdminName     string
 	AdminPassword string
 
+	// Admins must enable two-factor authentication before they can use the admin routes
+	AdminRequire2FA bool
+
 	// Server Configuration
-	Port string
+	Port           string
+	TrustedProxies []netip.Prefix // Reverse proxies whose forwarding headers name the client, none when empty
 
 	// Database Configuration
 	DBHost     string
@@ -27,10 +35,16 @@ type Config struct {
 	JWTSecret          string
 	JWTRefreshSecret   string
 	JWTMoneroPaySecret string
+	RefreshTokenTTL    time.Duration // Sessions not refreshed for this long expire
+	JWTHS256Fallback   bool          // Sign with the secrets while no key pair is active, and accept such tokens
+
+	// Payment backend for new invoices: "moneropay" or "walletrpc"
+	PaymentBackend string
 
-	// MoneroPay API Configuration
+	// MoneroPay API Configuration, only required for the moneropay backend
 	MoneroPayBaseURL     string
 	MoneroPayCallbackURL string
+	CallbackAllowedIPs   []netip.Prefix // Sources allowed to post callbacks, any when empty
 
 	// Monero Wallet RPC Configuration
 	MoneroWalletRPCEndpoint string
@@ -40,10 +54,61 @@ type Config struct {
 	// Monero Daemon RPC Configuration
 	MoneroDaemonRPCEndpoint string
 
+	// Wallet RPC instance holding the view-only wallets of self-custody vendors, optional
+	MoneroViewWalletRPCEndpoint string
+	MoneroViewWalletRPCUsername string
+	MoneroViewWalletRPCPassword string
+	ViewWalletPassword          string // Encrypts the view-only wallet files
+
+	// Network addresses are validated against, detected from the wallet when not set
+	MoneroNetwork monero.Network
+
 	// Wallet Settings
 	WalletName              string
 	WalletPassword          string
 	WalletAutoRefreshPeriod uint32
+
+	// Payout Settings
+	PayoutAddressCooldown time.Duration // Delay before a newly added payout address receives payouts
+
+	// Commission Settings, defaults for vendors without their own rule
+	CommissionBasisPoints uint   // Percentage of each transaction, 100 = 1%
+	CommissionFixedAmount int64  // Atomic units charged per transaction
+	OperatorAddress       string // Receives the commission with each payout, kept in the wallet when empty
+
+	// Confirmations after which a payment is final and can be paid out, at least monero.SpendableAge
+	ConfirmedDepth int64
+
+	// Payment Risk Settings, defaults for vendors without their own policy
+	RiskMinConfirmations  int64  // Floor on the confirmations a POS can ask for
+	RiskMaxZeroConfAmount *int64 // Largest amount accepted without confirmations, no limit when unset
+	RiskMinFee            int64  // Payments paying a lower fee need a confirmation
+
+	// Confirmation Checker Settings
+	ConfirmationPollInterval time.Duration // How often the chain height and the watched invoices are checked
+	ConfirmationWorkers      int           // Transactions checked concurrently
+
+	// Monitoring Settings
+	NotifyWebhookURL        string        // Receives a copy of every notification, optional
+	ReconciliationInterval  time.Duration // How often the wallet is reconciled with the database
+	ReconciliationTolerance int64         // Wallet shortfall in atomic units tolerated before alerting
+
+	// Rate Limit Settings
+	RateLimits              map[string]RateLimit // Requests per client IP and route group
+	LoginLockoutThreshold   int                  // Failed logins of one account before it is locked
+	LoginIPLockoutThreshold int                  // Failed logins from one IP before it is locked
+	LoginLockoutDuration    time.Duration
+
+	// Checkout Settings
+	PublicBaseURL               string        // Base URL of the hosted payment pages, e.g. https://pay.example.com
+	CheckoutTTL                 time.Duration // Default time a customer has to pay an online invoice
+	CheckoutWebhookAllowPrivate bool          // Deliver checkout webhooks to private and loopback addresses
+}
+
+// RateLimit allows Requests per Window, no limit when Requests is 0
+type RateLimit struct {
+	Requests int64
+	Window   time.Duration
 }
 
 func LoadConfig() (*Config, error) {
@@ -56,6 +121,8 @@ func LoadConfig() (*Config, error) {
 		AdminName:     os.Getenv("ADMIN_NAME"),
 		AdminPassword: os.Getenv("ADMIN_PASSWORD"),
 
+		AdminRequire2FA: true,
+
 		// Server Configuration
 		Port: os.Getenv("PORT"),
 
@@ -70,6 +137,11 @@ func LoadConfig() (*Config, error) {
 		JWTSecret:          os.Getenv("JWT_SECRET"),
 		JWTRefreshSecret:   os.Getenv("JWT_REFRESH_SECRET"),
 		JWTMoneroPaySecret: os.Getenv("JWT_MONEROPAY_SECRET"),
+		RefreshTokenTTL:    30 * 24 * time.Hour,
+		JWTHS256Fallback:   true,
+
+		// Payment backend
+		PaymentBackend: os.Getenv("PAYMENT_BACKEND"),
 
 		// MoneroPay API Configuration
 		MoneroPayBaseURL:     os.Getenv("MONEROPAY_BASE_URL"),
@@ -83,9 +155,42 @@ func LoadConfig() (*Config, error) {
 		// Monero Daemon RPC Configuration
 		MoneroDaemonRPCEndpoint: os.Getenv("MONERO_DAEMON_RPC_ENDPOINT"),
 
+		// View-only Wallet RPC Configuration
+		MoneroViewWalletRPCEndpoint: os.Getenv("MONERO_VIEW_WALLET_RPC_ENDPOINT"),
+		MoneroViewWalletRPCUsername: os.Getenv("MONERO_VIEW_WALLET_RPC_USERNAME"),
+		MoneroViewWalletRPCPassword: os.Getenv("MONERO_VIEW_WALLET_RPC_PASSWORD"),
+		ViewWalletPassword:          os.Getenv("VIEW_WALLET_PASSWORD"),
+
 		// Wallet Settings
 		WalletName:     os.Getenv("WALLET_NAME"),
 		WalletPassword: os.Getenv("WALLET_PASSWORD"),
+
+		// Payout Settings
+		PayoutAddressCooldown: 24 * time.Hour,
+
+		// Commission Settings
+		OperatorAddress: os.Getenv("OPERATOR_ADDRESS"),
+
+		// Monitoring Settings
+		NotifyWebhookURL:       os.Getenv("NOTIFY_WEBHOOK_URL"),
+		ReconciliationInterval: time.Hour,
+
+		ConfirmedDepth: monero.SpendableAge,
+
+		ConfirmationPollInterval: 5 * time.Second,
+		ConfirmationWorkers:      4,
+
+		RateLimits: map[string]RateLimit{
+			"login":    {Requests: 20, Window: time.Minute},
+			"signup":   {Requests: 5, Window: time.Hour},
+			"callback": {Requests: 600, Window: time.Minute},
+		},
+		LoginLockoutThreshold:   10,
+		LoginIPLockoutThreshold: 50,
+		LoginLockoutDuration:    15 * time.Minute,
+
+		PublicBaseURL: strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/"),
+		CheckoutTTL:   time.Hour,
 	}
 
 	if period := os.Getenv("WALLET_AUTO_REFRESH_PERIOD"); period != "" {
@@ -96,10 +201,219 @@ func LoadConfig() (*Config, error) {
 		config.WalletAutoRefreshPeriod = uint32(value)
 	}
 
+	switch config.PaymentBackend {
+	case "":
+		config.PaymentBackend = "moneropay"
+	case "moneropay", "walletrpc":
+	default:
+		return nil, fmt.Errorf("invalid PAYMENT_BACKEND: %s", config.PaymentBackend)
+	}
+
+	if network := os.Getenv("MONERO_NETWORK"); network != "" {
+		value, err := monero.ParseNetwork(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MONERO_NETWORK: %s", network)
+		}
+		config.MoneroNetwork = value
+	}
+
+	if hours := os.Getenv("PAYOUT_ADDRESS_COOLDOWN_HOURS"); hours != "" {
+		value, err := strconv.ParseUint(hours, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PAYOUT_ADDRESS_COOLDOWN_HOURS: %s", hours)
+		}
+		config.PayoutAddressCooldown = time.Duration(value) * time.Hour
+	}
+
+	if bps := os.Getenv("COMMISSION_BASIS_POINTS"); bps != "" {
+		value, err := strconv.ParseUint(bps, 10, 32)
+		if err != nil || value > 10000 {
+			return nil, fmt.Errorf("invalid COMMISSION_BASIS_POINTS: %s", bps)
+		}
+		config.CommissionBasisPoints = uint(value)
+	}
+
+	if fixed := os.Getenv("COMMISSION_FIXED_AMOUNT"); fixed != "" {
+		value, err := strconv.ParseInt(fixed, 10, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid COMMISSION_FIXED_AMOUNT: %s", fixed)
+		}
+		config.CommissionFixedAmount = value
+	}
+
+	if depth := os.Getenv("CONFIRMED_DEPTH"); depth != "" {
+		value, err := strconv.ParseInt(depth, 10, 64)
+		if err != nil || value < monero.SpendableAge {
+			return nil, fmt.Errorf("invalid CONFIRMED_DEPTH: %s", depth)
+		}
+		config.ConfirmedDepth = value
+	}
+
+	if confirmations := os.Getenv("RISK_MIN_CONFIRMATIONS"); confirmations != "" {
+		value, err := strconv.ParseInt(confirmations, 10, 64)
+		if err != nil || value < 0 || value > 10 {
+			return nil, fmt.Errorf("invalid RISK_MIN_CONFIRMATIONS: %s", confirmations)
+		}
+		config.RiskMinConfirmations = value
+	}
+
+	if amount := os.Getenv("RISK_MAX_ZERO_CONF_AMOUNT"); amount != "" {
+		value, err := strconv.ParseInt(amount, 10, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid RISK_MAX_ZERO_CONF_AMOUNT: %s", amount)
+		}
+		config.RiskMaxZeroConfAmount = &value
+	}
+
+	if fee := os.Getenv("RISK_MIN_FEE"); fee != "" {
+		value, err := strconv.ParseInt(fee, 10, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid RISK_MIN_FEE: %s", fee)
+		}
+		config.RiskMinFee = value
+	}
+
+	if allowed := os.Getenv("CALLBACK_ALLOWED_IPS"); allowed != "" {
+		prefixes, err := parsePrefixes("CALLBACK_ALLOWED_IPS", allowed)
+		if err != nil {
+			return nil, err
+		}
+		config.CallbackAllowedIPs = prefixes
+	}
+
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		prefixes, err := parsePrefixes("TRUSTED_PROXIES", proxies)
+		if err != nil {
+			return nil, err
+		}
+		config.TrustedProxies = prefixes
+	}
+
+	if seconds := os.Getenv("CONFIRMATION_POLL_SECONDS"); seconds != "" {
+		value, err := strconv.ParseUint(seconds, 10, 32)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid CONFIRMATION_POLL_SECONDS: %s", seconds)
+		}
+		config.ConfirmationPollInterval = time.Duration(value) * time.Second
+	}
+
+	if workers := os.Getenv("CONFIRMATION_WORKERS"); workers != "" {
+		value, err := strconv.ParseUint(workers, 10, 32)
+		if err != nil || value == 0 || value > 64 {
+			return nil, fmt.Errorf("invalid CONFIRMATION_WORKERS: %s", workers)
+		}
+		config.ConfirmationWorkers = int(value)
+	}
+
+	if minutes := os.Getenv("RECONCILIATION_INTERVAL_MINUTES"); minutes != "" {
+		value, err := strconv.ParseUint(minutes, 10, 32)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid RECONCILIATION_INTERVAL_MINUTES: %s", minutes)
+		}
+		config.ReconciliationInterval = time.Duration(value) * time.Minute
+	}
+
+	if tolerance := os.Getenv("RECONCILIATION_TOLERANCE"); tolerance != "" {
+		value, err := strconv.ParseInt(tolerance, 10, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid RECONCILIATION_TOLERANCE: %s", tolerance)
+		}
+		config.ReconciliationTolerance = value
+	}
+
+	if hours := os.Getenv("REFRESH_TOKEN_TTL_HOURS"); hours != "" {
+		value, err := strconv.ParseUint(hours, 10, 32)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid REFRESH_TOKEN_TTL_HOURS: %s", hours)
+		}
+		config.RefreshTokenTTL = time.Duration(value) * time.Hour
+	}
+
+	// Route group limits, e.g. login=20/1m,signup=5/1h; a limit of 0 turns the group's limit off
+	if limits := os.Getenv("RATE_LIMITS"); limits != "" {
+		for _, entry := range strings.Split(limits, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			group, limit, ok := strings.Cut(entry, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid RATE_LIMITS: %s", entry)
+			}
+			requests, window, ok := strings.Cut(limit, "/")
+			if !ok {
+				return nil, fmt.Errorf("invalid RATE_LIMITS: %s", entry)
+			}
+			requestsValue, err := strconv.ParseInt(strings.TrimSpace(requests), 10, 64)
+			if err != nil || requestsValue < 0 {
+				return nil, fmt.Errorf("invalid RATE_LIMITS: %s", entry)
+			}
+			windowValue, err := time.ParseDuration(strings.TrimSpace(window))
+			if err != nil || windowValue <= 0 {
+				return nil, fmt.Errorf("invalid RATE_LIMITS: %s", entry)
+			}
+			config.RateLimits[strings.TrimSpace(group)] = RateLimit{Requests: requestsValue, Window: windowValue}
+		}
+	}
+
+	if threshold := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); threshold != "" {
+		value, err := strconv.ParseUint(threshold, 10, 32)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_THRESHOLD: %s", threshold)
+		}
+		config.LoginLockoutThreshold = int(value)
+	}
+
+	if threshold := os.Getenv("LOGIN_IP_LOCKOUT_THRESHOLD"); threshold != "" {
+		value, err := strconv.ParseUint(threshold, 10, 32)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid LOGIN_IP_LOCKOUT_THRESHOLD: %s", threshold)
+		}
+		config.LoginIPLockoutThreshold = int(value)
+	}
+
+	if minutes := os.Getenv("LOGIN_LOCKOUT_MINUTES"); minutes != "" {
+		value, err := strconv.ParseUint(minutes, 10, 32)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_MINUTES: %s", minutes)
+		}
+		config.LoginLockoutDuration = time.Duration(value) * time.Minute
+	}
+
+	if fallback := os.Getenv("JWT_HS256_FALLBACK"); fallback != "" {
+		value, err := strconv.ParseBool(fallback)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_HS256_FALLBACK: %s", fallback)
+		}
+		config.JWTHS256Fallback = value
+	}
+
+	if minutes := os.Getenv("CHECKOUT_TTL_MINUTES"); minutes != "" {
+		value, err := strconv.ParseUint(minutes, 10, 32)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid CHECKOUT_TTL_MINUTES: %s", minutes)
+		}
+		config.CheckoutTTL = time.Duration(value) * time.Minute
+	}
+
+	if allowPrivate := os.Getenv("CHECKOUT_WEBHOOK_ALLOW_PRIVATE"); allowPrivate != "" {
+		value, err := strconv.ParseBool(allowPrivate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CHECKOUT_WEBHOOK_ALLOW_PRIVATE: %s", allowPrivate)
+		}
+		config.CheckoutWebhookAllowPrivate = value
+	}
+
+	if require2FA := os.Getenv("ADMIN_REQUIRE_2FA"); require2FA != "" {
+		value, err := strconv.ParseBool(require2FA)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ADMIN_REQUIRE_2FA: %s", require2FA)
+		}
+		config.AdminRequire2FA = value
+	}
+
 	// Validate required fields
-	if config.AdminName == "" ||
-		config.AdminPassword == "" ||
-		config.Port == "" ||
+	if config.Port == "" ||
 		config.DBHost == "" ||
 		config.DBUser == "" ||
 		config.DBPassword == "" ||
@@ -107,12 +421,41 @@ func LoadConfig() (*Config, error) {
 		config.DBPort == "" ||
 		config.JWTSecret == "" ||
 		config.JWTRefreshSecret == "" ||
-		config.JWTMoneroPaySecret == "" ||
-		config.MoneroPayBaseURL == "" ||
-		config.MoneroPayCallbackURL == "" ||
 		config.MoneroWalletRPCEndpoint == "" {
 		return nil, fmt.Errorf("missing required environment variables")
 	}
 
+	if config.PaymentBackend == "moneropay" &&
+		(config.JWTMoneroPaySecret == "" ||
+			config.MoneroPayBaseURL == "" ||
+			config.MoneroPayCallbackURL == "") {
+		return nil, fmt.Errorf("missing required MoneroPay environment variables")
+	}
+
+	if config.MoneroViewWalletRPCEndpoint != "" && config.ViewWalletPassword == "" {
+		return nil, fmt.Errorf("VIEW_WALLET_PASSWORD is required with MONERO_VIEW_WALLET_RPC_ENDPOINT")
+	}
+
 	return config, nil
 }
+
+// parsePrefixes reads a comma separated list of IPs and CIDR ranges, a single IP is its own range
+func parsePrefixes(name string, value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid %s: %s", name, entry)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
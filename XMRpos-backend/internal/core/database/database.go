@@ -8,6 +8,8 @@ import (
 
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/payment"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -51,6 +53,33 @@ func NewPostgresClient(cfg *config.Config) (*gorm.DB, error) {
 		&models.Pos{},
 		&models.Vendor{},
 		&models.Transfer{},
+		&models.TransferDestination{},
+		&models.PayoutAddress{},
+		&models.PayoutAddressChange{},
+		&models.LedgerEntry{},
+		&models.CommissionRule{},
+		&models.VendorRiskPolicy{},
+		&models.Notification{},
+		&models.ReconciliationReport{},
+		&models.ReconciliationLine{},
+		&models.CallbackAuditLog{},
+		&models.CallbackInboxEntry{},
+		&models.VendorRole{},
+		&models.Staff{},
+		&models.Admin{},
+		&models.AdminAuditLog{},
+		&models.TwoFactor{},
+		&models.RecoveryCode{},
+		&models.RefreshSession{},
+		&models.RateLimitBucket{},
+		&models.LoginFailure{},
+		&models.SigningKey{},
+		&models.PairingCode{},
+		&models.PosDevice{},
+		&models.APIKey{},
+		&models.Checkout{},
+		&models.CheckoutWebhook{},
+		&models.WebhookDelivery{},
 	)
 	if err != nil {
 		return nil, err
@@ -60,6 +89,26 @@ func NewPostgresClient(cfg *config.Config) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	if err := backfillTransferStatus(db); err != nil {
+		return nil, err
+	}
+
+	if err := backfillPayoutAddresses(db); err != nil {
+		return nil, err
+	}
+
+	if err := ensureLedgerImmutable(db); err != nil {
+		return nil, err
+	}
+
+	if err := backfillLedger(db); err != nil {
+		return nil, err
+	}
+
+	if err := bootstrapAdmin(db, cfg); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -123,6 +172,105 @@ func ensureNameIndexes(db *gorm.DB) error {
 	return nil
 }
 
+// Transfers created before the status column existed only carried the completed flag
+func backfillTransferStatus(db *gorm.DB) error {
+	err := db.Model(&models.Transfer{}).
+		Where("completed = ? AND status <> ?", true, models.TransferStatusCompleted).
+		Update("status", models.TransferStatusCompleted).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill transfer status: %w", err)
+	}
+	return nil
+}
+
+// Vendors created before the payout address book get their signup address as the only payout address
+func backfillPayoutAddresses(db *gorm.DB) error {
+	err := db.Exec(`
+		INSERT INTO payout_addresses (created_at, updated_at, vendor_id, address, percentage, active_from)
+		SELECT NOW(), NOW(), v.id, v.monero_subaddress, 100, NOW()
+		FROM vendors v
+		WHERE v.deleted_at IS NULL
+		  AND v.monero_subaddress <> ''
+		  AND NOT EXISTS (SELECT 1 FROM payout_addresses p WHERE p.vendor_id = v.id)
+	`).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill payout addresses: %w", err)
+	}
+	return nil
+}
+
+// bootstrapAdmin creates the first admin from ADMIN_NAME and ADMIN_PASSWORD while there is none.
+// Once an admin exists the variables are ignored.
+func bootstrapAdmin(db *gorm.DB, cfg *config.Config) error {
+	var count int64
+	if err := db.Model(&models.Admin{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count admins: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	if cfg.AdminName == "" || cfg.AdminPassword == "" {
+		return fmt.Errorf("no admin exists yet, set ADMIN_NAME and ADMIN_PASSWORD to create the first one")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(cfg.AdminPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash admin password: %w", err)
+	}
+	admin := &models.Admin{Name: cfg.AdminName, PasswordHash: string(hashedPassword)}
+	if err := db.Create(admin).Error; err != nil {
+		return fmt.Errorf("failed to create admin: %w", err)
+	}
+	return nil
+}
+
 func quoteIdentifier(name string) string {
 	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
 }
+
+// ensureLedgerImmutable installs a trigger rejecting updates and deletes of ledger entries
+func ensureLedgerImmutable(db *gorm.DB) error {
+	statements := []string{
+		`CREATE OR REPLACE FUNCTION ledger_entries_immutable() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'ledger entries are immutable';
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS ledger_entries_immutable ON ledger_entries`,
+		`CREATE TRIGGER ledger_entries_immutable BEFORE UPDATE OR DELETE ON ledger_entries
+		FOR EACH ROW EXECUTE FUNCTION ledger_entries_immutable()`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to install ledger trigger: %w", err)
+		}
+	}
+	return nil
+}
+
+// backfillLedger posts the sale credits and payout debits of data predating the ledger.
+// The unique indexes make it a no-op for transactions and transfers that already have entries.
+// Payments into the wallets of self-custody vendors are never credited.
+func backfillLedger(db *gorm.DB) error {
+	if err := db.Exec(`
+		INSERT INTO ledger_entries (created_at, vendor_id, type, amount, debit_account, credit_account, transaction_id)
+		SELECT t.updated_at, t.vendor_id, ?, t.amount, ?, ?, t.id
+		FROM transactions t
+		WHERE t.confirmed = TRUE AND t.deleted_at IS NULL AND t.payment_backend <> ?
+		ON CONFLICT DO NOTHING
+	`, models.LedgerEntrySaleCredit, models.LedgerAccountWallet, models.LedgerAccountVendor, payment.BackendViewOnly).Error; err != nil {
+		return fmt.Errorf("failed to backfill sale credits: %w", err)
+	}
+
+	if err := db.Exec(`
+		INSERT INTO ledger_entries (created_at, vendor_id, type, amount, debit_account, credit_account, transfer_id)
+		SELECT tr.created_at, tr.vendor_id, ?, tr.amount, ?, ?, tr.id
+		FROM transfers tr
+		WHERE tr.deleted_at IS NULL
+		ON CONFLICT DO NOTHING
+	`, models.LedgerEntryPayoutDebit, models.LedgerAccountVendor, models.LedgerAccountWallet).Error; err != nil {
+		return fmt.Errorf("failed to backfill payout debits: %w", err)
+	}
+
+	return nil
+}
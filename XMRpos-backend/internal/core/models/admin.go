@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Admin is an operator account. The first one is created from ADMIN_NAME and ADMIN_PASSWORD
+// when the table is empty; further admins are managed through the API.
+type Admin struct {
+	gorm.Model
+	Name            string `gorm:"not null;uniqueIndex:idx_admin_name,where:deleted_at IS NULL"`
+	PasswordHash    string `gorm:"not null" json:"-"`
+	PasswordVersion uint32 `gorm:"not null;default:1" json:"-"`
+}
+
+// AdminAuditLog records a change an admin made through the API
+type AdminAuditLog struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index"`
+	AdminID    uint      `gorm:"not null;index"`
+	Method     string    `gorm:"not null"`
+	Path       string    `gorm:"not null;type:text"`
+	Status     int       `gorm:"not null"` // HTTP status of the response
+	RemoteAddr string    `gorm:"not null;type:text"`
+	Body       string    `gorm:"type:text"` // Request body with passwords, secrets and codes redacted
+}
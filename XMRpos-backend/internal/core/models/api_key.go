@@ -0,0 +1,52 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix starts every API key, so keys are told apart from JWTs and found by secret scanners
+const APIKeyPrefix = "xpk_"
+
+// APIKeyScopes are the permissions an API key can be given. Keys are for integrations like a web
+// shop; managing the vendor stays with its logins.
+var APIKeyScopes = []Permission{
+	PermissionTransactionsCreate,
+	PermissionTransactionsView,
+	PermissionTransactionsExport,
+}
+
+// IsAPIKeyScope reports whether the permission can be given to an API key
+func IsAPIKeyScope(permission Permission) bool {
+	for _, p := range APIKeyScopes {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey lets a vendor's integration call the API without logging in. The key is
+// "xpk_<prefix>_<secret>": the prefix identifies it and is shown in listings, only the hash of the
+// secret is stored.
+type APIKey struct {
+	gorm.Model
+	VendorID   uint       `gorm:"not null;index" json:"vendor_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null;uniqueIndex" json:"prefix"`
+	SecretHash string     `gorm:"not null" json:"-"`                // SHA-256 of the secret
+	Scopes     string     `gorm:"not null;type:text" json:"scopes"` // Comma separated APIKeyScopes
+	ExpiresAt  *time.Time `json:"expires_at"`                       // nil when the key does not expire
+	LastUsedAt *time.Time `json:"last_used_at"`                     // Updated at most once a minute
+	LastUsedIP string     `gorm:"type:text" json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// HashAPIKeySecret is the SHA-256 of the secret part of an API key
+func HashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
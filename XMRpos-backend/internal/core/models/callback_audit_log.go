@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+type CallbackOutcome string
+
+const (
+	CallbackOutcomeAccepted CallbackOutcome = "accepted" // Authenticated and stored in the inbox
+	CallbackOutcomeIgnored  CallbackOutcome = "ignored"  // Authenticated, but a duplicate
+	CallbackOutcomeRejected CallbackOutcome = "rejected" // Failed authentication or the allowlist
+)
+
+// CallbackAuditLog records every MoneroPay callback received, so a forged or replayed callback
+// can be traced back to its source
+type CallbackAuditLog struct {
+	ID            uint            `gorm:"primarykey"`
+	CreatedAt     time.Time       `gorm:"not null;index"`
+	TransactionID *uint           `gorm:"index"` // Nil when the token did not name a transaction
+	RemoteAddr    string          `gorm:"not null"`
+	Outcome       CallbackOutcome `gorm:"not null;type:text;index"`
+	Reason        *string         `gorm:"type:text"`
+	Payload       string          `gorm:"not null;type:text"` // Start of the callback body, without the URL token
+	PayloadSize   int             `gorm:"not null;default:0"`
+	PayloadHash   string          `gorm:"not null;default:''"` // SHA-256 of the whole body
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+type CallbackInboxStatus string
+
+const (
+	CallbackInboxPending   CallbackInboxStatus = "pending"   // Waiting for the worker, also between retries
+	CallbackInboxProcessed CallbackInboxStatus = "processed" // Processed, or nothing left to do
+	CallbackInboxRejected  CallbackInboxStatus = "rejected"  // The data did not match MoneroPay
+	CallbackInboxFailed    CallbackInboxStatus = "failed"    // Gave up after the last retry, the checker still follows the transaction
+)
+
+// CallbackInboxEntry is an authenticated MoneroPay callback waiting to be processed. MoneroPay
+// calls back once per payment and confirmation, so the same key arriving again is a duplicate.
+type CallbackInboxEntry struct {
+	ID            uint                `gorm:"primarykey"`
+	CreatedAt     time.Time           `gorm:"not null"`
+	UpdatedAt     time.Time           `gorm:"not null"`
+	TransactionID uint                `gorm:"not null;uniqueIndex:idx_callback_inbox_key"`
+	TxHash        string              `gorm:"not null;uniqueIndex:idx_callback_inbox_key"` // Payment that triggered the callback, empty when none
+	Confirmations int64               `gorm:"not null;uniqueIndex:idx_callback_inbox_key"`
+	Payload       string              `gorm:"not null;type:text"`
+	Status        CallbackInboxStatus `gorm:"not null;type:text;index:idx_callback_inbox_due,priority:1"`
+	Attempts      int                 `gorm:"not null;default:0"`
+	NextAttemptAt time.Time           `gorm:"not null;index:idx_callback_inbox_due,priority:2"` // Also leases claimed entries until processed
+	LastError     *string             `gorm:"type:text"`
+	ProcessedAt   *time.Time
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CheckoutStatusPending   = "pending"   // Waiting for the customer to pay
+	CheckoutStatusPaid      = "paid"      // Paid with the required confirmations, not yet final
+	CheckoutStatusConfirmed = "confirmed" // Final and credited to the vendor
+	CheckoutStatusExpired   = "expired"   // Not paid before it expired
+)
+
+// Events sent to the vendor's checkout webhook
+const (
+	CheckoutEventPaid      = "checkout.paid"
+	CheckoutEventConfirmed = "checkout.confirmed"
+	CheckoutEventExpired   = "checkout.expired"
+)
+
+// Checkout is an online order paid on a hosted payment page. Its transaction is created like a
+// POS sale, without a POS.
+type Checkout struct {
+	gorm.Model
+	VendorID      uint       `gorm:"not null;uniqueIndex:idx_checkout_vendor_order" json:"vendor_id"`
+	OrderID       string     `gorm:"not null;uniqueIndex:idx_checkout_vendor_order" json:"order_id"` // The shop's order, one checkout each
+	TransactionID uint       `gorm:"not null;uniqueIndex" json:"transaction_id"`
+	APIKeyID      *uint      `gorm:"index" json:"api_key_id"`       // Key that created the checkout, nil for a vendor login
+	PublicID      string     `gorm:"not null;uniqueIndex" json:"-"` // Random ID in the payment page URL
+	RedirectURL   string     `gorm:"not null;type:text" json:"redirect_url"`
+	CancelURL     string     `gorm:"not null;type:text" json:"cancel_url"`
+	Metadata      string     `gorm:"not null;type:text" json:"-"` // JSON object passed back in the webhooks
+	Status        string     `gorm:"not null;default:pending;index" json:"status"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"expires_at"`
+	PaidAt        *time.Time `json:"paid_at"`
+}
+
+// CheckoutWebhook is where a vendor receives the results of its checkouts. The secret signs
+// every delivery, so it is kept in clear text.
+type CheckoutWebhook struct {
+	VendorID  uint   `gorm:"primarykey"`
+	URL       string `gorm:"not null;type:text"`
+	Secret    string `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WebhookDelivery is a checkout event waiting to be delivered to the vendor's webhook. Failed
+// deliveries are retried with a growing delay for about a day.
+type WebhookDelivery struct {
+	ID            uint      `gorm:"primarykey"`
+	CreatedAt     time.Time `gorm:"not null"`
+	VendorID      uint      `gorm:"not null;index"`
+	CheckoutID    uint      `gorm:"not null;index"`
+	Event         string    `gorm:"not null"`
+	Payload       string    `gorm:"not null;type:text"`
+	Attempts      int       `gorm:"not null;default:0"`
+	NextAttemptAt time.Time `gorm:"not null;index"` // Also leases claimed deliveries
+	DeliveredAt   *time.Time
+	FailedAt      *time.Time // Set when the last retry failed
+	LastError     *string    `gorm:"type:text"`
+}
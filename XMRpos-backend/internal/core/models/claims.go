@@ -11,6 +11,11 @@ const (
 	ClaimsRoleKey            ClaimsContextKey = "ClaimsRole"
 	ClaimsPasswordVersionKey ClaimsContextKey = "ClaimsPasswordVersion"
 	ClaimsPosIDKey           ClaimsContextKey = "ClaimsPosID"
+	ClaimsAdminIDKey         ClaimsContextKey = "ClaimsAdminID"
+	ClaimsStaffIDKey         ClaimsContextKey = "ClaimsStaffID"
+	ClaimsStaffVersionKey    ClaimsContextKey = "ClaimsStaffVersion"
+	ClaimsSessionIDKey       ClaimsContextKey = "ClaimsSessionID"
+	ClaimsAPIKeyIDKey        ClaimsContextKey = "ClaimsAPIKeyID"
 	ClaimsExpKey             ClaimsContextKey = "ClaimsExp"
 )
 
@@ -20,5 +25,10 @@ type Claims struct {
 	Role            string `json:"role"`
 	PasswordVersion uint32 `json:"password_version"`
 	PosID           *uint  `json:"pos_id"`
+	AdminID         *uint  `json:"admin_id,omitempty"`
+	StaffID         *uint  `json:"staff_id,omitempty"`      // Set when a staff member logged in on the POS
+	StaffVersion    uint32 `json:"staff_version,omitempty"` // Password version of the staff member
+	SessionID       string `json:"sid,omitempty"`           // Refresh session the token was issued for
+	APIKeyID        *uint  `json:"-"`                       // Set by AuthMiddleware for requests made with an API key, never from a token
 	jwt.RegisteredClaims
 }
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// CommissionRule overrides the operator's default commission for one vendor
+type CommissionRule struct {
+	gorm.Model
+	VendorID    uint   `gorm:"not null;uniqueIndex"`
+	Vendor      Vendor `gorm:"foreignKey:VendorID"`
+	BasisPoints uint   `gorm:"not null;default:0"` // Percentage of each transaction, 100 = 1%
+	FixedAmount int64  `gorm:"not null;default:0"` // Atomic units charged per transaction
+}
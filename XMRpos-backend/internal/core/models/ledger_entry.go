@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+type LedgerEntryType string
+
+const (
+	LedgerEntrySaleCredit        LedgerEntryType = "sale_credit"        // Confirmed payment for a transaction
+	LedgerEntryOverpaymentCredit LedgerEntryType = "overpayment_credit" // Amount received above the invoiced amount
+	LedgerEntryPayoutDebit       LedgerEntryType = "payout_debit"       // Balance reserved for a transfer to the vendor
+	LedgerEntryFee               LedgerEntryType = "fee"                // Commission charged to the vendor
+	LedgerEntryRefund            LedgerEntryType = "refund"             // Refund paid back to a customer
+	LedgerEntryAdjustment        LedgerEntryType = "adjustment"         // Manual correction by an admin
+	LedgerEntryReorgReversal     LedgerEntryType = "reorg_reversal"     // Credit of a confirmed transaction taken back after a reorg
+	LedgerEntryReorgCredit       LedgerEntryType = "reorg_credit"       // Credit posted again once a reverted transaction is confirmed again
+)
+
+// Ledger accounts. Every entry debits one account and credits another by Amount; the vendor's
+// balance is everything credited to LedgerAccountVendor minus everything debited from it.
+const (
+	LedgerAccountVendor   = "vendor"   // Funds owed to the vendor
+	LedgerAccountWallet   = "wallet"   // Funds held in the operator's wallet
+	LedgerAccountFees     = "fees"     // Fees collected by the operator
+	LedgerAccountOperator = "operator" // Operator equity, counterpart of manual adjustments
+)
+
+// LedgerEntry rows are append-only; a trigger rejects updates and deletes, corrections are new entries
+type LedgerEntry struct {
+	ID            uint            `gorm:"primarykey"`
+	CreatedAt     time.Time       `gorm:"not null;index"`
+	VendorID      uint            `gorm:"not null;index"`
+	Type          LedgerEntryType `gorm:"not null;type:text;index"`
+	Amount        int64           `gorm:"not null"` // Always positive, the direction comes from the accounts
+	DebitAccount  string          `gorm:"not null;type:text"`
+	CreditAccount string          `gorm:"not null;type:text"`
+	TransactionID *uint           `gorm:"uniqueIndex:idx_ledger_sale_credit,where:type = 'sale_credit';uniqueIndex:idx_ledger_fee,where:type = 'fee'"` // One sale credit and one fee per transaction
+	TransferID    *uint           `gorm:"uniqueIndex:idx_ledger_payout_debit,where:type = 'payout_debit'"`                                             // One payout debit per transfer
+	Memo          *string         `gorm:"type:text"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type NotificationAudience string
+
+const (
+	NotificationAudienceAdmin  NotificationAudience = "admin"
+	NotificationAudienceVendor NotificationAudience = "vendor"
+)
+
+type Notification struct {
+	gorm.Model
+	Audience NotificationAudience `gorm:"not null;type:text;index"`
+	VendorID *uint                `gorm:"index"` // Set for vendor notifications
+	Subject  string               `gorm:"not null"`
+	Message  string               `gorm:"not null;type:text"`
+	ReadAt   *time.Time
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PayoutAddress struct {
+	gorm.Model
+	VendorID   uint      `gorm:"not null;index"` // Foreign key field
+	Vendor     Vendor    `gorm:"foreignKey:VendorID"`
+	Address    string    `gorm:"not null;type:text"`
+	Label      *string   `gorm:"size:100"`
+	Percentage uint      `gorm:"not null;default:0"` // Share of each payout, normalized over the active addresses
+	ActiveFrom time.Time `gorm:"not null"`           // Address is not paid out to before this (cool-down)
+}
+
+type PayoutAddressAction string
+
+const (
+	PayoutAddressAdded        PayoutAddressAction = "added"
+	PayoutAddressRemoved      PayoutAddressAction = "removed"
+	PayoutAddressSplitUpdated PayoutAddressAction = "split_updated"
+)
+
+// PayoutAddressChange is the audit trail of changes to a vendor's payout addresses
+type PayoutAddressChange struct {
+	gorm.Model
+	VendorID        uint                `gorm:"not null;index"` // Foreign key field
+	PayoutAddressID *uint               `gorm:"index"`
+	Action          PayoutAddressAction `gorm:"not null"`
+	Address         string              `gorm:"not null;type:text"`
+	Details         *string             `gorm:"type:text"`
+	RemoteIP        string              `gorm:"not null;default:''"`
+}
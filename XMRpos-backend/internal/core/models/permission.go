@@ -0,0 +1,120 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type Permission string
+
+// Admin permissions. They act across vendors, so they are never granted to a vendor role.
+const (
+	PermissionVendorsManage        Permission = "vendors:manage"        // Invites, the vendor list and deleting vendors
+	PermissionWalletView           Permission = "wallet:view"           // Balance of the operator's wallet
+	PermissionPayoutsManage        Permission = "payouts:manage"        // Transfer the balance of any vendor
+	PermissionLedgerManage         Permission = "ledger:manage"         // Vendor statements and adjustments
+	PermissionTransactionsRefund   Permission = "transactions:refund"   // Record refunds of confirmed transactions
+	PermissionCommissionManage     Permission = "commission:manage"     // Commission rules
+	PermissionReconciliationManage Permission = "reconciliation:manage" // Reconciliation reports and runs
+	PermissionAlertsView           Permission = "alerts:view"           // Admin notifications
+	PermissionAdminsManage         Permission = "admins:manage"         // Admin accounts and the admin audit log
+)
+
+// Vendor permissions, always limited to the caller's own vendor
+const (
+	PermissionTransactionsCreate    Permission = "transactions:create"
+	PermissionTransactionsView      Permission = "transactions:view"
+	PermissionTransactionsExport    Permission = "transactions:export"     // CSV export of all the vendor's transactions
+	PermissionPayoutsRequest        Permission = "payouts:request"         // Transfer the vendor's balance
+	PermissionPayoutAddressesManage Permission = "payout_addresses:manage" // Payout addresses and their split
+	PermissionLedgerView            Permission = "ledger:view"             // Balance and ledger statement
+	PermissionPosManage             Permission = "pos:manage"              // Create POS devices, pair devices and assign their role
+	PermissionRolesManage           Permission = "roles:manage"            // Custom vendor roles
+	PermissionStaffManage           Permission = "staff:manage"            // Staff accounts and revoking them
+	PermissionReportsView           Permission = "reports:view"            // Sales reports per staff member
+	PermissionSettingsManage        Permission = "settings:manage"         // Risk policy, self custody and the checkout webhook
+	PermissionNotificationsView     Permission = "notifications:view"
+	PermissionVendorDelete          Permission = "vendor:delete"
+	PermissionAPIKeysManage         Permission = "api_keys:manage" // API keys for integrations
+)
+
+// Built-in roles. RoleAdmin, RoleVendor and RolePos are also the roles of the login tokens; a POS
+// acts with the vendor role assigned to it.
+const (
+	RoleAdmin   = "admin"
+	RoleVendor  = "vendor" // The vendor's own login, allowed everything within the vendor
+	RolePos     = "pos"
+	RoleManager = "manager"
+	RoleCashier = "cashier"
+)
+
+var AdminPermissions = []Permission{
+	PermissionVendorsManage,
+	PermissionWalletView,
+	PermissionPayoutsManage,
+	PermissionLedgerManage,
+	PermissionTransactionsRefund,
+	PermissionCommissionManage,
+	PermissionReconciliationManage,
+	PermissionAlertsView,
+	PermissionAdminsManage,
+}
+
+var VendorPermissions = []Permission{
+	PermissionTransactionsCreate,
+	PermissionTransactionsView,
+	PermissionTransactionsExport,
+	PermissionPayoutsRequest,
+	PermissionPayoutAddressesManage,
+	PermissionLedgerView,
+	PermissionPosManage,
+	PermissionRolesManage,
+	PermissionStaffManage,
+	PermissionReportsView,
+	PermissionSettingsManage,
+	PermissionNotificationsView,
+	PermissionVendorDelete,
+	PermissionAPIKeysManage,
+}
+
+// RolePermissions maps the built-in roles to their permissions
+var RolePermissions = map[string][]Permission{
+	RoleAdmin:  AdminPermissions,
+	RoleVendor: VendorPermissions,
+	RoleManager: {
+		PermissionTransactionsCreate,
+		PermissionTransactionsView,
+		PermissionTransactionsExport,
+		PermissionPayoutsRequest,
+		PermissionLedgerView,
+		PermissionReportsView,
+		PermissionNotificationsView,
+	},
+	RoleCashier: {
+		PermissionTransactionsCreate,
+		PermissionTransactionsView,
+	},
+}
+
+// IsVendorPermission reports whether the permission can be granted to a vendor role. Managing
+// roles, staff and API keys and deleting the vendor stay with the vendor's own login, so a POS or
+// staff member cannot raise its own permissions.
+func IsVendorPermission(permission Permission) bool {
+	if permission == PermissionRolesManage || permission == PermissionStaffManage || permission == PermissionVendorDelete || permission == PermissionAPIKeysManage {
+		return false
+	}
+	for _, p := range VendorPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// VendorRole is a role a vendor defined next to the built-in manager and cashier
+type VendorRole struct {
+	gorm.Model
+	VendorID    uint   `gorm:"not null;uniqueIndex:idx_vendor_role_name,priority:1,where:deleted_at IS NULL"`
+	Vendor      Vendor `gorm:"foreignKey:VendorID"`
+	Name        string `gorm:"not null;uniqueIndex:idx_vendor_role_name,priority:2,where:deleted_at IS NULL"`
+	Permissions string `gorm:"not null;type:text"` // Comma separated vendor permissions
+}
@@ -11,5 +11,6 @@ type Pos struct {
 	PasswordVersion    uint32        `gorm:"not null;default:1"`
 	VendorID           uint          `gorm:"not null;uniqueIndex:idx_pos_vendor_id_name,priority:1,where:deleted_at IS NULL"`
 	Vendor             Vendor        `gorm:"foreignKey:VendorID"`
+	Role               string        `gorm:"not null;default:cashier"` // Built-in or custom vendor role the device acts with
 	DeviceTransactions []Transaction `gorm:"foreignKey:PosID"`
 }
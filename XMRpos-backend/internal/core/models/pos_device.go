@@ -0,0 +1,49 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PosDeviceStatusPending  = "pending"
+	PosDeviceStatusApproved = "approved"
+	PosDeviceStatusRevoked  = "revoked"
+)
+
+// PairingCode lets a device pair with a POS without typing its credentials. It is valid for a
+// few minutes and only once.
+type PairingCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	VendorID  uint      `gorm:"not null;index"`
+	PosID     uint      `gorm:"not null"`
+	CodeHash  string    `gorm:"not null;uniqueIndex"` // SHA-256 of the code
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+// PosDevice is a device paired with a POS. It logs in with its own credential once the vendor
+// approved it, and is revoked on its own without touching the POS password.
+type PosDevice struct {
+	gorm.Model
+	VendorID   uint       `gorm:"not null;index" json:"vendor_id"`
+	PosID      uint       `gorm:"not null;index" json:"pos_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	SecretHash string     `gorm:"not null" json:"-"` // SHA-256 of the device secret
+	Status     string     `gorm:"not null;default:pending" json:"status"`
+	ApprovedAt *time.Time `json:"approved_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+// HashPairingCode ignores case, spaces and dashes so codes can be typed loosely
+func HashPairingCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RateLimitBucket counts the requests of one client in the current window of a route group
+type RateLimitBucket struct {
+	BucketKey   string    `gorm:"primaryKey"` // Route group and client IP
+	Count       int64     `gorm:"not null;default:0"`
+	WindowStart time.Time `gorm:"not null;index"`
+}
+
+// LoginFailure tracks the failed logins of an account or an IP, which slow down and then lock
+// further attempts
+type LoginFailure struct {
+	FailureKey    string    `gorm:"primaryKey"` // "account:<role>:<name>" or "ip:<address>"
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"not null;index"`
+	LockedUntil   *time.Time
+}
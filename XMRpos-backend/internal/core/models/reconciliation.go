@@ -0,0 +1,37 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// ReconciliationReport compares what the wallet holds with what the database says it should hold.
+// Expected = VendorBalances + PendingTransfers + UnconfirmedReceived + RetainedCommission
+type ReconciliationReport struct {
+	gorm.Model
+	WalletBalance       int64                 `gorm:"not null"`
+	WalletUnlocked      int64                 `gorm:"not null"`
+	VendorBalances      int64                 `gorm:"not null"` // Sum of vendor ledger balances
+	PendingTransfers    int64                 `gorm:"not null"` // Debited from vendors but not yet relayed
+	UnconfirmedReceived int64                 `gorm:"not null"` // Mined payments not yet credited to a vendor
+	RetainedCommission  int64                 `gorm:"not null"` // Commission kept in the wallet
+	Expected            int64                 `gorm:"not null"`
+	Discrepancy         int64                 `gorm:"not null"` // WalletBalance - Expected
+	Healthy             bool                  `gorm:"not null;index"`
+	Error               *string               `gorm:"type:text"` // Set when the run could not complete
+	Lines               []*ReconciliationLine `gorm:"foreignKey:ReportID"`
+}
+
+// ReconciliationLine is the per-vendor drill-down of a report
+type ReconciliationLine struct {
+	gorm.Model
+	ReportID           uint    `gorm:"not null;index"`
+	VendorID           uint    `gorm:"not null;index"`
+	LedgerBalance      int64   `gorm:"not null"`
+	UntransferredSales int64   `gorm:"not null"` // Confirmed transactions not yet part of a transfer
+	PendingTransfers   int64   `gorm:"not null"`
+	MissingCredits     int     `gorm:"not null"` // Confirmed transactions without a sale credit
+	MissingIncoming    int     `gorm:"not null"` // Payments the wallet does not know about
+	MissingOutgoing    int     `gorm:"not null"` // Completed transfers missing from the wallet history
+	Healthy            bool    `gorm:"not null"`
+	Details            *string `gorm:"type:text"` // JSON with the IDs and hashes behind the counts
+}
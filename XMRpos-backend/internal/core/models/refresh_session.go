@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshSession is one login of an account on a device. Its refresh token rotates on every use;
+// only the hash of the current token is kept, with the generation it was issued at, so a rotated
+// token that comes back is recognized and the whole session revoked.
+type RefreshSession struct {
+	gorm.Model
+	SessionID     string `gorm:"not null;uniqueIndex"`                                  // Public ID, the sid claim of the tokens
+	Role          string `gorm:"not null;index:idx_refresh_session_account,priority:1"` // "admin", "vendor" or "pos"
+	AccountID     uint   `gorm:"not null;index:idx_refresh_session_account,priority:2"` // Admin, vendor or POS ID
+	VendorID      *uint  `gorm:"index"`                                                 // Set for vendor and POS sessions
+	StaffID       *uint  `gorm:"index"`                                                 // Staff member logged in on the POS
+	DeviceID      *uint  `gorm:"index"`                                                 // Paired device the POS session runs on
+	Generation    uint32 `gorm:"not null;default:1"`
+	TokenHash     string `gorm:"not null;type:text"` // SHA-256 of the current refresh token
+	UserAgent     string `gorm:"type:text"`
+	RemoteAddr    string
+	LastUsedAt    time.Time
+	ExpiresAt     time.Time `gorm:"not null"`
+	RevokedAt     *time.Time
+	RevokedReason string // "logout", "revoked", "password" or "reuse"
+}
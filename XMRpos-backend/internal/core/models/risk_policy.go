@@ -0,0 +1,27 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Reasons a payment was flagged, stored comma separated on the transaction
+const (
+	RiskFlagDoubleSpend   = "double_spend_seen" // The network saw a conflicting transaction
+	RiskFlagUnlockTime    = "unlock_time"       // The payment is locked beyond the default 10 blocks
+	RiskFlagLowFee        = "low_fee"           // The fee is below the policy's minimum
+	RiskFlagZeroConfLimit = "zero_conf_limit"   // The amount is too high to accept without confirmations
+	RiskFlagReorg         = "reorg"             // A reorg dropped or moved a payment after it was seen in a block
+)
+
+// VendorRiskPolicy overrides the operator's default rules for accepting payments of one vendor
+type VendorRiskPolicy struct {
+	gorm.Model
+	VendorID          uint   `gorm:"not null;uniqueIndex"`
+	Vendor            Vendor `gorm:"foreignKey:VendorID"`
+	MinConfirmations  int64  `gorm:"not null;default:0"` // Floor on the confirmations a POS can ask for
+	MaxZeroConfAmount *int64 // Largest amount accepted without confirmations, nil for no limit
+	MinFee            int64  `gorm:"not null;default:0"` // Payments paying a lower fee need a confirmation
+	RejectDoubleSpend bool   `gorm:"not null"`           // Never accept a payment with a double spend seen before it is mined
+	RejectUnlockTime  bool   `gorm:"not null"`           // Never accept a payment with an unlock time before it unlocks
+	ConfirmedDepth    *int64 // Confirmations after which a payment is final, nil for the configured depth
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SigningKey is a key pair tokens are signed with. The most recently activated key signs, every
+// key that has not expired verifies and is published at /.well-known/jwks.json.
+type SigningKey struct {
+	gorm.Model
+	KID         string     `gorm:"not null;uniqueIndex"`
+	Algorithm   string     `gorm:"not null"`           // "EdDSA" or "ES256"
+	PrivateKey  string     `gorm:"not null;type:text"` // PKCS #8 PEM
+	ActivatedAt *time.Time // Signs from then on, only published while nil
+	RetiredAt   *time.Time // No longer signs
+	ExpiresAt   *time.Time // No longer verifies
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Staff is an employee of a vendor who logs in on one of its POS devices. Transactions created
+// while a staff member is logged in record who rang them up. Revoking a staff member soft deletes
+// the row, which ends its sessions without touching the device login.
+type Staff struct {
+	gorm.Model
+	VendorID        uint   `gorm:"not null;uniqueIndex:idx_staff_vendor_id_name,priority:1,where:deleted_at IS NULL"`
+	Vendor          Vendor `gorm:"foreignKey:VendorID" json:"-"`
+	Name            string `gorm:"not null;uniqueIndex:idx_staff_vendor_id_name,priority:2,where:deleted_at IS NULL"`
+	PasswordHash    string `gorm:"not null" json:"-"`
+	PasswordVersion uint32 `gorm:"not null;default:1" json:"-"`
+	Role            string `gorm:"not null;default:cashier"` // Built-in or custom vendor role the staff member acts with
+}
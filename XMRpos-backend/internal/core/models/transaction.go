@@ -10,17 +10,26 @@ type Transaction struct {
 	gorm.Model
 	VendorID              uint              `gorm:"not null;index"` // Foreign key field
 	Vendor                Vendor            `gorm:"foreignKey:VendorID"`
-	PosID                 uint              `gorm:"not null;index"` // Foreign key field
-	Pos                   Pos               `gorm:"foreignKey:PosID"`
+	PosID                 *uint             `gorm:"index"` // Foreign key field, nil for online checkouts
+	Pos                   *Pos              `gorm:"foreignKey:PosID"`
+	StaffID               *uint             `gorm:"index"` // Staff member logged in on the POS, nil for the device login
+	Staff                 *Staff            `gorm:"foreignKey:StaffID"`
 	Amount                int64             `gorm:"not null"`
 	RequiredConfirmations int64             `gorm:"not null"`
+	ConfirmedDepth        int64             `gorm:"not null;default:10"` // Confirmations after which the transaction was final when it was created
 	Currency              string            `gorm:"not null"`
 	AmountInCurrency      float64           `gorm:"not null"`
 	Description           *string           `gorm:"type:text"`
 	SubAddress            *string           `gorm:"type:text"`
+	PaymentBackend        string            `gorm:"not null;default:moneropay"` // Backend that created the subaddress and tracks its payments
+	AccountIndex          uint32            `gorm:"not null;default:0"`         // Wallet account of the subaddress
+	SubaddressIndex       *uint32           // Set when the subaddress was created by the wallet-RPC backend
+	CallbackSecretHash    *string           `gorm:"type:text" json:"-"` // SHA-256 of the secret in the MoneroPay callback URL
 	Accepted              bool              `gorm:"not null;default:false"`
 	Confirmed             bool              `gorm:"not null;default:false"`
+	RiskFlags             *string           `gorm:"type:text"` // Comma separated RiskFlag* reasons, nil when nothing was flagged
 	Transferred           bool              `gorm:"not null;default:false"`
+	Commission            *int64            // Commission charged on the transaction, set when it is confirmed
 	SubTransactions       []*SubTransaction `gorm:"foreignKey:TransactionID"`
 	TransferID            *uint             `gorm:"index"` // Foreign key, nullable if not all transactions are transferred
 	Transfer              *Transfer         `gorm:"foreignKey:TransferID"`
@@ -34,6 +43,7 @@ type SubTransaction struct {
 	DoubleSpendSeen bool      `gorm:"not null"`
 	Fee             int64     `gorm:"not null"`
 	Height          int64     `gorm:"not null"`
+	BlockHash       *string   // Hash of the block at Height when the payment was last seen there, nil while in the pool
 	Timestamp       time.Time `gorm:"not null"`
 	TxHash          string    `gorm:"not null"`
 	UnlockTime      int64     `gorm:"not null"`
@@ -1,17 +1,37 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+type TransferStatus string
+
+const (
+	TransferStatusPending      TransferStatus = "pending"      // Waiting to be picked up by the transfer completer
+	TransferStatusBroadcasting TransferStatus = "broadcasting" // Signed transaction persisted, relay not yet confirmed
+	TransferStatusCompleted    TransferStatus = "completed"    // Relayed and seen in the wallet history
+	TransferStatusNeedsReview  TransferStatus = "needs_review" // Could not be relayed or settled automatically, left to the operator
+)
+
 type Transfer struct {
 	gorm.Model
-	VendorID          uint           `gorm:"not null;index"` // Foreign key field
-	Vendor            Vendor         `gorm:"foreignKey:VendorID"`
-	Amount            int64          `gorm:"not null"`     // Amount to be transferred
-	AmountTransferred *int64         `gorm:"default:null"` // Amount that has been transferred (amount - fee)
-	Address           string         `gorm:"not null;type:text"`
-	TxHash            *string        `gorm:"type:text"`
-	Transactions      []*Transaction `gorm:"foreignKey:TransferID"`
-	Completed         bool           `gorm:"not null;default:false"` // Indicates if the transfer is completed
+	VendorID          uint                   `gorm:"not null;index"` // Foreign key field
+	Vendor            Vendor                 `gorm:"foreignKey:VendorID"`
+	Amount            int64                  `gorm:"not null"`           // Amount to be transferred
+	Commission        int64                  `gorm:"not null;default:0"` // Commission sent to the operator address in the same transaction
+	AmountTransferred *int64                 `gorm:"default:null"`       // Amount that has been transferred (amount - fee)
+	Address           string                 `gorm:"not null;type:text"` // First destination, kept for transfers predating destinations
+	AccountIndex      uint32                 `gorm:"not null;default:0"` // Wallet account the payout is sent from
+	TxHash            *string                `gorm:"type:text"`
+	Transactions      []*Transaction         `gorm:"foreignKey:TransferID"`
+	Destinations      []*TransferDestination `gorm:"foreignKey:TransferID"`
+	Completed         bool                   `gorm:"not null;default:false"` // Indicates if the transfer is completed
+	Status            TransferStatus         `gorm:"not null;default:pending;index"`
+	TxKey             *string                `gorm:"type:text"` // Secret tx key, kept so the payout can be proven
+	TxBlob            *string                `gorm:"type:text"` // Signed transaction hex
+	TxMetadata        *string                `gorm:"type:text"` // Wallet metadata used to relay the signed transaction
+	RelayAttempts     int                    `gorm:"not null;default:0"`
+	BroadcastAt       *time.Time             // When the signed transaction was persisted
 }
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type TransferDestination struct {
+	gorm.Model
+	TransferID        uint   `gorm:"not null;index"` // Foreign key field
+	Address           string `gorm:"not null;type:text"`
+	Amount            int64  `gorm:"not null"`
+	AmountTransferred *int64 `gorm:"default:null"`           // Amount that has been transferred (amount - fee share)
+	Commission        bool   `gorm:"not null;default:false"` // Operator commission, not part of the vendor payout
+}
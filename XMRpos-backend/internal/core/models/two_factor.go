@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TwoFactor holds the TOTP secret of an admin or vendor account. The secret is stored when
+// enrollment starts and only enforced once a first code confirmed it.
+type TwoFactor struct {
+	gorm.Model
+	Role        string `gorm:"not null;uniqueIndex:idx_two_factor_account,priority:1,where:deleted_at IS NULL"` // "admin" or "vendor"
+	AccountID   uint   `gorm:"not null;uniqueIndex:idx_two_factor_account,priority:2,where:deleted_at IS NULL"`
+	Secret      string `gorm:"not null" json:"-"` // Base32 TOTP secret
+	Enabled     bool   `gorm:"not null;default:false"`
+	LastCounter int64  `gorm:"not null;default:0" json:"-"` // Period of the last accepted code, so a code only works once
+}
+
+// RecoveryCode is a single use code replacing a TOTP code when the authenticator is lost
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Role      string `gorm:"not null;index:idx_recovery_code_account,priority:1"`
+	AccountID uint   `gorm:"not null;index:idx_recovery_code_account,priority:2"`
+	CodeHash  string `gorm:"not null;type:text"` // SHA-256 of the code
+	UsedAt    *time.Time
+}
@@ -4,14 +4,24 @@ import (
 	"gorm.io/gorm"
 )
 
+type VendorCustody string
+
+const (
+	VendorCustodyOperator VendorCustody = "operator" // Funds are received into the operator's wallet and paid out
+	VendorCustodySelf     VendorCustody = "self"     // Funds go straight to the vendor's wallet, watched with its view key
+)
+
 type Vendor struct {
 	gorm.Model
-	Name             string        `gorm:"not null;uniqueIndex:idx_vendor_name,where:deleted_at IS NULL"`
-	PasswordHash     string        `gorm:"not null"`
-	PasswordVersion  uint32        `gorm:"not null;default:1"`
-	MoneroSubaddress string        `gorm:"not null"`
-	Pos              []Pos         `gorm:"foreignKey:VendorID"` // One-to-many relationship with Pos
-	Balance          int64         `gorm:"not null;default:0"`
-	Transactions     []Transaction `gorm:"foreignKey:VendorID"` // One-to-many relationship with Transactions
-	/* WalletAddress   string        `gorm:"not null"` */ // TODO: this will be useful when MoneroPay has implemented mutiple wallets per instance
+	Name               string          `gorm:"not null;uniqueIndex:idx_vendor_name,where:deleted_at IS NULL"`
+	PasswordHash       string          `gorm:"not null"`
+	PasswordVersion    uint32          `gorm:"not null;default:1"`
+	MoneroSubaddress   string          `gorm:"not null"` // Address given at signup, payouts use PayoutAddresses
+	PayoutAddresses    []PayoutAddress `gorm:"foreignKey:VendorID"`
+	Pos                []Pos           `gorm:"foreignKey:VendorID"` // One-to-many relationship with Pos
+	Balance            int64           `gorm:"not null;default:0"`
+	Transactions       []Transaction   `gorm:"foreignKey:VendorID"` // One-to-many relationship with Transactions
+	Custody            VendorCustody   `gorm:"not null;type:text;default:operator"`
+	WalletAccountIndex *uint32         // Wallet account holding the vendor's funds, nil for vendors sharing account 0
+	WalletAddress      *string         `gorm:"type:text"` // Primary address of the vendor's wallet account, or of its own wallet with self custody
 }
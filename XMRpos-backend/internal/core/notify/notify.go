@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+// Notifier stores notifications for the admin and vendors and, when NOTIFY_WEBHOOK_URL is set,
+// forwards them to the webhook so alerts reach someone who is not watching the dashboard
+type Notifier struct {
+	db         *gorm.DB
+	webhookURL string
+	client     *http.Client
+}
+
+type webhookPayload struct {
+	Audience  models.NotificationAudience `json:"audience"`
+	VendorID  *uint                       `json:"vendor_id,omitempty"`
+	Subject   string                      `json:"subject"`
+	Message   string                      `json:"message"`
+	CreatedAt time.Time                   `json:"created_at"`
+}
+
+func NewNotifier(db *gorm.DB, cfg *config.Config) *Notifier {
+	return &Notifier{
+		db:         db,
+		webhookURL: cfg.NotifyWebhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *Notifier) NotifyAdmin(ctx context.Context, subject string, message string) {
+	n.notify(ctx, &models.Notification{
+		Audience: models.NotificationAudienceAdmin,
+		Subject:  subject,
+		Message:  message,
+	})
+}
+
+func (n *Notifier) NotifyVendor(ctx context.Context, vendorID uint, subject string, message string) {
+	n.notify(ctx, &models.Notification{
+		Audience: models.NotificationAudienceVendor,
+		VendorID: &vendorID,
+		Subject:  subject,
+		Message:  message,
+	})
+}
+
+// Notifications are best effort: failures are logged, never returned to the caller
+func (n *Notifier) notify(ctx context.Context, notification *models.Notification) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	log.Printf("Notification (%s): %s", notification.Audience, notification.Subject)
+
+	if err := n.db.WithContext(ctx).Create(notification).Error; err != nil {
+		log.Printf("Error storing notification: %v", err)
+	}
+
+	if n.webhookURL == "" {
+		return
+	}
+
+	payload := webhookPayload{
+		Audience:  notification.Audience,
+		VendorID:  notification.VendorID,
+		Subject:   notification.Subject,
+		Message:   notification.Message,
+		CreatedAt: notification.CreatedAt,
+	}
+	go n.postWebhook(payload)
+}
+
+func (n *Notifier) postWebhook(payload webhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding notification webhook: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error creating notification webhook request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		log.Printf("Error posting notification webhook: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("Notification webhook returned status %d", resp.StatusCode)
+	}
+}
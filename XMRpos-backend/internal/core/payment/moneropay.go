@@ -0,0 +1,131 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
+)
+
+// MoneroPayBackend lets MoneroPay create the subaddress and report payments through callbacks
+type MoneroPayBackend struct {
+	client *moneropay.MoneroPayAPIClient
+	config *config.Config
+}
+
+func NewMoneroPayBackend(client *moneropay.MoneroPayAPIClient, cfg *config.Config) *MoneroPayBackend {
+	return &MoneroPayBackend{client: client, config: cfg}
+}
+
+func (b *MoneroPayBackend) Name() string {
+	return BackendMoneroPay
+}
+
+func (b *MoneroPayBackend) CreateInvoice(ctx context.Context, req InvoiceRequest) (*Invoice, error) {
+	// MoneroPay always receives into account 0, which would mix the funds of segregated vendors
+	if req.AccountIndex != 0 {
+		return nil, fmt.Errorf("MoneroPay cannot receive into wallet account %d, use the walletrpc backend", req.AccountIndex)
+	}
+
+	// The callback URL carries a secret of this transaction only; just its hash is stored, so the
+	// database cannot be used to forge callbacks
+	secret, secretHash, err := NewCallbackSecret()
+	if err != nil {
+		return nil, err
+	}
+	accessToken := fmt.Sprintf("%d.%s", req.TransactionID, secret)
+
+	callbackURLTemplate := b.config.MoneroPayCallbackURL
+	var callbackUrl string
+	if strings.Contains(callbackURLTemplate, "{jwt}") {
+		callbackUrl = strings.Replace(callbackURLTemplate, "{jwt}", accessToken, 1)
+	} else {
+		callbackUrl = strings.TrimRight(callbackURLTemplate, "/") + "/receive/" + accessToken
+	}
+
+	// per-call timeout for external dependency
+	callCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	resp, err := b.client.PostReceive(callCtx, &moneropay.ReceiveRequest{
+		Amount:      req.Amount,
+		Description: req.Description,
+		CallbackUrl: callbackUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Invoice{Address: resp.Address, CallbackSecretHash: &secretHash}, nil
+}
+
+func (b *MoneroPayBackend) GetStatus(ctx context.Context, transaction *models.Transaction) (*Status, error) {
+	if transaction.SubAddress == nil {
+		return nil, fmt.Errorf("transaction %d has no subaddress", transaction.ID)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	defer cancel()
+	resp, err := b.client.GetReceiveAddress(callCtx, *transaction.SubAddress, &moneropay.GetReceiveAddressParams{})
+	if err != nil {
+		return nil, err
+	}
+	return StatusFromMoneroPay(resp), nil
+}
+
+func (b *MoneroPayBackend) Health(ctx context.Context) error {
+	health, err := b.client.GetHealth(ctx)
+	if err != nil {
+		return err
+	}
+	if health.Status != 200 {
+		return fmt.Errorf("MoneroPay reports status %d", health.Status)
+	}
+	return nil
+}
+
+// StatusFromMoneroPay converts a MoneroPay receive address response or callback
+func StatusFromMoneroPay(resp *moneropay.ReceiveAddressResponse) *Status {
+	status := &Status{
+		Expected: resp.Amount.Expected,
+		Received: resp.Amount.Covered.Total,
+		Unlocked: resp.Amount.Covered.Unlocked,
+		Payments: make([]Payment, 0, len(resp.Transactions)),
+	}
+	for _, tx := range resp.Transactions {
+		status.Payments = append(status.Payments, Payment{
+			Amount:          tx.Amount,
+			Confirmations:   tx.Confirmations,
+			DoubleSpendSeen: tx.DoubleSpendSeen,
+			Fee:             tx.Fee,
+			Height:          tx.Height,
+			Timestamp:       tx.Timestamp,
+			TxHash:          tx.TxHash,
+			UnlockTime:      tx.UnlockTime,
+			Locked:          tx.Locked,
+		})
+	}
+	return status
+}
+
+// NewCallbackSecret returns a random callback secret and the hash to store for it
+func NewCallbackSecret() (secret string, secretHash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(buf)
+	return secret, HashCallbackSecret(secret), nil
+}
+
+func HashCallbackSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
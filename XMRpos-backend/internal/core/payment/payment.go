@@ -0,0 +1,103 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+const (
+	BackendMoneroPay = "moneropay"
+	BackendWalletRPC = "walletrpc"
+	BackendViewOnly  = "viewonly" // Invoices of self-custody vendors, paid into the vendor's own wallet
+)
+
+// PaymentBackend creates the receive address of an invoice and reports what has been paid to it.
+// The backend that created an invoice keeps tracking it, so switching PAYMENT_BACKEND does
+// not strand transactions that are still open.
+type PaymentBackend interface {
+	Name() string
+	CreateInvoice(ctx context.Context, req InvoiceRequest) (*Invoice, error)
+	GetStatus(ctx context.Context, transaction *models.Transaction) (*Status, error)
+	Health(ctx context.Context) error
+}
+
+type InvoiceRequest struct {
+	TransactionID uint
+	VendorID      uint
+	AccountIndex  uint32 // Wallet account of the vendor the invoice is for
+	Amount        int64
+	Description   string
+}
+
+type Invoice struct {
+	Address         string
+	AccountIndex    uint32
+	SubaddressIndex *uint32 // Only known to backends that create the subaddress themselves
+
+	CallbackSecretHash *string // Hash of the secret in the callback URL, for backends that call back
+}
+
+// Status of an invoice's receive address
+type Status struct {
+	Expected int64
+	Received int64 // Everything received, including payments in the pool
+	Unlocked int64
+	Payments []Payment
+}
+
+type Payment struct {
+	Amount          int64
+	Confirmations   int64
+	DoubleSpendSeen bool
+	Fee             int64
+	Height          int64
+	Timestamp       time.Time
+	TxHash          string
+	UnlockTime      int64
+	Locked          bool
+}
+
+type Backends struct {
+	defaultBackend PaymentBackend
+	byName         map[string]PaymentBackend
+}
+
+// NewBackends registers the available backends; new invoices use the one named defaultName
+func NewBackends(defaultName string, backends ...PaymentBackend) (*Backends, error) {
+	registry := &Backends{byName: make(map[string]PaymentBackend, len(backends))}
+	for _, backend := range backends {
+		registry.byName[backend.Name()] = backend
+	}
+	defaultBackend, ok := registry.byName[defaultName]
+	if !ok {
+		return nil, fmt.Errorf("payment backend %q is not configured", defaultName)
+	}
+	registry.defaultBackend = defaultBackend
+	return registry, nil
+}
+
+func (b *Backends) Default() PaymentBackend {
+	return b.defaultBackend
+}
+
+// Get returns the backend registered under name
+func (b *Backends) Get(name string) (PaymentBackend, bool) {
+	backend, ok := b.byName[name]
+	return backend, ok
+}
+
+// For returns the backend tracking a transaction
+func (b *Backends) For(transaction *models.Transaction) (PaymentBackend, error) {
+	name := transaction.PaymentBackend
+	if name == "" {
+		name = BackendMoneroPay
+	}
+	backend, ok := b.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("payment backend %q is not configured", name)
+	}
+	return backend, nil
+}
@@ -0,0 +1,195 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/rpc"
+)
+
+// ViewOnlyBackend serves vendors who keep custody of their funds. Each such vendor has a
+// view-only wallet file in a separate monero-wallet-rpc instance; invoices are subaddresses
+// of the vendor's own wallet, so payments go straight to the vendor and the backend can only
+// watch them arrive. A wallet-rpc instance has one wallet open at a time, so every call opens
+// the vendor's wallet first and calls are serialized.
+//
+// Refreshing a wallet scans the blocks since it was last open, which makes it the slow part of a
+// status check. A vendor's wallet is refreshed once per block; checks at the same height only
+// switch wallets and read the transfers, the pool included, which needs no refresh.
+//
+// Invoices are subaddresses the backend creates in the view-only copy. The vendor's own wallet
+// only looks 200 subaddresses past the last one that received a payment, so after more than 200
+// unpaid invoices in a row the payments that follow do not show in it until the vendor raises
+// the lookahead (set subaddress-lookahead in monero-wallet-cli).
+type ViewOnlyBackend struct {
+	client         *rpc.Client
+	password       string
+	legacyPassword string // Password of wallet files created before they had their own
+	chainHeight    func(ctx context.Context) (uint64, error)
+	mu             sync.Mutex
+	current        string          // Wallet file currently open
+	refreshed      map[uint]uint64 // Chain height each vendor's wallet was last refreshed at
+	tracker        *WalletRPCBackend
+}
+
+// NewViewOnlyBackend manages the view-only wallets in client's wallet directory. Wallet files
+// that do not open with walletPassword are tried with legacyPassword and moved to
+// walletPassword. chainHeight tells when a wallet needs a refresh.
+func NewViewOnlyBackend(client *rpc.Client, walletPassword string, legacyPassword string, chainHeight func(ctx context.Context) (uint64, error)) *ViewOnlyBackend {
+	return &ViewOnlyBackend{
+		client:         client,
+		password:       walletPassword,
+		legacyPassword: legacyPassword,
+		chainHeight:    chainHeight,
+		refreshed:      make(map[uint]uint64),
+		tracker:        NewWalletRPCBackend(client),
+	}
+}
+
+// ChainHeight reads the height from the daemon, or from the wallet when no daemon is configured
+func ChainHeight(daemon *rpc.Client, wallet *rpc.Client) func(ctx context.Context) (uint64, error) {
+	return func(ctx context.Context) (uint64, error) {
+		if daemon != nil {
+			var result struct {
+				Count uint64 `json:"count"`
+			}
+			err := daemon.Call(ctx, "get_block_count", nil, &result)
+			return result.Count, err
+		}
+		var result struct {
+			Height uint64 `json:"height"`
+		}
+		err := wallet.Call(ctx, "get_height", nil, &result)
+		return result.Height, err
+	}
+}
+
+// ViewWalletFile is the wallet file holding the view-only wallet of a vendor
+func ViewWalletFile(vendorID uint) string {
+	return fmt.Sprintf("xmrpos-vendor-%d-view", vendorID)
+}
+
+func (b *ViewOnlyBackend) Name() string {
+	return BackendViewOnly
+}
+
+// CreateWallet restores a vendor's view-only wallet from its primary address and private view key
+func (b *ViewOnlyBackend) CreateWallet(ctx context.Context, vendorID uint, address string, viewKey string, restoreHeight uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	callCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	params := map[string]any{
+		"filename":         ViewWalletFile(vendorID),
+		"address":          address,
+		"viewkey":          viewKey,
+		"password":         b.password,
+		"restore_height":   restoreHeight,
+		"autosave_current": true,
+	}
+	var result struct {
+		Address string `json:"address"`
+	}
+	if err := b.client.Call(callCtx, "generate_from_keys", params, &result); err != nil {
+		b.current = ""
+		return err
+	}
+	// generate_from_keys leaves the new wallet open
+	b.current = ViewWalletFile(vendorID)
+	delete(b.refreshed, vendorID)
+	return nil
+}
+
+func (b *ViewOnlyBackend) CreateInvoice(ctx context.Context, req InvoiceRequest) (*Invoice, error) {
+	if req.VendorID == 0 {
+		return nil, fmt.Errorf("view-only invoices need a vendor")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.open(ctx, req.VendorID); err != nil {
+		return nil, err
+	}
+	// The vendor's wallet only has the accounts the vendor created, the invoices use account 0
+	req.AccountIndex = 0
+	return b.tracker.CreateInvoice(ctx, req)
+}
+
+func (b *ViewOnlyBackend) GetStatus(ctx context.Context, transaction *models.Transaction) (*Status, error) {
+	// Read outside the lock, so checks of other vendors do not wait for the daemon. Without a
+	// height every check refreshes.
+	heightCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	height, err := b.chainHeight(heightCtx)
+	cancel()
+	if err != nil {
+		height = 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.open(ctx, transaction.VendorID); err != nil {
+		return nil, err
+	}
+
+	// Only the open wallet is refreshed in the background, so catch up once per block
+	if height == 0 || b.refreshed[transaction.VendorID] < height {
+		callCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		err := b.client.Call(callCtx, "refresh", map[string]any{}, nil)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("refreshing view wallet: %w", err)
+		}
+		b.refreshed[transaction.VendorID] = height
+	}
+
+	return b.tracker.GetStatus(ctx, transaction)
+}
+
+func (b *ViewOnlyBackend) Health(ctx context.Context) error {
+	return b.tracker.Health(ctx)
+}
+
+// open switches the wallet-rpc instance to the vendor's wallet. Callers hold mu.
+func (b *ViewOnlyBackend) open(ctx context.Context, vendorID uint) error {
+	filename := ViewWalletFile(vendorID)
+	if b.current == filename {
+		return nil
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	params := map[string]any{"filename": filename, "password": b.password}
+	err := b.client.Call(callCtx, "open_wallet", params, nil)
+	if err != nil && b.legacyPassword != "" && b.legacyPassword != b.password {
+		err = b.openLegacy(callCtx, filename)
+	}
+	if err != nil {
+		b.current = ""
+		return fmt.Errorf("opening view wallet of vendor %d: %w", vendorID, err)
+	}
+	b.current = filename
+	return nil
+}
+
+// openLegacy opens a wallet file still encrypted with the legacy password and moves it to the
+// view wallet password. Callers hold mu.
+func (b *ViewOnlyBackend) openLegacy(ctx context.Context, filename string) error {
+	params := map[string]any{"filename": filename, "password": b.legacyPassword}
+	if err := b.client.Call(ctx, "open_wallet", params, nil); err != nil {
+		return err
+	}
+	params = map[string]any{"old_password": b.legacyPassword, "new_password": b.password}
+	if err := b.client.Call(ctx, "change_wallet_password", params, nil); err != nil {
+		log.Printf("Error moving view wallet %s to its own password: %v", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/rpc"
+)
+
+// WalletRPCBackend creates invoice subaddresses in monero-wallet-rpc directly and polls the
+// wallet for payments to them, so no MoneroPay instance is needed
+type WalletRPCBackend struct {
+	client *rpc.Client
+}
+
+type walletIncomingTransfer struct {
+	TxID            string `json:"txid"`
+	Amount          int64  `json:"amount"`
+	Confirmations   int64  `json:"confirmations"`
+	DoubleSpendSeen bool   `json:"double_spend_seen"`
+	Fee             int64  `json:"fee"`
+	Height          int64  `json:"height"`
+	Timestamp       int64  `json:"timestamp"`
+	UnlockTime      int64  `json:"unlock_time"`
+	Locked          bool   `json:"locked"`
+}
+
+func NewWalletRPCBackend(client *rpc.Client) *WalletRPCBackend {
+	return &WalletRPCBackend{client: client}
+}
+
+func (b *WalletRPCBackend) Name() string {
+	return BackendWalletRPC
+}
+
+func (b *WalletRPCBackend) CreateInvoice(ctx context.Context, req InvoiceRequest) (*Invoice, error) {
+	callCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var resp struct {
+		Address      string `json:"address"`
+		AddressIndex uint32 `json:"address_index"`
+	}
+	params := map[string]any{
+		"account_index": req.AccountIndex,
+		"label":         fmt.Sprintf("xmrpos transaction %d", req.TransactionID),
+	}
+	if err := b.client.Call(callCtx, "create_address", params, &resp); err != nil {
+		return nil, err
+	}
+
+	return &Invoice{Address: resp.Address, AccountIndex: req.AccountIndex, SubaddressIndex: &resp.AddressIndex}, nil
+}
+
+func (b *WalletRPCBackend) GetStatus(ctx context.Context, transaction *models.Transaction) (*Status, error) {
+	if transaction.SubaddressIndex == nil {
+		return nil, fmt.Errorf("transaction %d has no subaddress index", transaction.ID)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	defer cancel()
+
+	var resp struct {
+		In   []walletIncomingTransfer `json:"in"`
+		Pool []walletIncomingTransfer `json:"pool"`
+	}
+	params := map[string]any{
+		"in":              true,
+		"pool":            true,
+		"account_index":   transaction.AccountIndex,
+		"subaddr_indices": []uint32{*transaction.SubaddressIndex},
+	}
+	if err := b.client.Call(callCtx, "get_transfers", params, &resp); err != nil {
+		return nil, err
+	}
+
+	status := &Status{Expected: transaction.Amount}
+
+	// A transaction paying the subaddress through several outputs is reported once per output
+	byTxID := make(map[string]*Payment)
+	for _, transfer := range append(resp.In, resp.Pool...) {
+		status.Received += transfer.Amount
+		if !transfer.Locked && transfer.Confirmations > 0 {
+			status.Unlocked += transfer.Amount
+		}
+
+		if payment, ok := byTxID[transfer.TxID]; ok {
+			payment.Amount += transfer.Amount
+			continue
+		}
+		status.Payments = append(status.Payments, Payment{
+			Amount:          transfer.Amount,
+			Confirmations:   transfer.Confirmations,
+			DoubleSpendSeen: transfer.DoubleSpendSeen,
+			Fee:             transfer.Fee,
+			Height:          transfer.Height,
+			Timestamp:       time.Unix(transfer.Timestamp, 0),
+			TxHash:          transfer.TxID,
+			UnlockTime:      transfer.UnlockTime,
+			Locked:          transfer.Locked,
+		})
+		byTxID[transfer.TxID] = &status.Payments[len(status.Payments)-1]
+	}
+
+	return status, nil
+}
+
+func (b *WalletRPCBackend) Health(ctx context.Context) error {
+	callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var resp struct {
+		Version uint32 `json:"version"`
+	}
+	return b.client.Call(callCtx, "get_version", nil, &resp)
+}
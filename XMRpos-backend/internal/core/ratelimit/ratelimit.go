@@ -0,0 +1,270 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Limiter throttles route groups per client IP and slows down password guessing. Its state lives
+// in PostgreSQL so every instance behind a load balancer sees the same counters.
+type Limiter struct {
+	db               *gorm.DB
+	limits           map[string]config.RateLimit
+	accountThreshold int
+	ipThreshold      int
+	lockoutDuration  time.Duration
+}
+
+const (
+	// Failed logins answered without delay, each further one doubles the wait before the next try
+	freeAttempts = 3
+	maxDelay     = time.Minute
+
+	// Failures are forgotten after a day without any
+	failureMemory = 24 * time.Hour
+)
+
+// LockedError is returned while an account or IP has to wait before the next login attempt
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// RetryAfterSeconds is the value of the Retry-After header
+func (e *LockedError) RetryAfterSeconds() string {
+	return strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+func NewLimiter(db *gorm.DB, cfg *config.Config) *Limiter {
+	return &Limiter{
+		db:               db,
+		limits:           cfg.RateLimits,
+		accountThreshold: cfg.LoginLockoutThreshold,
+		ipThreshold:      cfg.LoginIPLockoutThreshold,
+		lockoutDuration:  cfg.LoginLockoutDuration,
+	}
+}
+
+// Middleware limits the requests each client IP makes to the routes of a group. Requests are let
+// through when the database cannot be reached, the routes fail on their own then.
+func (l *Limiter) Middleware(group string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := l.limits[group]
+			if limit.Requests == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			retryAfter, err := l.take(r.Context(), group+":"+ClientIP(r.RemoteAddr), limit)
+			if err != nil {
+				log.Printf("Error checking rate limit of %s: %v", group, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if retryAfter > 0 {
+				locked := &LockedError{RetryAfter: retryAfter}
+				w.Header().Set("Retry-After", locked.RetryAfterSeconds())
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// take counts a request in the bucket's fixed window and returns how long to wait when the
+// limit is exceeded
+func (l *Limiter) take(ctx context.Context, key string, limit config.RateLimit) (time.Duration, error) {
+	now := time.Now()
+	var count int64
+	var windowStart time.Time
+	err := l.db.WithContext(ctx).Raw(`
+		INSERT INTO rate_limit_buckets (bucket_key, count, window_start) VALUES (?, 1, ?)
+		ON CONFLICT (bucket_key) DO UPDATE SET
+			count = CASE WHEN rate_limit_buckets.window_start <= ? THEN 1 ELSE rate_limit_buckets.count + 1 END,
+			window_start = CASE WHEN rate_limit_buckets.window_start <= ? THEN EXCLUDED.window_start ELSE rate_limit_buckets.window_start END
+		RETURNING count, window_start`,
+		key, now, now.Add(-limit.Window), now.Add(-limit.Window),
+	).Row().Scan(&count, &windowStart)
+	if err != nil {
+		return 0, err
+	}
+	return windowRetryAfter(count, windowStart, limit, now), nil
+}
+
+// windowRetryAfter is how long a request that is the count-th of its window has to wait, zero
+// while the limit is not exceeded. The wait is at least a second as Retry-After has no finer
+// unit.
+func windowRetryAfter(count int64, windowStart time.Time, limit config.RateLimit, now time.Time) time.Duration {
+	if count <= limit.Requests {
+		return 0
+	}
+	return max(windowStart.Add(limit.Window).Sub(now), time.Second)
+}
+
+// CheckLogin refuses a login attempt while the account or the IP it comes from is locked. It is
+// checked before the password, a locked account cannot be logged into with the right one either.
+func (l *Limiter) CheckLogin(ctx context.Context, account string, addr string) error {
+	var failures []models.LoginFailure
+	if err := l.db.WithContext(ctx).
+		Where("failure_key IN ? AND locked_until > ?", []string{accountKey(account), ipKey(addr)}, time.Now()).
+		Find(&failures).Error; err != nil {
+		return err
+	}
+
+	if retryAfter := lockedFor(failures, time.Now()); retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// lockedFor is how long the longest of the locks still runs at now, zero once all expired
+func lockedFor(failures []models.LoginFailure, now time.Time) time.Duration {
+	var retryAfter time.Duration
+	for _, failure := range failures {
+		if failure.LockedUntil != nil {
+			retryAfter = max(retryAfter, failure.LockedUntil.Sub(now))
+		}
+	}
+	return retryAfter
+}
+
+// LoginFailed records a failed attempt for the account and the IP. It reports whether this
+// attempt locked the account, so its owner can be told once.
+func (l *Limiter) LoginFailed(ctx context.Context, account string, addr string) (accountLocked bool, err error) {
+	accountLocked, err = l.recordFailure(ctx, accountKey(account), l.accountThreshold)
+	if err != nil {
+		return false, err
+	}
+	ipLocked, err := l.recordFailure(ctx, ipKey(addr), l.ipThreshold)
+	if err != nil {
+		return accountLocked, err
+	}
+	if ipLocked {
+		log.Printf("Logins from %s locked after %d failed attempts", ClientIP(addr), l.ipThreshold)
+	}
+	return accountLocked, nil
+}
+
+// LoginSucceeded forgets the failures of the account. Those of the IP stay, logging into an own
+// account must not reset the count of an IP guessing others.
+func (l *Limiter) LoginSucceeded(ctx context.Context, account string) error {
+	return l.db.WithContext(ctx).Where("failure_key = ?", accountKey(account)).Delete(&models.LoginFailure{}).Error
+}
+
+func (l *Limiter) recordFailure(ctx context.Context, key string, threshold int) (lockedOut bool, err error) {
+	now := time.Now()
+	err = l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginFailure{FailureKey: key, LastFailureAt: now}).Error; err != nil {
+			return err
+		}
+		var failure models.LoginFailure
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("failure_key = ?", key).First(&failure).Error; err != nil {
+			return err
+		}
+
+		lockedOut = countFailure(&failure, now, threshold, l.lockoutDuration)
+		return tx.Save(&failure).Error
+	})
+	return lockedOut, err
+}
+
+// countFailure adds a failure at now and locks the key for the progressive delay, or for the
+// lockout once the threshold is reached. It reports whether this failure reached the threshold.
+func countFailure(failure *models.LoginFailure, now time.Time, threshold int, lockoutDuration time.Duration) (lockedOut bool) {
+	if now.Sub(failure.LastFailureAt) > failureMemory {
+		failure.Failures = 0
+	}
+	failure.Failures++
+	failure.LastFailureAt = now
+
+	switch {
+	case failure.Failures >= threshold:
+		// Locked again after every further failure, the owner is only told the first time
+		lockedUntil := now.Add(lockoutDuration)
+		failure.LockedUntil = &lockedUntil
+		return failure.Failures == threshold
+	case failure.Failures > freeAttempts:
+		lockedUntil := now.Add(progressiveDelay(failure.Failures))
+		failure.LockedUntil = &lockedUntil
+	}
+	return false
+}
+
+// progressiveDelay is 1 second after the first failure past the free attempts, doubling up to
+// maxDelay
+func progressiveDelay(failures int) time.Duration {
+	shift := failures - freeAttempts - 1
+	if shift >= 6 {
+		return maxDelay
+	}
+	return min(time.Second<<shift, maxDelay)
+}
+
+// StartCleanup removes expired buckets and forgotten failures
+func (l *Limiter) StartCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := l.cleanup(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					log.Printf("Error cleaning up rate limits: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (l *Limiter) cleanup(ctx context.Context) error {
+	var longest time.Duration
+	for _, limit := range l.limits {
+		longest = max(longest, limit.Window)
+	}
+	now := time.Now()
+	if err := l.db.WithContext(ctx).Where("window_start < ?", now.Add(-longest)).Delete(&models.RateLimitBucket{}).Error; err != nil {
+		return err
+	}
+	return l.db.WithContext(ctx).
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-failureMemory), now).
+		Delete(&models.LoginFailure{}).Error
+}
+
+// ClientIP drops the port of a remote address. Behind a reverse proxy listed in TRUSTED_PROXIES
+// the address is the client RealIP took from the forwarding headers, otherwise the peer's.
+func ClientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func accountKey(account string) string {
+	return "account:" + account
+}
+
+func ipKey(addr string) string {
+	return "ip:" + ClientIP(addr)
+}
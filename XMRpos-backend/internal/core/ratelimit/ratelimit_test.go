@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+var now = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestWindowRetryAfter(t *testing.T) {
+	limit := config.RateLimit{Requests: 10, Window: time.Minute}
+	tests := []struct {
+		name        string
+		count       int64
+		windowStart time.Time
+		want        time.Duration
+	}{
+		{"first request", 1, now, 0},
+		{"at the limit", 10, now.Add(-30 * time.Second), 0},
+		{"over the limit", 11, now.Add(-30 * time.Second), 30 * time.Second},
+		{"window just started", 11, now, time.Minute},
+		{"window about to end", 11, now.Add(-59*time.Second - 500*time.Millisecond), time.Second},
+		{"window already ended", 11, now.Add(-2 * time.Minute), time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := windowRetryAfter(tt.count, tt.windowStart, limit, now); got != tt.want {
+				t.Errorf("windowRetryAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountFailure(t *testing.T) {
+	const threshold = 10
+	lockout := 15 * time.Minute
+	failure := &models.LoginFailure{LastFailureAt: now}
+
+	// The free attempts lock nothing, then the delay doubles from a second until the threshold
+	wantDelays := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second}
+	for i, want := range wantDelays {
+		if lockedOut := countFailure(failure, now, threshold, lockout); lockedOut {
+			t.Fatalf("failure %d locked the account out", i+1)
+		}
+		var got time.Duration
+		if failure.LockedUntil != nil {
+			got = failure.LockedUntil.Sub(now)
+		}
+		if got != want {
+			t.Errorf("failure %d: delay = %s, want %s", i+1, got, want)
+		}
+	}
+
+	if lockedOut := countFailure(failure, now, threshold, lockout); !lockedOut {
+		t.Error("the threshold failure did not report the lockout")
+	}
+	if got := failure.LockedUntil.Sub(now); got != lockout {
+		t.Errorf("lockout = %s, want %s", got, lockout)
+	}
+
+	// Further failures extend the lockout without reporting it again
+	later := now.Add(time.Minute)
+	if lockedOut := countFailure(failure, later, threshold, lockout); lockedOut {
+		t.Error("a failure past the threshold reported the lockout again")
+	}
+	if got := failure.LockedUntil.Sub(later); got != lockout {
+		t.Errorf("extended lockout = %s, want %s", got, lockout)
+	}
+
+	// A day without failures forgets them
+	forgotten := later.Add(failureMemory + time.Second)
+	countFailure(failure, forgotten, threshold, lockout)
+	if failure.Failures != 1 {
+		t.Errorf("Failures = %d after the failure memory, want 1", failure.Failures)
+	}
+	if failure.LockedUntil.After(forgotten) {
+		t.Errorf("still locked until %s after the failure memory", failure.LockedUntil)
+	}
+}
+
+func TestProgressiveDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{freeAttempts + 1, time.Second},
+		{freeAttempts + 2, 2 * time.Second},
+		{freeAttempts + 6, 32 * time.Second},
+		{freeAttempts + 7, maxDelay},
+		{freeAttempts + 100, maxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := progressiveDelay(tt.failures); got != tt.want {
+			t.Errorf("progressiveDelay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLockedFor(t *testing.T) {
+	at := func(d time.Duration) *time.Time {
+		lockedUntil := now.Add(d)
+		return &lockedUntil
+	}
+	tests := []struct {
+		name     string
+		failures []models.LoginFailure
+		want     time.Duration
+	}{
+		{"none", nil, 0},
+		{"not locked", []models.LoginFailure{{Failures: 2}}, 0},
+		{"locked", []models.LoginFailure{{LockedUntil: at(90 * time.Second)}}, 90 * time.Second},
+		{"expired", []models.LoginFailure{{LockedUntil: at(-time.Second)}}, 0},
+		{"expires now", []models.LoginFailure{{LockedUntil: at(0)}}, 0},
+		{"account and ip, longest wins", []models.LoginFailure{{LockedUntil: at(time.Minute)}, {LockedUntil: at(15 * time.Minute)}}, 15 * time.Minute},
+		{"one expired", []models.LoginFailure{{LockedUntil: at(-time.Minute)}, {LockedUntil: at(time.Second)}}, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lockedFor(tt.failures, now); got != tt.want {
+				t.Errorf("lockedFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		want       string
+	}{
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Millisecond, "1"},
+		{15 * time.Minute, "900"},
+	}
+
+	for _, tt := range tests {
+		locked := &LockedError{RetryAfter: tt.retryAfter}
+		if got := locked.RetryAfterSeconds(); got != tt.want {
+			t.Errorf("RetryAfterSeconds(%s) = %s, want %s", tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"203.0.113.7:51234", "203.0.113.7"},
+		{"203.0.113.7", "203.0.113.7"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ClientIP(tt.addr); got != tt.want {
+			t.Errorf("ClientIP(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/ratelimit"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/auth"
+)
+
+// apiKeyFromRequest returns the API key sent in X-API-Key or as the bearer token, if any
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); strings.HasPrefix(token, models.APIKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// authenticateAPIKey checks an API key and returns the claims it acts with: its vendor, and only
+// the scopes it was given as permissions
+func authenticateAPIKey(ctx context.Context, repo auth.AuthRepository, key string, remoteAddr string) (*models.Claims, []models.Permission, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(key, models.APIKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, models.APIKeyPrefix) {
+		return nil, nil, errors.New("invalid API key")
+	}
+
+	apiKey, err := repo.FindAPIKeyByPrefix(ctx, models.APIKeyPrefix+id)
+	if err != nil || subtle.ConstantTimeCompare([]byte(models.HashAPIKeySecret(secret)), []byte(apiKey.SecretHash)) != 1 {
+		return nil, nil, errors.New("invalid API key")
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, nil, errors.New("API key was revoked")
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, nil, errors.New("API key expired")
+	}
+	if _, err := repo.FindVendorByID(ctx, apiKey.VendorID); err != nil {
+		return nil, nil, errors.New("vendor not found")
+	}
+
+	var permissions []models.Permission
+	for _, scope := range strings.Split(apiKey.Scopes, ",") {
+		// Only API key scopes count, whatever ended up in the database
+		if models.IsAPIKeyScope(models.Permission(scope)) {
+			permissions = append(permissions, models.Permission(scope))
+		}
+	}
+
+	if err := repo.TouchAPIKey(ctx, apiKey.ID, ratelimit.ClientIP(remoteAddr)); err != nil {
+		log.Printf("Error updating last use of API key %s: %v", apiKey.Prefix, err)
+	}
+
+	claims := &models.Claims{VendorID: &apiKey.VendorID, Role: "api_key", APIKeyID: &apiKey.ID}
+	return claims, permissions, nil
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+// AuditRecorder stores admin audit entries
+type AuditRecorder interface {
+	CreateAuditLog(ctx context.Context, entry *models.AdminAuditLog) error
+}
+
+// maxAuditBody caps how much of a request body is kept in the audit log
+const maxAuditBody = 4 << 10
+
+// redactedFields are the body fields never written to the audit log. A field is left out when
+// its name contains one of them.
+var redactedFields = []string{"password", "secret", "token", "code", "key"}
+
+// AuditAdmin records every request by an admin that can change something, with the response
+// status and the request body, so the entry shows which vendor, transfer or admin was acted
+// on. Passwords, secrets and codes are redacted from the body. It must run after
+// AuthMiddleware.
+func AuditAdmin(recorder AuditRecorder) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			adminID, _ := r.Context().Value(models.ClaimsAdminIDKey).(*uint)
+			if adminID == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Read the start of the body and hand the handler all of it
+			head, _ := io.ReadAll(io.LimitReader(r.Body, maxAuditBody+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			entry := &models.AdminAuditLog{
+				AdminID:    *adminID,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     status,
+				RemoteAddr: r.RemoteAddr,
+				Body:       redactBody(head),
+			}
+			// The request context may already be cancelled by the handler's timeout
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+			defer cancel()
+			if err := recorder.CreateAuditLog(ctx, entry); err != nil {
+				log.Printf("Admin audit: error recording %s %s by admin %d: %v", r.Method, r.URL.Path, *adminID, err)
+			}
+		})
+	}
+}
+
+// redactBody returns the JSON body with the redacted fields replaced. A body that is not JSON,
+// or is longer than maxAuditBody, is not stored.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > maxAuditBody {
+		return "[body too large]"
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "[body not JSON]"
+	}
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return ""
+	}
+	return string(redacted)
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for field, inner := range v {
+			if isRedactedField(field) {
+				v[field] = "[redacted]"
+				continue
+			}
+			v[field] = redactValue(inner)
+		}
+	case []any:
+		for i, inner := range v {
+			v[i] = redactValue(inner)
+		}
+	}
+	return value
+}
+
+func isRedactedField(field string) bool {
+	field = strings.ToLower(field)
+	for _, name := range redactedFields {
+		if strings.Contains(field, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", "", ""},
+		{"ids kept", `{"vendor_id":7,"amount":100}`, `{"amount":100,"vendor_id":7}`},
+		{"password", `{"name":"ops","password":"hunter2"}`, `{"name":"ops","password":"[redacted]"}`},
+		{"nested", `{"admin":{"new_password":"x","id":3}}`, `{"admin":{"id":3,"new_password":"[redacted]"}}`},
+		{"codes and tokens", `{"invite_code":"abc","refresh_token":"def","API_KEY":"ghi"}`, `{"API_KEY":"[redacted]","invite_code":"[redacted]","refresh_token":"[redacted]"}`},
+		{"array", `[{"device_secret":"s","pos_id":1}]`, `[{"device_secret":"[redacted]","pos_id":1}]`},
+		{"not json", "vendor_id=7", "[body not JSON]"},
+		{"too large", `{"memo":"` + strings.Repeat("a", maxAuditBody) + `"}`, "[body too large]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactBody([]byte(tt.body)); got != tt.want {
+				t.Errorf("redactBody() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,32 +3,45 @@ package middleware
 import (
 	"context"
 	"reflect"
-	"errors"
 	"net/http"
 	"time"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/signing"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/auth"
 )
 
 type contextKey string
 
-func AuthMiddleware(cfg *config.Config, repo auth.AuthRepository) func(next http.Handler) http.Handler {
+func AuthMiddleware(cfg *config.Config, keyring *signing.Keyring, repo auth.AuthRepository) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authCtx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			defer cancel()
+			r = r.WithContext(authCtx)
+
+			// Integrations authenticate with an API key instead of a token
+			if apiKey := apiKeyFromRequest(r); apiKey != "" {
+				claims, permissions, err := authenticateAPIKey(authCtx, repo, apiKey, r.RemoteAddr)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				claimsCtx := AddClaimsToContext(r.Context(), claims)
+				claimsCtx = utils.WithPermissions(claimsCtx, permissions)
+				next.ServeHTTP(w, r.WithContext(claimsCtx))
+				return
+			}
+
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
 				http.Error(w, "Authorization header missing", http.StatusUnauthorized)
 				return
 			}
 
-			authCtx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-			defer cancel()
-			r = r.WithContext(authCtx)
-
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 			if tokenString == authHeader {
 				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
@@ -36,12 +49,7 @@ func AuthMiddleware(cfg *config.Config, repo auth.AuthRepository) func(next http
 			}
 
 			claims := &models.Claims{}
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, errors.New("invalid signing method")
-				}
-				return []byte(cfg.JWTSecret), nil
-			})
+			token, err := keyring.Parse(signing.Access, tokenString, claims)
 
 			if err != nil {
 				http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
@@ -53,8 +61,36 @@ func AuthMiddleware(cfg *config.Config, repo auth.AuthRepository) func(next http
 				return
 			}
 
-			// Password version check
+			// Password version check, and the permissions of the caller
+			var permissions []models.Permission
 			switch claims.Role {
+			case "admin":
+				if claims.AdminID == nil {
+					http.Error(w, "Missing admin_id", http.StatusUnauthorized)
+					return
+				}
+				admin, err := repo.FindAdminByID(authCtx, *claims.AdminID)
+				if err != nil {
+					http.Error(w, "Admin not found", http.StatusUnauthorized)
+					return
+				}
+				if admin.PasswordVersion != claims.PasswordVersion {
+					http.Error(w, "Token is outdated (password changed)", http.StatusUnauthorized)
+					return
+				}
+				permissions = models.RolePermissions[models.RoleAdmin]
+				// Until the admin enabled 2FA only the routes without a permission are open,
+				// which include the 2FA setup
+				if cfg.AdminRequire2FA {
+					enabled, err := repo.TwoFactorEnabled(authCtx, "admin", admin.ID)
+					if err != nil {
+						http.Error(w, "Error checking two-factor authentication", http.StatusInternalServerError)
+						return
+					}
+					if !enabled {
+						permissions = nil
+					}
+				}
 			case "vendor":
 				if claims.VendorID == nil {
 					http.Error(w, "Missing vendor_id", http.StatusUnauthorized)
@@ -69,6 +105,7 @@ func AuthMiddleware(cfg *config.Config, repo auth.AuthRepository) func(next http
 					http.Error(w, "Token is outdated (password changed)", http.StatusUnauthorized)
 					return
 				}
+				permissions = models.RolePermissions[models.RoleVendor]
 			case "pos":
 				if claims.PosID == nil {
 					http.Error(w, "Missing pos_id", http.StatusUnauthorized)
@@ -83,9 +120,46 @@ func AuthMiddleware(cfg *config.Config, repo auth.AuthRepository) func(next http
 					http.Error(w, "Token is outdated (password changed)", http.StatusUnauthorized)
 					return
 				}
+				// A staff member logged in on the POS acts with their own role
+				role := pos.Role
+				if claims.StaffID != nil {
+					staff, err := repo.FindStaffByID(authCtx, *claims.StaffID)
+					if err != nil || staff.VendorID != pos.VendorID {
+						http.Error(w, "Staff not found", http.StatusUnauthorized)
+						return
+					}
+					if staff.PasswordVersion != claims.StaffVersion {
+						http.Error(w, "Token is outdated (password changed)", http.StatusUnauthorized)
+						return
+					}
+					role = staff.Role
+				}
+				permissions, err = resolvePermissions(authCtx, repo, pos.VendorID, role)
+				if err != nil {
+					http.Error(w, "POS role not found", http.StatusUnauthorized)
+					return
+				}
+			default:
+				// Pre-auth tokens and anything else signed with the secret
+				http.Error(w, "Invalid role in token", http.StatusUnauthorized)
+				return
+			}
+
+			// Revoked sessions end right away, not when their access tokens expire
+			if claims.SessionID != "" {
+				active, err := repo.SessionActive(authCtx, claims.SessionID)
+				if err != nil {
+					http.Error(w, "Error checking session", http.StatusInternalServerError)
+					return
+				}
+				if !active {
+					http.Error(w, "Session expired or revoked", http.StatusUnauthorized)
+					return
+				}
 			}
 
 			claimsCtx := AddClaimsToContext(r.Context(), claims)
+			claimsCtx = utils.WithPermissions(claimsCtx, permissions)
 			next.ServeHTTP(w, r.WithContext(claimsCtx))
 		})
 	}
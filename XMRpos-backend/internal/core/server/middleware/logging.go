@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+)
+
+// Paths whose last segment is a secret and must not end up in the logs
+var redactedPathPrefixes = []string{"/callback/receive/", "/receive/"}
+
+// PeerAddr keeps the address of the connection's peer, it must run before RealIP
+func PeerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(utils.WithPeerAddr(r.Context(), r.RemoteAddr)))
+	})
+}
+
+// Logger is chi's request logger with the callback tokens cut from the logged URLs
+var Logger = middleware.RequestLogger(&redactingLogFormatter{
+	LogFormatter: &middleware.DefaultLogFormatter{Logger: log.New(os.Stdout, "", log.LstdFlags)},
+})
+
+type redactingLogFormatter struct {
+	middleware.LogFormatter
+}
+
+func (f *redactingLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	for _, prefix := range redactedPathPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			redacted := *r
+			redacted.RequestURI = prefix + "[redacted]"
+			return f.LogFormatter.NewLogEntry(&redacted)
+		}
+	}
+	return f.LogFormatter.NewLogEntry(r)
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/auth"
+)
+
+// RequirePermission only lets callers through whose role grants the permission. It must run
+// after AuthMiddleware, which resolves the permissions.
+func RequirePermission(permission models.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !utils.HasPermission(r.Context(), permission) {
+				http.Error(w, "Forbidden: missing permission "+string(permission), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// resolvePermissions looks up the permissions of the vendor role a POS acts with: manager,
+// cashier or one of the vendor's custom roles
+func resolvePermissions(ctx context.Context, repo auth.AuthRepository, vendorID uint, role string) ([]models.Permission, error) {
+	if role == models.RoleManager || role == models.RoleCashier {
+		return models.RolePermissions[role], nil
+	}
+
+	vendorRole, err := repo.FindVendorRole(ctx, vendorID, role)
+	if err != nil {
+		return nil, err
+	}
+	var permissions []models.Permission
+	for _, p := range strings.Split(vendorRole.Permissions, ",") {
+		// Only vendor permissions count, whatever ended up in the database
+		if permission := models.Permission(p); models.IsVendorPermission(permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions, nil
+}
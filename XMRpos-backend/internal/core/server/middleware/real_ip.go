@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RealIP replaces RemoteAddr with the client address forwarded by a trusted reverse proxy.
+// Requests from any other peer keep the address of the connection, so a client cannot pick
+// the address its rate limits and lockouts are counted on.
+func RealIP(trusted []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if client := forwardedClient(r.RemoteAddr, r.Header, trusted); client != "" {
+				r.RemoteAddr = client
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClient returns the client named by the forwarding headers when the peer is a trusted
+// proxy. X-Forwarded-For is read from the right, where the proxies append, and the first address
+// that is not a trusted proxy is the client; X-Real-IP is used when the proxy only sets that.
+func forwardedClient(peer string, header http.Header, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(peer)
+	if err != nil {
+		host = peer
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !isTrusted(addr, trusted) {
+		return ""
+	}
+
+	if forwarded := header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		entries := strings.Split(strings.Join(forwarded, ","), ",")
+		client := ""
+		for i := len(entries) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(entries[i]))
+			if err != nil {
+				break
+			}
+			client = addr.Unmap().String()
+			if !isTrusted(addr, trusted) {
+				break
+			}
+		}
+		if client != "" {
+			return client
+		}
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return ""
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestForwardedClient(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32")}
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"untrusted peer", "203.0.113.7:5000", "198.51.100.1", "198.51.100.2", ""},
+		{"trusted peer", "10.0.0.2:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed entry before the client", "10.0.0.2:5000", "1.2.3.4, 198.51.100.1", "", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:5000", "1.2.3.4, 198.51.100.1, 192.0.2.1, 10.0.0.3", "", "198.51.100.1"},
+		{"only trusted proxies", "10.0.0.2:5000", "10.0.0.4, 10.0.0.3", "", "10.0.0.4"},
+		{"garbage before the client", "10.0.0.2:5000", "not an ip, 198.51.100.1", "", "198.51.100.1"},
+		{"garbage at the end", "10.0.0.2:5000", "198.51.100.1, not an ip", "198.51.100.2", "198.51.100.2"},
+		{"x-real-ip", "10.0.0.2:5000", "", "198.51.100.2", "198.51.100.2"},
+		{"ipv6 client", "[::ffff:10.0.0.2]:5000", "2001:db8::1", "", "2001:db8::1"},
+		{"peer without port", "10.0.0.2", "198.51.100.1", "", "198.51.100.1"},
+		{"nothing forwarded", "10.0.0.2:5000", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.forwarded != "" {
+				header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := forwardedClient(tt.peer, header, trusted); got != tt.want {
+				t.Errorf("forwardedClient() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	header := http.Header{"X-Forwarded-For": {"198.51.100.1"}}
+	if got := forwardedClient("10.0.0.2:5000", header, nil); got != "" {
+		t.Errorf("forwardedClient() without trusted proxies = %q, want none", got)
+	}
+}
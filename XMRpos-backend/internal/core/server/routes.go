@@ -2,18 +2,28 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/notify"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/payment"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/ratelimit"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/rpc"
 	localMiddleware "github.com/monerokon/xmrpos/xmrpos-backend/internal/core/server/middleware"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/signing"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/admin"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/auth"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/callback"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/checkout"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/ledger"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/misc"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/pos"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/reconciliation"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/risk"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/vendor"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
 
@@ -21,20 +31,18 @@ import (
 )
 
 // Accept a context tied to server lifecycle to stop background loops on shutdown
-func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *rpc.Client, moneroPayClient *moneropay.MoneroPayAPIClient) *chi.Mux {
+func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *rpc.Client, daemonRPC *rpc.Client, moneroPayClient *moneropay.MoneroPayAPIClient) (*chi.Mux, error) {
 	r := chi.NewRouter()
 
 	// Middleware
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(localMiddleware.PeerAddr)
+	r.Use(localMiddleware.RealIP(cfg.TrustedProxies))
+	r.Use(localMiddleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	if moneroPayClient == nil {
-		moneroPayClient = moneropay.NewMoneroPayAPIClient()
-		if cfg.MoneroPayBaseURL != "" {
-			moneroPayClient.BaseURL = cfg.MoneroPayBaseURL
-		}
+	if moneroPayClient == nil && cfg.MoneroPayBaseURL != "" {
+		moneroPayClient = &moneropay.MoneroPayAPIClient{BaseURL: cfg.MoneroPayBaseURL}
 	}
 
 	if rpcClient == nil {
@@ -45,6 +53,26 @@ func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *
 		)
 	}
 
+	// Payment backends; transactions keep using the backend that created them
+	paymentBackends := []payment.PaymentBackend{payment.NewWalletRPCBackend(rpcClient)}
+	if moneroPayClient != nil {
+		paymentBackends = append(paymentBackends, payment.NewMoneroPayBackend(moneroPayClient, cfg))
+	}
+	var viewWallets *payment.ViewOnlyBackend
+	if cfg.MoneroViewWalletRPCEndpoint != "" {
+		viewWallets = payment.NewViewOnlyBackend(
+			rpc.NewClient(cfg.MoneroViewWalletRPCEndpoint, cfg.MoneroViewWalletRPCUsername, cfg.MoneroViewWalletRPCPassword),
+			cfg.ViewWalletPassword,
+			cfg.WalletPassword, // View wallets created before VIEW_WALLET_PASSWORD move over on first open
+			payment.ChainHeight(daemonRPC, rpcClient),
+		)
+		paymentBackends = append(paymentBackends, viewWallets)
+	}
+	payments, err := payment.NewBackends(cfg.PaymentBackend, paymentBackends...)
+	if err != nil {
+		return nil, fmt.Errorf("payment backends: %w", err)
+	}
+
 	// Initialize repositories
 	adminRepository := admin.NewAdminRepository(db)
 	authRepository := auth.NewAuthRepository(db)
@@ -52,16 +80,38 @@ func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *
 	posRepository := pos.NewPosRepository(db)
 	callbackRepository := callback.NewCallbackRepository(db)
 	miscRepository := misc.NewMiscRepository(db)
+	ledgerRepository := ledger.NewLedgerRepository(db)
+	reconciliationRepository := reconciliation.NewReconciliationRepository(db)
+	riskRepository := risk.NewRiskRepository(db)
+	checkoutRepository := checkout.NewCheckoutRepository(db)
+
+	notifier := notify.NewNotifier(db, cfg)
+	limiter := ratelimit.NewLimiter(db, cfg)
+	limiter.StartCleanup(ctx, time.Hour)
+	keyring, err := signing.NewKeyring(ctx, db, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	keyring.StartReloader(ctx, time.Minute)
 
 	// Initialize services
-	vendorService := vendor.NewVendorService(vendorRepository, db, cfg, rpcClient, moneroPayClient)
+	ledgerService := ledger.NewLedgerService(ledgerRepository, db, cfg)
+	riskService := risk.NewRiskService(riskRepository, cfg)
+	vendorService := vendor.NewVendorService(vendorRepository, db, cfg, rpcClient, moneroPayClient, ledgerService, viewWallets, notifier)
 	vendorService.StartTransferCompleter(ctx, 30*time.Second) // Check every 30 seconds
+	vendorService.StartWalletAccountBackfill(ctx, time.Hour)
 	adminService := admin.NewAdminService(adminRepository, cfg, vendorService)
-	authService := auth.NewAuthService(authRepository, cfg)
-	posService := pos.NewPosService(posRepository, cfg, moneroPayClient)
-	callbackService := callback.NewCallbackService(callbackRepository, cfg, moneroPayClient)
-	callbackService.StartConfirmationChecker(ctx, 2*time.Second) // Check for confirmations every 2 seconds
-	miscService := misc.NewMiscService(miscRepository, cfg, moneroPayClient)
+	authService := auth.NewAuthService(authRepository, cfg, keyring, limiter, notifier)
+	posService := pos.NewPosService(posRepository, cfg, payments, riskService)
+	checkoutService := checkout.NewCheckoutService(checkoutRepository, cfg, posService, notifier)
+	checkoutService.StartCheckoutSweeper(ctx, time.Minute)
+	checkoutService.StartWebhookSender(ctx, 15*time.Second) // Retries are due at 30 seconds at the earliest
+	callbackService := callback.NewCallbackService(callbackRepository, cfg, payments, ledgerService, riskService, notifier, checkoutService, rpcClient, daemonRPC)
+	callbackService.StartConfirmationChecker(ctx, cfg.ConfirmationPollInterval, cfg.ConfirmationWorkers)
+	callbackService.StartCallbackInbox(ctx, 5*time.Second) // Retries are due at 5 seconds at the earliest
+	miscService := misc.NewMiscService(miscRepository, cfg, moneroPayClient, payments)
+	reconciliationService := reconciliation.NewReconciliationService(reconciliationRepository, cfg, rpcClient, notifier)
+	reconciliationService.StartReconciler(ctx, cfg.ReconciliationInterval)
 
 	// Initialize handlers
 	adminHandler := admin.NewAdminHandler(adminService, vendorService)
@@ -70,21 +120,32 @@ func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *
 	posHandler := pos.NewPosHandler(posService)
 	callbackHandler := callback.NewCallbackHandler(callbackService)
 	miscHandler := misc.NewMiscHandler(miscService)
+	ledgerHandler := ledger.NewLedgerHandler(ledgerService)
+	reconciliationHandler := reconciliation.NewReconciliationHandler(reconciliationService)
+	riskHandler := risk.NewRiskHandler(riskService)
+	checkoutHandler := checkout.NewCheckoutHandler(checkoutService)
 
 	// Public routes
 	r.Group(func(r chi.Router) {
 		// Auth routes
-		r.Post("/auth/login-admin", authHandler.LoginAdmin)
-		r.Post("/auth/login-vendor", authHandler.LoginVendor)
-		r.Post("/auth/login-pos", authHandler.LoginPos)
+		r.With(limiter.Middleware("login")).Post("/auth/login-admin", authHandler.LoginAdmin)
+		r.With(limiter.Middleware("login")).Post("/auth/login-vendor", authHandler.LoginVendor)
+		r.With(limiter.Middleware("login")).Post("/auth/login-pos", authHandler.LoginPos)
+		r.With(limiter.Middleware("login")).Post("/auth/login-2fa", authHandler.LoginTwoFactor)
+		r.With(limiter.Middleware("login")).Post("/auth/pair", authHandler.PairDevice)
+		r.With(limiter.Middleware("login")).Post("/auth/login-device", authHandler.LoginDevice)
 		r.Post("/auth/refresh", authHandler.RefreshToken)
+		r.Get("/.well-known/jwks.json", authHandler.JWKS)
 
 		// Vendor routes
-		r.Post("/vendor/create", vendorHandler.CreateVendor)
+		r.With(limiter.Middleware("signup")).Post("/vendor/create", vendorHandler.CreateVendor)
 
 		// Callback routes
-		r.Post("/callback/receive/{jwt}", callbackHandler.ReceiveTransaction)
-		r.Post("/receive/{jwt}", callbackHandler.ReceiveTransaction)
+		r.With(limiter.Middleware("callback")).Post("/callback/receive/{token}", callbackHandler.ReceiveTransaction)
+		r.With(limiter.Middleware("callback")).Post("/receive/{token}", callbackHandler.ReceiveTransaction)
+
+		// Hosted payment pages of online checkouts
+		r.Get("/pay/{publicID}", checkoutHandler.PaymentPage)
 
 		// Miscellaneous routes
 		r.Get("/misc/health", miscHandler.GetHealth)
@@ -92,30 +153,92 @@ func NewRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rpcClient *
 
 	// Protected routes
 	r.Group(func(r chi.Router) {
-		r.Use(localMiddleware.AuthMiddleware(cfg, authRepository))
+		r.Use(localMiddleware.AuthMiddleware(cfg, keyring, authRepository))
+		r.Use(localMiddleware.AuditAdmin(adminRepository))
 
-		// Auth routes
+		// Auth routes, open to every role
 		r.Post("/auth/update-password", authHandler.UpdatePassword)
+		r.With(limiter.Middleware("login")).Post("/auth/login-staff", authHandler.LoginStaff)
+		r.Get("/auth/2fa", authHandler.GetTwoFactorStatus)
+		r.Post("/auth/2fa/setup", authHandler.SetupTwoFactor)
+		r.Post("/auth/2fa/enable", authHandler.EnableTwoFactor)
+		r.Post("/auth/2fa/disable", authHandler.DisableTwoFactor)
+		r.Post("/auth/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		r.Get("/auth/sessions", authHandler.ListSessions)
+		r.Post("/auth/sessions/revoke", authHandler.RevokeSession)
+		r.Post("/auth/logout", authHandler.Logout)
 
 		// Admin routes
-		r.Post("/admin/invite", adminHandler.CreateInvite)
-		r.Get("/admin/vendors", adminHandler.ListVendors)
-		r.Get("/admin/balance", adminHandler.GetWalletBalance)
-		r.Post("/admin/transfer-balance", adminHandler.TransferBalance)
-		r.Post("/admin/delete", adminHandler.DeleteVendor)
+		r.With(localMiddleware.RequirePermission(models.PermissionAdminsManage)).Get("/admin/admins", adminHandler.ListAdmins)
+		r.With(localMiddleware.RequirePermission(models.PermissionAdminsManage)).Post("/admin/admins", adminHandler.CreateAdmin)
+		r.With(localMiddleware.RequirePermission(models.PermissionAdminsManage)).Post("/admin/admins/remove", adminHandler.RemoveAdmin)
+		r.With(localMiddleware.RequirePermission(models.PermissionAdminsManage)).Post("/admin/admins/password", adminHandler.ResetAdminPassword)
+		r.With(localMiddleware.RequirePermission(models.PermissionAdminsManage)).Get("/admin/audit", adminHandler.ListAuditLogs)
+		r.With(localMiddleware.RequirePermission(models.PermissionVendorsManage)).Post("/admin/invite", adminHandler.CreateInvite)
+		r.With(localMiddleware.RequirePermission(models.PermissionVendorsManage)).Get("/admin/vendors", adminHandler.ListVendors)
+		r.With(localMiddleware.RequirePermission(models.PermissionWalletView)).Get("/admin/balance", adminHandler.GetWalletBalance)
+		r.With(localMiddleware.RequirePermission(models.PermissionPayoutsManage)).Post("/admin/transfer-balance", adminHandler.TransferBalance)
+		r.With(localMiddleware.RequirePermission(models.PermissionVendorsManage)).Post("/admin/delete", adminHandler.DeleteVendor)
+		r.With(localMiddleware.RequirePermission(models.PermissionLedgerManage)).Get("/admin/ledger", ledgerHandler.GetAdminStatement)
+		r.With(localMiddleware.RequirePermission(models.PermissionLedgerManage)).Post("/admin/ledger/adjust", ledgerHandler.CreateAdjustment)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsRefund)).Post("/admin/ledger/refund", ledgerHandler.CreateRefund)
+		r.With(localMiddleware.RequirePermission(models.PermissionCommissionManage)).Get("/admin/commission", ledgerHandler.GetCommissionRule)
+		r.With(localMiddleware.RequirePermission(models.PermissionCommissionManage)).Post("/admin/commission", ledgerHandler.SetCommissionRule)
+		r.With(localMiddleware.RequirePermission(models.PermissionAlertsView)).Get("/admin/notifications", adminHandler.ListNotifications)
+		r.With(localMiddleware.RequirePermission(models.PermissionReconciliationManage)).Get("/admin/reconciliation", reconciliationHandler.ListReports)
+		r.With(localMiddleware.RequirePermission(models.PermissionReconciliationManage)).Post("/admin/reconciliation/run", reconciliationHandler.RunReconciliation)
+		r.With(localMiddleware.RequirePermission(models.PermissionReconciliationManage)).Get("/admin/reconciliation/{id}", reconciliationHandler.GetReport)
+		r.With(localMiddleware.RequirePermission(models.PermissionReconciliationManage)).Get("/admin/reconciliation/{id}/vendors/{vendorID}", reconciliationHandler.GetVendorLine)
 
 		// Vendor routes
-		r.Post("/vendor/delete", vendorHandler.DeleteVendor)
-		r.Post("/vendor/create-pos", vendorHandler.CreatePos)
-		r.Get("/vendor/balance", vendorHandler.GetAccountBalance)
+		r.With(localMiddleware.RequirePermission(models.PermissionVendorDelete)).Post("/vendor/delete", vendorHandler.DeleteVendor)
+		r.With(localMiddleware.RequirePermission(models.PermissionPosManage)).Post("/vendor/create-pos", vendorHandler.CreatePos)
+		r.With(localMiddleware.RequirePermission(models.PermissionLedgerView)).Get("/vendor/balance", vendorHandler.GetAccountBalance)
+		r.With(localMiddleware.RequirePermission(models.PermissionLedgerView)).Get("/vendor/ledger", ledgerHandler.GetVendorStatement)
+		r.With(localMiddleware.RequirePermission(models.PermissionPayoutAddressesManage)).Get("/vendor/payout-addresses", vendorHandler.ListPayoutAddresses)
+		r.With(localMiddleware.RequirePermission(models.PermissionPayoutAddressesManage)).Post("/vendor/payout-addresses", vendorHandler.AddPayoutAddress)
+		r.With(localMiddleware.RequirePermission(models.PermissionPayoutAddressesManage)).Post("/vendor/payout-addresses/remove", vendorHandler.RemovePayoutAddress)
+		r.With(localMiddleware.RequirePermission(models.PermissionPayoutAddressesManage)).Post("/vendor/payout-addresses/split", vendorHandler.UpdatePayoutSplit)
+		r.With(localMiddleware.RequirePermission(models.PermissionPayoutAddressesManage)).Get("/vendor/payout-addresses/history", vendorHandler.GetPayoutAddressHistory)
+		r.With(localMiddleware.RequirePermission(models.PermissionSettingsManage)).Post("/vendor/view-wallet", vendorHandler.RegisterViewWallet)
+		r.With(localMiddleware.RequirePermission(models.PermissionSettingsManage)).Get("/vendor/risk-policy", riskHandler.GetRiskPolicy)
+		r.With(localMiddleware.RequirePermission(models.PermissionSettingsManage)).Post("/vendor/risk-policy", riskHandler.SetRiskPolicy)
+		r.With(localMiddleware.RequirePermission(models.PermissionSettingsManage)).Get("/vendor/checkout/webhook", checkoutHandler.GetWebhook)
+		r.With(localMiddleware.RequirePermission(models.PermissionSettingsManage)).Post("/vendor/checkout/webhook", checkoutHandler.SetWebhook)
+		r.With(localMiddleware.RequirePermission(models.PermissionSettingsManage)).Post("/vendor/checkout/webhook/remove", checkoutHandler.RemoveWebhook)
+		r.With(localMiddleware.RequirePermission(models.PermissionNotificationsView)).Get("/vendor/notifications", vendorHandler.ListNotifications)
+		r.With(localMiddleware.RequirePermission(models.PermissionPayoutsRequest)).Post("/vendor/transfer-balance", vendorHandler.TransferBalance)
+		r.With(localMiddleware.RequirePermission(models.PermissionRolesManage)).Get("/vendor/roles", vendorHandler.ListRoles)
+		r.With(localMiddleware.RequirePermission(models.PermissionRolesManage)).Post("/vendor/roles", vendorHandler.SaveRole)
+		r.With(localMiddleware.RequirePermission(models.PermissionRolesManage)).Post("/vendor/roles/remove", vendorHandler.RemoveRole)
+		r.With(localMiddleware.RequirePermission(models.PermissionPosManage)).Post("/vendor/pos/role", vendorHandler.SetPosRole)
+		r.With(localMiddleware.RequirePermission(models.PermissionPosManage)).Post("/vendor/pos/pairing-code", vendorHandler.CreatePairingCode)
+		r.With(localMiddleware.RequirePermission(models.PermissionPosManage)).Get("/vendor/pos/devices", vendorHandler.ListPosDevices)
+		r.With(localMiddleware.RequirePermission(models.PermissionPosManage)).Post("/vendor/pos/devices/approve", vendorHandler.ApprovePosDevice)
+		r.With(localMiddleware.RequirePermission(models.PermissionPosManage)).Post("/vendor/pos/devices/revoke", vendorHandler.RevokePosDevice)
+		r.With(localMiddleware.RequirePermission(models.PermissionStaffManage)).Get("/vendor/staff", vendorHandler.ListStaff)
+		r.With(localMiddleware.RequirePermission(models.PermissionStaffManage)).Post("/vendor/staff", vendorHandler.CreateStaff)
+		r.With(localMiddleware.RequirePermission(models.PermissionStaffManage)).Post("/vendor/staff/update", vendorHandler.UpdateStaff)
+		r.With(localMiddleware.RequirePermission(models.PermissionStaffManage)).Post("/vendor/staff/revoke", vendorHandler.RevokeStaff)
+		r.With(localMiddleware.RequirePermission(models.PermissionReportsView)).Get("/vendor/staff/report", vendorHandler.StaffReport)
+		r.With(localMiddleware.RequirePermission(models.PermissionAPIKeysManage)).Get("/vendor/api-keys", vendorHandler.ListAPIKeys)
+		r.With(localMiddleware.RequirePermission(models.PermissionAPIKeysManage)).Post("/vendor/api-keys", vendorHandler.CreateAPIKey)
+		r.With(localMiddleware.RequirePermission(models.PermissionAPIKeysManage)).Post("/vendor/api-keys/revoke", vendorHandler.RevokeAPIKey)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsView)).Get("/vendor/transactions", posHandler.ListVendorTransactions)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsView)).Get("/vendor/transactions/{id}", posHandler.GetVendorTransaction)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsExport)).Get("/vendor/transactions/export", posHandler.ExportVendorTransactions)
+
+		// Online checkout routes, for a vendor's shop using an API key
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsCreate)).Post("/checkout/invoices", checkoutHandler.CreateCheckout)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsView)).Get("/checkout/invoices/{id}", checkoutHandler.GetCheckout)
 
 		// POS routes
-		r.Post("/pos/create-transaction", posHandler.CreateTransaction)
-		r.Get("/pos/transaction/{id}", posHandler.GetTransaction)
-		r.Get("/pos/transactions", posHandler.ListTransactions)
-		r.Get("/pos/export", posHandler.ExportTransactions)
-		r.HandleFunc("/pos/ws/transaction", posHandler.TransactionWS)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsCreate)).Post("/pos/create-transaction", posHandler.CreateTransaction)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsView)).Get("/pos/transaction/{id}", posHandler.GetTransaction)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsView)).Get("/pos/transactions", posHandler.ListTransactions)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsView)).Get("/pos/export", posHandler.ExportTransactions)
+		r.With(localMiddleware.RequirePermission(models.PermissionTransactionsView)).HandleFunc("/pos/ws/transaction", posHandler.TransactionWS)
 	})
 
-	return r
+	return r, nil
 }
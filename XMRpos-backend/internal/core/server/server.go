@@ -30,11 +30,11 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 		config:    cfg,
 		db:        db,
 		walletRPC: rpc.NewClient(cfg.MoneroWalletRPCEndpoint, cfg.MoneroWalletRPCUsername, cfg.MoneroWalletRPCPassword),
-		moneroPay: moneropay.NewMoneroPayAPIClient(),
 	}
 
-	if s.moneroPay != nil && cfg.MoneroPayBaseURL != "" {
-		s.moneroPay.BaseURL = cfg.MoneroPayBaseURL
+	// MoneroPay is optional with the walletrpc backend, but stays reachable for invoices it created
+	if cfg.MoneroPayBaseURL != "" {
+		s.moneroPay = &moneropay.MoneroPayAPIClient{BaseURL: cfg.MoneroPayBaseURL}
 	}
 
 	if cfg.MoneroDaemonRPCEndpoint != "" {
@@ -51,9 +51,21 @@ func (s *Server) Start() error {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	s.runStartupSequence(ctx)
+	if err := s.runStartupSequence(ctx); err != nil {
+		return fmt.Errorf("startup failed: %w", err)
+	}
+
+	// Block hashes come from the daemon only; the wallet RPC fallback cannot serve them
+	var daemonRPC *rpc.Client
+	if s.config.MoneroDaemonRPCEndpoint != "" {
+		daemonRPC = s.daemonRPC
+	}
 
-	s.router = NewRouter(ctx, s.config, s.db, s.walletRPC, s.moneroPay)
+	router, err := NewRouter(ctx, s.config, s.db, s.walletRPC, daemonRPC, s.moneroPay)
+	if err != nil {
+		return fmt.Errorf("startup failed: %w", err)
+	}
+	s.router = router
 
 	server := &http.Server{
 		Addr:              "0.0.0.0:" + s.config.Port,
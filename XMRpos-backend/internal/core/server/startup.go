@@ -6,18 +6,26 @@ import (
 	"log"
 	"strings"
 	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/pkg/monero"
 )
 
 const atomicUnitsPerXMR uint64 = 1_000_000_000_000
 
-func (s *Server) runStartupSequence(ctx context.Context) {
+func (s *Server) runStartupSequence(ctx context.Context) error {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
 	s.logMoneroNodeInfo(ctx)
 	s.ensureWalletReady(ctx)
-	s.logMoneroPayHealth(ctx)
+	if err := s.detectWalletNetwork(ctx); err != nil {
+		return err
+	}
+	if s.config.PaymentBackend == "moneropay" {
+		s.logMoneroPayHealth(ctx)
+	}
+	return nil
 }
 
 func (s *Server) logMoneroNodeInfo(parentCtx context.Context) {
@@ -163,6 +171,43 @@ func (s *Server) configureAutoRefresh(parentCtx context.Context) error {
 	return nil
 }
 
+// detectWalletNetwork derives the network from the wallet's primary address so that payout
+// addresses are validated against the network the wallet actually pays out on. Startup fails
+// when the wallet cannot be asked and MONERO_NETWORK is not set, or when the two disagree.
+func (s *Server) detectWalletNetwork(parentCtx context.Context) error {
+	ctx, cancel := context.WithTimeout(parentCtx, 10*time.Second)
+	defer cancel()
+
+	var resp struct {
+		Address string `json:"address"`
+	}
+	err := s.walletRPC.Call(ctx, "get_address", map[string]any{"account_index": 0}, &resp)
+	if err != nil {
+		// Addresses would be checked against a guessed network, so a configured one is required
+		if s.config.MoneroNetwork == "" {
+			return fmt.Errorf("detecting the Monero network from the wallet: %w; set MONERO_NETWORK to start without the wallet", err)
+		}
+		log.Printf("Failed to fetch wallet address, using MONERO_NETWORK %s: %v", s.config.MoneroNetwork, err)
+		return nil
+	}
+
+	address, err := monero.DecodeAddress(resp.Address)
+	if err != nil {
+		return fmt.Errorf("decoding the wallet address: %w", err)
+	}
+
+	if s.config.MoneroNetwork == "" {
+		s.config.MoneroNetwork = address.Network
+		log.Printf("Monero network detected from wallet: %s", address.Network)
+		return nil
+	}
+
+	if s.config.MoneroNetwork != address.Network {
+		return fmt.Errorf("MONERO_NETWORK is %s but the wallet is on %s", s.config.MoneroNetwork, address.Network)
+	}
+	return nil
+}
+
 func (s *Server) logMoneroPayHealth(parentCtx context.Context) {
 	if s.moneroPay == nil {
 		log.Println("MoneroPay client not configured; skipping health check")
@@ -0,0 +1,252 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+// Purpose keeps access and refresh tokens apart, one is never accepted as the other
+type Purpose string
+
+const (
+	Access  Purpose = "access"
+	Refresh Purpose = "refresh"
+)
+
+// JWT "typ" headers of the tokens signed with a key pair
+var typeHeaders = map[Purpose]string{
+	Access:  "at+jwt",
+	Refresh: "refresh+jwt",
+}
+
+// A token with an unknown kid reloads the keys, at most this often, in case another instance
+// activated a new key first
+const unknownKidReloadInterval = 10 * time.Second
+
+// Keyring signs and verifies tokens with the keys stored in the database. Without an active key,
+// or for tokens issued before there was one, it falls back to HS256 with JWT_SECRET and
+// JWT_REFRESH_SECRET unless JWT_HS256_FALLBACK is off.
+type Keyring struct {
+	db          *gorm.DB
+	secrets     map[Purpose][]byte
+	acceptHS256 bool
+	mu          sync.RWMutex
+	signer      *keyPair
+	keys        map[string]*keyPair // Verification keys by kid
+	jwks        []byte
+	lastReload  time.Time
+}
+
+type keyPair struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+func NewKeyring(ctx context.Context, db *gorm.DB, cfg *config.Config) (*Keyring, error) {
+	k := &Keyring{
+		db: db,
+		secrets: map[Purpose][]byte{
+			Access:  []byte(cfg.JWTSecret),
+			Refresh: []byte(cfg.JWTRefreshSecret),
+		},
+		acceptHS256: cfg.JWTHS256Fallback,
+	}
+	if err := k.Reload(ctx); err != nil {
+		return nil, err
+	}
+	if !k.acceptHS256 && k.signer == nil {
+		return nil, errors.New("JWT_HS256_FALLBACK is off but no signing key is active, create one with cmd/keys")
+	}
+	return k, nil
+}
+
+// StartReloader picks up keys generated, activated or retired by cmd/keys
+func (k *Keyring) StartReloader(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reloadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				if err := k.Reload(reloadCtx); err != nil && !errors.Is(err, context.Canceled) {
+					log.Printf("Error reloading signing keys: %v", err)
+				}
+				cancel()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Reload reads the keys that have not expired
+func (k *Keyring) Reload(ctx context.Context) error {
+	var rows []models.SigningKey
+	if err := k.db.WithContext(ctx).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("activated_at DESC NULLS LAST, id DESC").
+		Find(&rows).Error; err != nil {
+		return err
+	}
+	return k.load(rows, time.Now())
+}
+
+// load replaces the keys with those of the rows that have not expired at now. The rows come
+// newest activation first, the first active one signs.
+func (k *Keyring) load(rows []models.SigningKey, now time.Time) error {
+	keys := make(map[string]*keyPair, len(rows))
+	var signer *keyPair
+	published := []jwk{}
+	for _, row := range rows {
+		if row.ExpiresAt != nil && !row.ExpiresAt.After(now) {
+			continue
+		}
+		pair, err := parseKey(&row)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.KID, err)
+		}
+		keys[row.KID] = pair
+		if signer == nil && row.ActivatedAt != nil && row.RetiredAt == nil {
+			signer = pair
+		}
+		entry, err := publicJWK(pair)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.KID, err)
+		}
+		published = append(published, entry)
+	}
+
+	jwks, err := json.Marshal(map[string][]jwk{"keys": published})
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.signer = signer
+	k.jwks = jwks
+	k.lastReload = time.Now()
+	return nil
+}
+
+// Sign signs the claims with the active key, or HS256 when there is none
+func (k *Keyring) Sign(purpose Purpose, claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	signer := k.signer
+	k.mu.RUnlock()
+
+	if signer == nil {
+		if !k.acceptHS256 {
+			return "", errors.New("no signing key is active")
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secrets[purpose])
+	}
+
+	token := jwt.NewWithClaims(signer.method, claims)
+	token.Header["kid"] = signer.kid
+	token.Header["typ"] = typeHeaders[purpose]
+	return token.SignedString(signer.private)
+}
+
+// Parse verifies a token of the purpose and decodes its claims
+func (k *Keyring) Parse(purpose Purpose, tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			if !k.acceptHS256 {
+				return nil, errors.New("HS256 tokens are no longer accepted")
+			}
+			return k.secrets[purpose], nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		pair := k.verificationKey(kid)
+		if pair == nil {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != pair.method.Alg() {
+			return nil, errors.New("invalid signing method")
+		}
+		if token.Header["typ"] != typeHeaders[purpose] {
+			return nil, errors.New("invalid token type")
+		}
+		return pair.public, nil
+	}, jwt.WithValidMethods([]string{"HS256", "EdDSA", "ES256"}))
+}
+
+func (k *Keyring) verificationKey(kid string) *keyPair {
+	k.mu.Lock()
+	pair := k.keys[kid]
+	if pair != nil || kid == "" || time.Since(k.lastReload) < unknownKidReloadInterval {
+		k.mu.Unlock()
+		return pair
+	}
+	k.lastReload = time.Now() // Concurrent requests with the same kid do not reload again
+	k.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := k.Reload(ctx); err != nil {
+		log.Printf("Error reloading signing keys: %v", err)
+		return nil
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[kid]
+}
+
+// JWKS is the JSON Web Key Set of the verification keys
+func (k *Keyring) JWKS() []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.jwks
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+func publicJWK(pair *keyPair) (jwk, error) {
+	entry := jwk{Kid: pair.kid, Alg: pair.method.Alg(), Use: "sig"}
+	switch public := pair.public.(type) {
+	case ed25519.PublicKey:
+		entry.Kty, entry.Crv = "OKP", "Ed25519"
+		entry.X = base64.RawURLEncoding.EncodeToString(public)
+	case *ecdsa.PublicKey:
+		ecdhKey, err := public.ECDH()
+		if err != nil {
+			return jwk{}, err
+		}
+		point := ecdhKey.Bytes() // 0x04, X and Y
+		size := (len(point) - 1) / 2
+		entry.Kty, entry.Crv = "EC", "P-256"
+		entry.X = base64.RawURLEncoding.EncodeToString(point[1 : 1+size])
+		entry.Y = base64.RawURLEncoding.EncodeToString(point[1+size:])
+	default:
+		return jwk{}, errors.New("unsupported key type")
+	}
+	return entry, nil
+}
@@ -0,0 +1,218 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+func testKey(t *testing.T, algorithm string, activatedAt *time.Time) models.SigningKey {
+	t.Helper()
+	key, err := newSigningKey(algorithm)
+	if err != nil {
+		t.Fatalf("newSigningKey(%s) error = %v", algorithm, err)
+	}
+	key.ActivatedAt = activatedAt
+	return *key
+}
+
+func testKeyring(t *testing.T, acceptHS256 bool, rows []models.SigningKey, now time.Time) *Keyring {
+	t.Helper()
+	k := &Keyring{
+		secrets:     map[Purpose][]byte{Access: []byte("access secret"), Refresh: []byte("refresh secret")},
+		acceptHS256: acceptHS256,
+	}
+	if err := k.load(rows, now); err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	return k
+}
+
+func testClaims() *jwt.RegisteredClaims {
+	return &jwt.RegisteredClaims{
+		Subject:   "vendor:7",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func TestSignParseRoundTrip(t *testing.T) {
+	now := time.Now()
+	for _, algorithm := range []string{"EdDSA", "ES256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			key := testKey(t, algorithm, &now)
+			k := testKeyring(t, false, []models.SigningKey{key}, now)
+
+			token, err := k.Sign(Access, testClaims())
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+
+			claims := &jwt.RegisteredClaims{}
+			parsed, err := k.Parse(Access, token, claims)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if parsed.Header["kid"] != key.KID || parsed.Method.Alg() != algorithm {
+				t.Errorf("token kid = %v, alg = %s, want %s, %s", parsed.Header["kid"], parsed.Method.Alg(), key.KID, algorithm)
+			}
+			if claims.Subject != "vendor:7" {
+				t.Errorf("Subject = %s, want vendor:7", claims.Subject)
+			}
+
+			if _, err := k.Parse(Refresh, token, &jwt.RegisteredClaims{}); err == nil {
+				t.Error("Parse() accepted an access token as a refresh token")
+			}
+		})
+	}
+}
+
+func TestHS256Fallback(t *testing.T) {
+	k := testKeyring(t, true, nil, time.Now())
+	token, err := k.Sign(Refresh, testClaims())
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if _, err := k.Parse(Refresh, token, &jwt.RegisteredClaims{}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, err := k.Parse(Access, token, &jwt.RegisteredClaims{}); err == nil {
+		t.Error("Parse() accepted a refresh token as an access token")
+	}
+
+	k.acceptHS256 = false
+	if _, err := k.Parse(Refresh, token, &jwt.RegisteredClaims{}); err == nil {
+		t.Error("Parse() accepted HS256 with the fallback off")
+	}
+	if _, err := k.Sign(Refresh, testClaims()); err == nil {
+		t.Error("Sign() signed without a key and with the fallback off")
+	}
+}
+
+func TestRetiredKeyGracePeriod(t *testing.T) {
+	grace := 24 * time.Hour
+	activated := time.Now().Add(-48 * time.Hour)
+	old := testKey(t, "EdDSA", &activated)
+
+	k := testKeyring(t, false, []models.SigningKey{old}, activated)
+	token, err := k.Sign(Access, testClaims())
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	// A new key is activated, the old one is retired and verifies until the grace period ends
+	rotated := activated.Add(time.Hour)
+	expires := rotated.Add(grace)
+	old.RetiredAt, old.ExpiresAt = &rotated, &expires
+	current := testKey(t, "ES256", &rotated)
+	rows := []models.SigningKey{current, old}
+
+	tests := []struct {
+		name  string
+		now   time.Time
+		valid bool
+	}{
+		{"right after the rotation", rotated, true},
+		{"within the grace period", rotated.Add(grace - time.Second), true},
+		{"when the grace period ends", expires, false},
+		{"after the grace period", expires.Add(time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := testKeyring(t, false, rows, tt.now)
+			_, err := k.Parse(Access, token, &jwt.RegisteredClaims{})
+			if tt.valid && err != nil {
+				t.Errorf("Parse() error = %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Parse() accepted a token of an expired key")
+			}
+
+			signed, err := k.Sign(Access, testClaims())
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			parsed, err := k.Parse(Access, signed, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if parsed.Header["kid"] != current.KID {
+				t.Errorf("signed with %v, want the new key %s", parsed.Header["kid"], current.KID)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	edKey := testKey(t, "EdDSA", &now)
+	ecKey := testKey(t, "ES256", nil) // Published before it is activated
+	expired := testKey(t, "EdDSA", &past)
+	expired.RetiredAt, expired.ExpiresAt = &past, &past
+
+	k := testKeyring(t, false, []models.SigningKey{edKey, ecKey, expired}, now)
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(k.JWKS(), &set); err != nil {
+		t.Fatalf("JWKS is not JSON: %v", err)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(set.Keys))
+	}
+
+	published := map[string]jwk{}
+	for _, entry := range set.Keys {
+		published[entry.Kid] = entry
+		if entry.Use != "sig" {
+			t.Errorf("key %s use = %s, want sig", entry.Kid, entry.Use)
+		}
+	}
+	if _, ok := published[expired.KID]; ok {
+		t.Error("JWKS publishes an expired key")
+	}
+
+	edEntry, ok := published[edKey.KID]
+	if !ok {
+		t.Fatal("JWKS is missing the EdDSA key")
+	}
+	edPair, _ := parseKey(&edKey)
+	if edEntry.Kty != "OKP" || edEntry.Crv != "Ed25519" || edEntry.Alg != "EdDSA" {
+		t.Errorf("EdDSA entry = %+v", edEntry)
+	}
+	if x := decodeBase64URL(t, edEntry.X); !ed25519.PublicKey(x).Equal(edPair.public) {
+		t.Error("EdDSA x does not match the public key")
+	}
+
+	ecEntry, ok := published[ecKey.KID]
+	if !ok {
+		t.Fatal("JWKS is missing the ES256 key")
+	}
+	ecPair, _ := parseKey(&ecKey)
+	public := ecPair.public.(*ecdsa.PublicKey)
+	if ecEntry.Kty != "EC" || ecEntry.Crv != "P-256" || ecEntry.Alg != "ES256" {
+		t.Errorf("ES256 entry = %+v", ecEntry)
+	}
+	x, y := decodeBase64URL(t, ecEntry.X), decodeBase64URL(t, ecEntry.Y)
+	if len(x) != 32 || len(y) != 32 || new(big.Int).SetBytes(x).Cmp(public.X) != 0 || new(big.Int).SetBytes(y).Cmp(public.Y) != 0 {
+		t.Error("ES256 x and y do not match the public key")
+	}
+}
+
+func decodeBase64URL(t *testing.T, value string) []byte {
+	t.Helper()
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatalf("invalid base64url %q: %v", value, err)
+	}
+	return decoded
+}
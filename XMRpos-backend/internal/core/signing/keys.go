@@ -0,0 +1,163 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+// Key management for cmd/keys. Running instances pick the changes up within a minute.
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// GenerateKey stores a new key pair. Unless activate is set it is only published, so verifiers
+// caching the JWKS know it before the first token signed with it arrives; ActivateKey it later.
+func GenerateKey(ctx context.Context, db *gorm.DB, algorithm string, activate bool, grace time.Duration) (*models.SigningKey, error) {
+	key, err := newSigningKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(key).Error; err != nil {
+			return err
+		}
+		if activate {
+			return activateKey(tx, key, grace)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// newSigningKey generates a key pair with a random kid
+func newSigningKey(algorithm string) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q, use EdDSA or ES256", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		KID:        hex.EncodeToString(kid),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}, nil
+}
+
+// ActivateKey makes the key the signer. The key signing until now is retired and keeps verifying
+// for grace, long enough for the tokens it signed to expire.
+func ActivateKey(ctx context.Context, db *gorm.DB, kid string, grace time.Duration) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var key models.SigningKey
+		if err := tx.Where("kid = ? AND retired_at IS NULL", kid).First(&key).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrKeyNotFound
+			}
+			return err
+		}
+		return activateKey(tx, &key, grace)
+	})
+}
+
+func activateKey(tx *gorm.DB, key *models.SigningKey, grace time.Duration) error {
+	now := time.Now()
+	expires := now.Add(grace)
+	if err := tx.Model(&models.SigningKey{}).
+		Where("id <> ? AND activated_at IS NOT NULL AND retired_at IS NULL", key.ID).
+		Updates(map[string]interface{}{"retired_at": now, "expires_at": expires}).Error; err != nil {
+		return err
+	}
+	key.ActivatedAt = &now
+	return tx.Model(key).Update("activated_at", now).Error
+}
+
+// RetireKey stops the key from signing; it keeps verifying for grace. Retiring the only active
+// key goes back to HS256.
+func RetireKey(ctx context.Context, db *gorm.DB, kid string, grace time.Duration) error {
+	now := time.Now()
+	result := db.WithContext(ctx).Model(&models.SigningKey{}).
+		Where("kid = ? AND retired_at IS NULL", kid).
+		Updates(map[string]interface{}{"retired_at": now, "expires_at": now.Add(grace)})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// PruneKeys deletes the expired keys
+func PruneKeys(ctx context.Context, db *gorm.DB) (int64, error) {
+	result := db.WithContext(ctx).Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.SigningKey{})
+	return result.RowsAffected, result.Error
+}
+
+func ListKeys(ctx context.Context, db *gorm.DB) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	if err := db.WithContext(ctx).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func parseKey(row *models.SigningKey) (*keyPair, error) {
+	block, _ := pem.Decode([]byte(row.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	pair := &keyPair{kid: row.KID}
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		if row.Algorithm != "EdDSA" {
+			return nil, errors.New("key does not match algorithm " + row.Algorithm)
+		}
+		pair.method, pair.private, pair.public = jwt.SigningMethodEdDSA, private, private.Public()
+	case *ecdsa.PrivateKey:
+		if row.Algorithm != "ES256" || private.Curve != elliptic.P256() {
+			return nil, errors.New("key does not match algorithm " + row.Algorithm)
+		}
+		pair.method, pair.private, pair.public = jwt.SigningMethodES256, private, &private.PublicKey
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+	return pair, nil
+}
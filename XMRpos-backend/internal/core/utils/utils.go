@@ -13,3 +13,33 @@ func GetClaimFromContext(ctx context.Context, key models.ClaimsContextKey) (valu
 	}
 	return value, true
 }
+
+type peerAddrKey struct{}
+
+// WithPeerAddr stores the address of the connection's peer, before RealIP replaces RemoteAddr
+// with what the forwarding headers of a trusted proxy claim
+func WithPeerAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, peerAddrKey{}, addr)
+}
+
+func GetPeerAddr(ctx context.Context) string {
+	addr, _ := ctx.Value(peerAddrKey{}).(string)
+	return addr
+}
+
+type permissionsKey struct{}
+
+// WithPermissions stores the permissions of the authenticated caller
+func WithPermissions(ctx context.Context, permissions []models.Permission) context.Context {
+	return context.WithValue(ctx, permissionsKey{}, permissions)
+}
+
+func HasPermission(ctx context.Context, permission models.Permission) bool {
+	permissions, _ := ctx.Value(permissionsKey{}).([]models.Permission)
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
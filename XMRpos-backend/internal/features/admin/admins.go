@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrLastAdmin is returned when removing the only remaining admin
+var ErrLastAdmin = errors.New("the last admin cannot be removed")
+
+func (s *AdminService) ListAdmins(ctx context.Context) ([]*models.Admin, *models.HTTPError) {
+	admins, err := s.repo.ListAdmins(ctx)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving admins: "+err.Error())
+	}
+	return admins, nil
+}
+
+func (s *AdminService) CreateAdmin(ctx context.Context, name string, password string) (*models.Admin, *models.HTTPError) {
+	if len(name) < 3 || len(name) > 50 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "name must be at least 3 characters and no more than 50 characters")
+	}
+
+	if len(password) < 12 || len(password) > 72 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "password must be at least 12 characters and no more than 72 characters")
+	}
+
+	nameTaken, err := s.repo.AdminByNameExists(ctx, name)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error checking if admin name exists: "+err.Error())
+	}
+	if nameTaken {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "admin name already taken")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error hashing password: "+err.Error())
+	}
+
+	admin := &models.Admin{Name: name, PasswordHash: string(hashedPassword)}
+	if err := s.repo.CreateAdmin(ctx, admin); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error creating admin: "+err.Error())
+	}
+	return admin, nil
+}
+
+// RemoveAdmin removes another admin, ending its sessions
+func (s *AdminService) RemoveAdmin(ctx context.Context, callerID uint, adminID uint) *models.HTTPError {
+	if adminID == callerID {
+		return models.NewHTTPError(http.StatusBadRequest, "admins cannot remove themselves")
+	}
+
+	if err := s.repo.DeleteAdmin(ctx, adminID); err != nil {
+		switch {
+		case errors.Is(err, ErrLastAdmin):
+			return models.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return models.NewHTTPError(http.StatusNotFound, "admin not found")
+		}
+		return models.NewHTTPError(http.StatusInternalServerError, "error removing admin: "+err.Error())
+	}
+	return nil
+}
+
+// ResetAdminPassword sets the password of another admin and ends its sessions. Admins change
+// their own password with /auth/update-password.
+func (s *AdminService) ResetAdminPassword(ctx context.Context, callerID uint, adminID uint, password string) *models.HTTPError {
+	if adminID == callerID {
+		return models.NewHTTPError(http.StatusBadRequest, "use /auth/update-password to change your own password")
+	}
+
+	if len(password) < 12 || len(password) > 72 {
+		return models.NewHTTPError(http.StatusBadRequest, "password must be at least 12 characters and no more than 72 characters")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "error hashing password: "+err.Error())
+	}
+
+	if err := s.repo.ResetAdminPasswordHash(ctx, adminID, string(hashedPassword)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.NewHTTPError(http.StatusNotFound, "admin not found")
+		}
+		return models.NewHTTPError(http.StatusInternalServerError, "error resetting password: "+err.Error())
+	}
+	return nil
+}
+
+func (s *AdminService) ListAuditLogs(ctx context.Context, adminID *uint, limit int) ([]*models.AdminAuditLog, *models.HTTPError) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	entries, err := s.repo.ListAuditLogs(ctx, adminID, limit)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving audit log: "+err.Error())
+	}
+	return entries, nil
+}
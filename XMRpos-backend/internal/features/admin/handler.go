@@ -3,13 +3,13 @@ package admin
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 	"context"
 	"io"
 
 	vendorfeature "github.com/monerokon/xmrpos/xmrpos-backend/internal/features/vendor"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
-	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
 )
 
 type AdminHandler struct {
@@ -50,15 +50,6 @@ type deleteVendorResponse struct {
 }
 
 func (h *AdminHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
-	// check jwt if admin
-
-	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-
-	if !ok || role != "admin" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
   defer cancel()
   r = r.WithContext(ctx)
@@ -89,12 +80,6 @@ func (h *AdminHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AdminHandler) ListVendors(w http.ResponseWriter, r *http.Request) {
-	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-	if !ok || role != "admin" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 	r = r.WithContext(ctx)
@@ -113,13 +98,28 @@ func (h *AdminHandler) ListVendors(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
-func (h *AdminHandler) GetWalletBalance(w http.ResponseWriter, r *http.Request) {
-	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-	if !ok || role != "admin" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+func (h *AdminHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	notifications, err := h.service.ListNotifications(ctx, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	resp := struct {
+		Notifications []*models.Notification `json:"notifications"`
+	}{Notifications: notifications}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *AdminHandler) GetWalletBalance(w http.ResponseWriter, r *http.Request) {
 	if h.vendorService == nil {
 		http.Error(w, "Vendor service not configured", http.StatusInternalServerError)
 		return
@@ -150,12 +150,6 @@ func (h *AdminHandler) GetWalletBalance(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *AdminHandler) TransferBalance(w http.ResponseWriter, r *http.Request) {
-	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-	if !ok || role != "admin" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	if h.vendorService == nil {
 		http.Error(w, "Vendor service not configured", http.StatusInternalServerError)
 		return
@@ -192,12 +186,6 @@ func (h *AdminHandler) TransferBalance(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AdminHandler) DeleteVendor(w http.ResponseWriter, r *http.Request) {
-	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-	if !ok || role != "admin" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 	r = r.WithContext(ctx)
@@ -247,3 +235,157 @@ func (h *AdminHandler) DeleteVendor(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 	io.Copy(io.Discard, r.Body)
 }
+
+func (h *AdminHandler) ListAdmins(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	admins, httpErr := h.service.ListAdmins(ctx)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := struct {
+		Admins []*models.Admin `json:"admins"`
+	}{Admins: admins}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+type createAdminRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+func (h *AdminHandler) CreateAdmin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req createAdminRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	admin, httpErr := h.service.CreateAdmin(ctx, req.Name, req.Password)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(admin)
+	io.Copy(io.Discard, r.Body)
+}
+
+type removeAdminRequest struct {
+	ID uint `json:"id"`
+}
+
+func (h *AdminHandler) RemoveAdmin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req removeAdminRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	adminIDPtr, _ := r.Context().Value(models.ClaimsAdminIDKey).(*uint)
+	if adminIDPtr == nil {
+		http.Error(w, "Unauthorized: admin_id not found", http.StatusUnauthorized)
+		return
+	}
+
+	httpErr := h.service.RemoveAdmin(ctx, *adminIDPtr, req.ID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := "Admin removed successfully"
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+	io.Copy(io.Discard, r.Body)
+}
+
+type resetAdminPasswordRequest struct {
+	ID          uint   `json:"id"`
+	NewPassword string `json:"new_password"`
+}
+
+func (h *AdminHandler) ResetAdminPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req resetAdminPasswordRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	adminIDPtr, _ := r.Context().Value(models.ClaimsAdminIDKey).(*uint)
+	if adminIDPtr == nil {
+		http.Error(w, "Unauthorized: admin_id not found", http.StatusUnauthorized)
+		return
+	}
+
+	httpErr := h.service.ResetAdminPassword(ctx, *adminIDPtr, req.ID, req.NewPassword)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := "Admin password reset successfully"
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *AdminHandler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	var adminID *uint
+	if value := r.URL.Query().Get("admin_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "admin_id must be a number", http.StatusBadRequest)
+			return
+		}
+		parsed := uint(id)
+		adminID = &parsed
+	}
+
+	entries, httpErr := h.service.ListAuditLogs(ctx, adminID, limit)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := struct {
+		Entries []*models.AdminAuditLog `json:"entries"`
+	}{Entries: entries}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -10,6 +10,14 @@ import (
 type AdminRepository interface {
 	CreateInvite(ctx context.Context, invite *models.Invite) (*models.Invite, error)
 	ListVendorsWithBalances(ctx context.Context) ([]VendorSummary, error)
+	ListNotifications(ctx context.Context, limit int) ([]*models.Notification, error)
+	ListAdmins(ctx context.Context) ([]*models.Admin, error)
+	AdminByNameExists(ctx context.Context, name string) (bool, error)
+	CreateAdmin(ctx context.Context, admin *models.Admin) error
+	DeleteAdmin(ctx context.Context, adminID uint) error
+	ResetAdminPasswordHash(ctx context.Context, adminID uint, newPasswordHash string) error
+	CreateAuditLog(ctx context.Context, entry *models.AdminAuditLog) error
+	ListAuditLogs(ctx context.Context, adminID *uint, limit int) ([]*models.AdminAuditLog, error)
 }
 
 type adminRepository struct {
@@ -38,8 +46,8 @@ func (r *adminRepository) ListVendorsWithBalances(ctx context.Context) ([]Vendor
 	var results []VendorSummary
 	err := r.db.WithContext(ctx).
 		Model(&models.Vendor{}).
-		Select("vendors.id AS id, vendors.name AS name, vendors.monero_subaddress AS monero_subaddress, COALESCE(SUM(CASE WHEN transactions.confirmed = ? AND transactions.transferred = ? THEN transactions.amount ELSE 0 END), 0) AS balance", true, false).
-		Joins("LEFT JOIN transactions ON transactions.vendor_id = vendors.id").
+		Select("vendors.id AS id, vendors.name AS name, vendors.monero_subaddress AS monero_subaddress, COALESCE(SUM(CASE WHEN ledger_entries.credit_account = ? THEN ledger_entries.amount WHEN ledger_entries.debit_account = ? THEN -ledger_entries.amount ELSE 0 END), 0) AS balance", models.LedgerAccountVendor, models.LedgerAccountVendor).
+		Joins("LEFT JOIN ledger_entries ON ledger_entries.vendor_id = vendors.id").
 		Group("vendors.id, vendors.name, vendors.monero_subaddress").
 		Order("vendors.id ASC").
 		Scan(&results).Error
@@ -49,3 +57,126 @@ func (r *adminRepository) ListVendorsWithBalances(ctx context.Context) ([]Vendor
 
 	return results, nil
 }
+
+func (r *adminRepository) ListNotifications(ctx context.Context, limit int) ([]*models.Notification, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var notifications []*models.Notification
+	err := r.db.WithContext(ctx).
+		Where("audience = ?", models.NotificationAudienceAdmin).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&notifications).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (r *adminRepository) ListAdmins(ctx context.Context) ([]*models.Admin, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var admins []*models.Admin
+	if err := r.db.WithContext(ctx).Order("id ASC").Find(&admins).Error; err != nil {
+		return nil, err
+	}
+	return admins, nil
+}
+
+func (r *adminRepository) AdminByNameExists(ctx context.Context, name string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.Admin{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *adminRepository) CreateAdmin(ctx context.Context, admin *models.Admin) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Create(admin).Error
+}
+
+// DeleteAdmin soft deletes the admin unless it is the last one, checked in the same transaction
+// so two admins cannot remove each other at once
+func (r *adminRepository) DeleteAdmin(ctx context.Context, adminID uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Serialize removals
+		if err := tx.Exec("LOCK TABLE admins IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.Admin{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 {
+			return ErrLastAdmin
+		}
+		result := tx.Where("id = ?", adminID).Delete(&models.Admin{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// ResetAdminPasswordHash sets a new password and bumps password_version, which ends the admin's sessions
+func (r *adminRepository) ResetAdminPasswordHash(ctx context.Context, adminID uint, newPasswordHash string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	result := r.db.WithContext(ctx).Model(&models.Admin{}).
+		Where("id = ?", adminID).
+		Updates(map[string]interface{}{
+			"password_hash":    newPasswordHash,
+			"password_version": gorm.Expr("password_version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *adminRepository) CreateAuditLog(ctx context.Context, entry *models.AdminAuditLog) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+func (r *adminRepository) ListAuditLogs(ctx context.Context, adminID *uint, limit int) ([]*models.AdminAuditLog, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	query := r.db.WithContext(ctx).Order("created_at DESC").Limit(limit)
+	if adminID != nil {
+		query = query.Where("admin_id = ?", *adminID)
+	}
+	var entries []*models.AdminAuditLog
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -62,6 +62,18 @@ func (s *AdminService) ListVendorsWithBalances(ctx context.Context) ([]VendorSum
 	return s.repo.ListVendorsWithBalances(ctx)
 }
 
+func (s *AdminService) ListNotifications(ctx context.Context, limit int) ([]*models.Notification, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	return s.repo.ListNotifications(ctx, limit)
+}
+
 func (s *AdminService) DeleteVendor(ctx context.Context, vendorID uint) (httpErr *models.HTTPError) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -3,12 +3,13 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/ratelimit"
 	/* "github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils" */)
 
 type AuthHandler struct {
@@ -35,8 +36,23 @@ type loginResponse struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// loginError answers a failed login, with Retry-After while attempts are locked
+func loginError(w http.ResponseWriter, err error) {
+	var locked *ratelimit.LockedError
+	if errors.As(err, &locked) {
+		w.Header().Set("Retry-After", locked.RetryAfterSeconds())
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, errDeviceNotApproved) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
 func (h *AuthHandler) LoginAdmin(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(withSessionClient(r.Context(), r), 5*time.Second)
 	defer cancel()
 	r = r.WithContext(ctx)
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB
@@ -49,9 +65,59 @@ func (h *AuthHandler) LoginAdmin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, err := h.service.AuthenticateAdmin(ctx, req.Name, req.Password)
+	result, err := h.service.AuthenticateAdmin(ctx, req.Name, req.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		loginError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *AuthHandler) LoginVendor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(withSessionClient(r.Context(), r), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req loginVendorRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.AuthenticateVendor(ctx, req.Name, req.Password)
+	if err != nil {
+		loginError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *AuthHandler) LoginPos(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(withSessionClient(r.Context(), r), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req loginPosRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, refreshToken, err := h.service.AuthenticatePos(ctx, req.VendorID, req.Name, req.Password)
+	if err != nil {
+		loginError(w, err)
 		return
 	}
 
@@ -65,13 +131,50 @@ func (h *AuthHandler) LoginAdmin(w http.ResponseWriter, r *http.Request) {
 	io.Copy(io.Discard, r.Body)
 }
 
-func (h *AuthHandler) LoginVendor(w http.ResponseWriter, r *http.Request) {
+type pairDeviceRequest struct {
+	Code string `json:"code"`
+	Name string `json:"name"` // Shown to the vendor when approving the device
+}
+
+// PairDevice exchanges a pairing code from the vendor for a device credential
+func (h *AuthHandler) PairDevice(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 	r = r.WithContext(ctx)
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 
-	var req loginVendorRequest
+	var req pairDeviceRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	device, httpErr := h.service.PairDevice(ctx, req.Code, req.Name)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(device)
+	io.Copy(io.Discard, r.Body)
+}
+
+type loginDeviceRequest struct {
+	DeviceID     uint   `json:"device_id"`
+	DeviceSecret string `json:"device_secret"`
+}
+
+// LoginDevice logs a paired device in to its POS, with 403 while the vendor has not approved it
+func (h *AuthHandler) LoginDevice(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(withSessionClient(r.Context(), r), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req loginDeviceRequest
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 	if err := dec.Decode(&req); err != nil {
@@ -79,9 +182,9 @@ func (h *AuthHandler) LoginVendor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, err := h.service.AuthenticateVendor(ctx, req.Name, req.Password)
+	accessToken, refreshToken, err := h.service.AuthenticateDevice(ctx, req.DeviceID, req.DeviceSecret)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		loginError(w, err)
 		return
 	}
 
@@ -95,13 +198,19 @@ func (h *AuthHandler) LoginVendor(w http.ResponseWriter, r *http.Request) {
 	io.Copy(io.Discard, r.Body)
 }
 
-func (h *AuthHandler) LoginPos(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+type loginStaffRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// LoginStaff logs a staff member in on the POS whose token authenticates the request
+func (h *AuthHandler) LoginStaff(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(withSessionClient(r.Context(), r), 5*time.Second)
 	defer cancel()
 	r = r.WithContext(ctx)
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 
-	var req loginPosRequest
+	var req loginStaffRequest
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 	if err := dec.Decode(&req); err != nil {
@@ -109,9 +218,18 @@ func (h *AuthHandler) LoginPos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, err := h.service.AuthenticatePos(ctx, req.VendorID, req.Name, req.Password)
+	role, _ := r.Context().Value(models.ClaimsRoleKey).(string)
+	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
+	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
+	passwordVersion, _ := r.Context().Value(models.ClaimsPasswordVersionKey).(uint32)
+	if role != "pos" || vendorIDPtr == nil || posIDPtr == nil {
+		http.Error(w, "Staff log in on a POS", http.StatusForbidden)
+		return
+	}
+
+	accessToken, refreshToken, err := h.service.AuthenticateStaff(ctx, *vendorIDPtr, *posIDPtr, passwordVersion, req.Name, req.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		loginError(w, err)
 		return
 	}
 
@@ -135,7 +253,7 @@ type RefreshTokenResponse struct {
 }
 
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(withSessionClient(r.Context(), r), 5*time.Second)
 	defer cancel()
 	r = r.WithContext(ctx)
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
@@ -149,33 +267,9 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse the refresh token to extract claims
-	token, err := jwt.Parse(req.RefreshToken, func(token *jwt.Token) (interface{}, error) {
-		// You may want to check the signing method here
-		return []byte(h.service.config.JWTRefreshSecret), nil
-	})
-
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
-		return
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-		return
-	}
-
-	role, _ := claims["role"].(string)
-	vendorID := uint(claims["vendor_id"].(float64))
-	passwordVersion := uint32(claims["password_version"].(float64))
-	posID := uint(claims["pos_id"].(float64))
-
-	print(role, vendorID, passwordVersion, posID)
-
-	accessToken, refreshToken, err := h.service.RefreshToken(ctx, req.RefreshToken, vendorID, role, passwordVersion, posID)
+	accessToken, refreshToken, err := h.service.RefreshToken(ctx, req.RefreshToken)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
@@ -196,7 +290,7 @@ type UpdatePasswordRequest struct {
 }
 
 func (h *AuthHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(withSessionClient(r.Context(), r), 5*time.Second)
 	defer cancel()
 	r = r.WithContext(ctx)
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
@@ -212,8 +306,28 @@ func (h *AuthHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 	role, _ := r.Context().Value(models.ClaimsRoleKey).(string)
 	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
 	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
+	staffIDPtr, _ := r.Context().Value(models.ClaimsStaffIDKey).(*uint)
+	adminIDPtr, _ := r.Context().Value(models.ClaimsAdminIDKey).(*uint)
 
 	switch role {
+	case "admin":
+		// Admins update their own password, other admins are reset through /admin/admins/password
+		if adminIDPtr == nil {
+			http.Error(w, "Invalid admin_id claim", http.StatusUnauthorized)
+			return
+		}
+		accessToken, refreshToken, err := h.service.UpdateAdminPassword(ctx, *adminIDPtr, req.CurrentPassword, req.NewPassword)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		resp := loginResponse{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+		return
 	case "vendor":
 		if req.PosID != nil {
 			// Vendor updating POS password
@@ -258,6 +372,22 @@ func (h *AuthHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid pos_id claim", http.StatusUnauthorized)
 			return
 		}
+		// A staff member logged in on the POS updates their own password instead
+		if staffIDPtr != nil {
+			passwordVersion, _ := r.Context().Value(models.ClaimsPasswordVersionKey).(uint32)
+			accessToken, refreshToken, err := h.service.UpdateStaffPassword(ctx, *staffIDPtr, *vendorIDPtr, *posIDPtr, passwordVersion, req.CurrentPassword, req.NewPassword)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			resp := loginResponse{
+				AccessToken:  accessToken,
+				RefreshToken: refreshToken,
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
 		accessToken, refreshToken, err := h.service.UpdatePosPassword(ctx, *posIDPtr, *vendorIDPtr, req.CurrentPassword, req.NewPassword)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
@@ -275,3 +405,289 @@ func (h *AuthHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Unauthorized", http.StatusUnauthorized)
 	io.Copy(io.Discard, r.Body)
 }
+
+type loginTwoFactorRequest struct {
+	PreAuthToken string `json:"pre_auth_token"`
+	Code         string `json:"code"` // TOTP or recovery code
+}
+
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(withSessionClient(r.Context(), r), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req loginTwoFactorRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, refreshToken, err := h.service.CompleteLogin(ctx, req.PreAuthToken, req.Code)
+	if err != nil {
+		loginError(w, err)
+		return
+	}
+
+	resp := loginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+	io.Copy(io.Discard, r.Body)
+}
+
+// twoFactorAccount returns the admin or vendor account of the caller, POS and staff have no 2FA
+// and do not manage sessions
+func twoFactorAccount(r *http.Request) (role string, accountID uint, ok bool) {
+	role, _ = r.Context().Value(models.ClaimsRoleKey).(string)
+	var idPtr *uint
+	switch role {
+	case "admin":
+		idPtr, _ = r.Context().Value(models.ClaimsAdminIDKey).(*uint)
+	case "vendor":
+		idPtr, _ = r.Context().Value(models.ClaimsVendorIDKey).(*uint)
+	}
+	if idPtr == nil {
+		return "", 0, false
+	}
+	return role, *idPtr, true
+}
+
+func (h *AuthHandler) GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	role, accountID, ok := twoFactorAccount(r)
+	if !ok {
+		http.Error(w, "Two-factor authentication is only available for admins and vendors", http.StatusForbidden)
+		return
+	}
+
+	status, httpErr := h.service.GetTwoFactorStatus(ctx, role, accountID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func (h *AuthHandler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	role, accountID, ok := twoFactorAccount(r)
+	if !ok {
+		http.Error(w, "Two-factor authentication is only available for admins and vendors", http.StatusForbidden)
+		return
+	}
+
+	setup, httpErr := h.service.StartTwoFactorSetup(ctx, role, accountID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(setup)
+	io.Copy(io.Discard, r.Body)
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *AuthHandler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req twoFactorCodeRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, accountID, ok := twoFactorAccount(r)
+	if !ok {
+		http.Error(w, "Two-factor authentication is only available for admins and vendors", http.StatusForbidden)
+		return
+	}
+
+	codes, httpErr := h.service.EnableTwoFactor(ctx, role, accountID, req.Code)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: codes})
+	io.Copy(io.Discard, r.Body)
+}
+
+type disableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func (h *AuthHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req disableTwoFactorRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, accountID, ok := twoFactorAccount(r)
+	if !ok {
+		http.Error(w, "Two-factor authentication is only available for admins and vendors", http.StatusForbidden)
+		return
+	}
+
+	httpErr := h.service.DisableTwoFactor(ctx, role, accountID, req.Password, req.Code)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := "Two-factor authentication disabled"
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req twoFactorCodeRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, accountID, ok := twoFactorAccount(r)
+	if !ok {
+		http.Error(w, "Two-factor authentication is only available for admins and vendors", http.StatusForbidden)
+		return
+	}
+
+	codes, httpErr := h.service.RegenerateRecoveryCodes(ctx, role, accountID, req.Code)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: codes})
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	role, accountID, ok := twoFactorAccount(r)
+	if !ok {
+		http.Error(w, "Sessions are only managed by admins and vendors", http.StatusForbidden)
+		return
+	}
+	sessionID, _ := r.Context().Value(models.ClaimsSessionIDKey).(string)
+
+	sessions, httpErr := h.service.ListSessions(ctx, role, accountID, sessionID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sessions)
+}
+
+type revokeSessionRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req revokeSessionRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, accountID, ok := twoFactorAccount(r)
+	if !ok {
+		http.Error(w, "Sessions are only managed by admins and vendors", http.StatusForbidden)
+		return
+	}
+
+	httpErr := h.service.RevokeSession(ctx, role, accountID, req.SessionID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := "Session revoked"
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+	io.Copy(io.Discard, r.Body)
+}
+
+// Logout revokes the session of the caller, for every role
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	sessionID, _ := r.Context().Value(models.ClaimsSessionIDKey).(string)
+	httpErr := h.service.Logout(ctx, sessionID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := "Logged out"
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+	io.Copy(io.Discard, r.Body)
+}
+
+// JWKS publishes the public keys tokens are verified with, for services checking them
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_, _ = w.Write(h.service.keyring.JWKS())
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/ratelimit"
+)
+
+// loginAccount names an account for the failed login counters. POS and staff names are only
+// unique per vendor.
+func loginAccount(role string, vendorID uint, name string) string {
+	if vendorID != 0 {
+		return fmt.Sprintf("%s:%d:%s", role, vendorID, name)
+	}
+	return role + ":" + name
+}
+
+// clientAddr is the address of the request, remembered by withSessionClient
+func clientAddr(ctx context.Context) string {
+	client, _ := ctx.Value(sessionClientKey{}).(sessionClient)
+	return client.remoteAddr
+}
+
+// checkLogin refuses the attempt while the account or the IP has to wait after failed logins
+func (s *AuthService) checkLogin(ctx context.Context, account string) error {
+	err := s.limiter.CheckLogin(ctx, account, clientAddr(ctx))
+	if err == nil {
+		return nil
+	}
+	var locked *ratelimit.LockedError
+	if errors.As(err, &locked) {
+		return err
+	}
+	log.Printf("Error checking failed logins: %v", err)
+	return errors.New("failed to check login attempts")
+}
+
+// loginFailed counts a failed attempt. notifyOwner tells the owner of the account when this
+// attempt locked it, it is nil for names that do not exist.
+func (s *AuthService) loginFailed(ctx context.Context, account string, notifyOwner func(subject string, message string)) {
+	locked, err := s.limiter.LoginFailed(ctx, account, clientAddr(ctx))
+	if err != nil {
+		log.Printf("Error recording failed login: %v", err)
+		return
+	}
+	if !locked || notifyOwner == nil {
+		return
+	}
+	notifyOwner("Login locked", fmt.Sprintf(
+		"Logins to %s are locked for %s after %d failed attempts, the last one from %s. If these were not yours, change the password once the lock ends.",
+		account, s.config.LoginLockoutDuration, s.config.LoginLockoutThreshold, ratelimit.ClientIP(clientAddr(ctx)),
+	))
+}
+
+func (s *AuthService) loginSucceeded(ctx context.Context, account string) {
+	if err := s.limiter.LoginSucceeded(ctx, account); err != nil {
+		log.Printf("Error resetting failed logins: %v", err)
+	}
+}
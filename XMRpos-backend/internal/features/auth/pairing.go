@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/ratelimit"
+	"gorm.io/gorm"
+)
+
+// errDeviceNotApproved is answered with 403 so the device knows to keep waiting
+var errDeviceNotApproved = errors.New("device is waiting for approval by the vendor")
+
+// PairedDevice is the credential a device receives for a pairing code. The secret is only shown
+// this once.
+type PairedDevice struct {
+	DeviceID     uint   `json:"device_id"`
+	DeviceSecret string `json:"device_secret"`
+	VendorID     uint   `json:"vendor_id"`
+	PosID        uint   `json:"pos_id"`
+	Status       string `json:"status"`
+}
+
+// PairDevice exchanges a pairing code for a device credential. The device stays pending, and
+// cannot log in, until the vendor approves it.
+func (s *AuthService) PairDevice(ctx context.Context, code string, name string) (*PairedDevice, *models.HTTPError) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	name = strings.TrimSpace(name)
+	if len(name) < 1 || len(name) > 50 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "device name must be at least 1 character and no more than 50 characters")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error generating device secret: "+err.Error())
+	}
+	secret := hex.EncodeToString(raw)
+
+	device := &models.PosDevice{
+		Name:       name,
+		SecretHash: hashToken(secret),
+	}
+	if err := s.repo.ClaimPairingCode(ctx, models.HashPairingCode(code), device); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "invalid or expired pairing code")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error pairing device: "+err.Error())
+	}
+
+	s.notifier.NotifyVendor(ctx, device.VendorID, "Device waiting for approval",
+		"The device \""+device.Name+"\" was paired with one of your POS and can log in once you approve it.")
+
+	return &PairedDevice{
+		DeviceID:     device.ID,
+		DeviceSecret: secret,
+		VendorID:     device.VendorID,
+		PosID:        device.PosID,
+		Status:       device.Status,
+	}, nil
+}
+
+// AuthenticateDevice logs an approved device in to its POS. Its sessions remember the device, so
+// revoking it ends them.
+//
+// Device IDs are sequential, so failures are counted per device and client IP: guessing against
+// a device ID from elsewhere locks out that IP, never the device itself. The IP's own counter
+// still stops guessing across many devices.
+func (s *AuthService) AuthenticateDevice(ctx context.Context, deviceID uint, secret string) (accessToken string, refreshToken string, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	account := loginAccount("device", 0, strconv.FormatUint(uint64(deviceID), 10)+"@"+ratelimit.ClientIP(clientAddr(ctx)))
+	if err := s.checkLogin(ctx, account); err != nil {
+		return "", "", err
+	}
+
+	device, err := s.repo.FindPosDevice(ctx, deviceID)
+	if err != nil || subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(device.SecretHash)) != 1 {
+		s.loginFailed(ctx, account, nil)
+		return "", "", errors.New("invalid credentials")
+	}
+	s.loginSucceeded(ctx, account)
+
+	switch device.Status {
+	case models.PosDeviceStatusApproved:
+	case models.PosDeviceStatusPending:
+		return "", "", errDeviceNotApproved
+	default:
+		return "", "", errors.New("device was revoked")
+	}
+
+	pos, err := s.repo.FindPosByID(ctx, device.PosID)
+	if err != nil || pos.VendorID != device.VendorID {
+		return "", "", errors.New("invalid credentials")
+	}
+	s.touchDevice(ctx, device.ID)
+
+	session := &models.RefreshSession{Role: "pos", AccountID: pos.ID, VendorID: &pos.VendorID, DeviceID: &device.ID}
+	accessToken, refreshToken, err = s.generatePosToken(ctx, session, pos.VendorID, pos.ID, pos.PasswordVersion)
+	if err != nil {
+		return "", "", errors.New("failed to generate tokens")
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// checkDevice refuses to refresh the session of a device that was revoked meanwhile
+func (s *AuthService) checkDevice(ctx context.Context, session *models.RefreshSession) error {
+	if session.DeviceID == nil {
+		return nil
+	}
+	device, err := s.repo.FindPosDevice(ctx, *session.DeviceID)
+	if err != nil || device.Status != models.PosDeviceStatusApproved || device.PosID != session.AccountID {
+		return errors.New("device was revoked")
+	}
+	s.touchDevice(ctx, device.ID)
+	return nil
+}
+
+// callerDevice is the paired device of the session making the request, so the sessions it opens
+// for staff members or after a password change end with the device too
+func (s *AuthService) callerDevice(ctx context.Context) *uint {
+	sessionID, _ := ctx.Value(models.ClaimsSessionIDKey).(string)
+	if sessionID == "" {
+		return nil
+	}
+	session, err := s.repo.FindSession(ctx, sessionID)
+	if err != nil {
+		return nil
+	}
+	return session.DeviceID
+}
+
+func (s *AuthService) touchDevice(ctx context.Context, deviceID uint) {
+	if err := s.repo.TouchPosDevice(ctx, deviceID); err != nil {
+		log.Printf("Error updating last seen of device %d: %v", deviceID, err)
+	}
+}
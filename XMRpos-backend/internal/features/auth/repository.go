@@ -2,9 +2,12 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuthRepository interface {
@@ -14,6 +17,35 @@ type AuthRepository interface {
 	FindPosByID(ctx context.Context, id uint) (*models.Pos, error)
 	UpdateVendorPasswordHash(ctx context.Context, vendorID uint, newPasswordHash string) (uint32, error)
 	UpdatePosPasswordHash(ctx context.Context, posID uint, newPasswordHash string) (uint32, error)
+	FindAdminByName(ctx context.Context, name string) (*models.Admin, error)
+	FindAdminByID(ctx context.Context, id uint) (*models.Admin, error)
+	UpdateAdminPasswordHash(ctx context.Context, adminID uint, newPasswordHash string) (uint32, error)
+	FindTwoFactor(ctx context.Context, role string, accountID uint) (*models.TwoFactor, error)
+	TwoFactorEnabled(ctx context.Context, role string, accountID uint) (bool, error)
+	ResetTwoFactor(ctx context.Context, role string, accountID uint, secret string) error
+	EnableTwoFactor(ctx context.Context, twoFactorID uint, counter int64, codeHashes []string) error
+	UseTOTPCounter(ctx context.Context, twoFactorID uint, counter int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, role string, accountID uint, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, role string, accountID uint, codeHashes []string) error
+	CountUnusedRecoveryCodes(ctx context.Context, role string, accountID uint) (int64, error)
+	DeleteTwoFactor(ctx context.Context, role string, accountID uint) error
+	FindVendorRole(ctx context.Context, vendorID uint, name string) (*models.VendorRole, error)
+	FindStaffByVendorIDAndName(ctx context.Context, vendorID uint, name string) (*models.Staff, error)
+	FindStaffByID(ctx context.Context, id uint) (*models.Staff, error)
+	UpdateStaffPasswordHash(ctx context.Context, staffID uint, newPasswordHash string) (uint32, error)
+	CreateSession(ctx context.Context, session *models.RefreshSession) error
+	FindSession(ctx context.Context, sessionID string) (*models.RefreshSession, error)
+	RotateSession(ctx context.Context, session *models.RefreshSession, previousGeneration uint32) (bool, error)
+	SessionActive(ctx context.Context, sessionID string) (bool, error)
+	ListSessions(ctx context.Context, role string, accountID uint) ([]models.RefreshSession, error)
+	RevokeSession(ctx context.Context, sessionID string, reason string) error
+	RevokeAccountSessions(ctx context.Context, role string, accountID uint, reason string) error
+	RevokeStaffSessions(ctx context.Context, staffID uint, reason string) error
+	ClaimPairingCode(ctx context.Context, codeHash string, device *models.PosDevice) error
+	FindPosDevice(ctx context.Context, id uint) (*models.PosDevice, error)
+	TouchPosDevice(ctx context.Context, id uint) error
+	FindAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id uint, ip string) error
 }
 
 type authRepository struct {
@@ -113,3 +145,398 @@ func (r *authRepository) UpdatePosPasswordHash(ctx context.Context, posID uint,
 	}
 	return pos.PasswordVersion, nil
 }
+
+func (r *authRepository) FindVendorRole(ctx context.Context, vendorID uint, name string) (*models.VendorRole, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var role models.VendorRole
+	if err := r.db.WithContext(ctx).Where("vendor_id = ? AND name = ?", vendorID, name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *authRepository) FindStaffByVendorIDAndName(ctx context.Context, vendorID uint, name string) (*models.Staff, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var staff models.Staff
+	if err := r.db.WithContext(ctx).Where("vendor_id = ? AND name = ?", vendorID, name).First(&staff).Error; err != nil {
+		return nil, err
+	}
+	return &staff, nil
+}
+
+func (r *authRepository) FindStaffByID(ctx context.Context, id uint) (*models.Staff, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var staff models.Staff
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&staff).Error; err != nil {
+		return nil, err
+	}
+	return &staff, nil
+}
+
+func (r *authRepository) UpdateStaffPasswordHash(ctx context.Context, staffID uint, newPasswordHash string) (passwordVersion uint32, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Update password and increment password_version
+	err = r.db.WithContext(ctx).Model(&models.Staff{}).
+		Where("id = ?", staffID).
+		Updates(map[string]interface{}{
+			"password_hash":    newPasswordHash,
+			"password_version": gorm.Expr("password_version + 1"),
+		}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// Fetch the new password_version
+	var staff models.Staff
+	if err := r.db.WithContext(ctx).Select("password_version").Where("id = ?", staffID).First(&staff).Error; err != nil {
+		return 0, err
+	}
+	return staff.PasswordVersion, nil
+}
+
+func (r *authRepository) FindAdminByName(ctx context.Context, name string) (*models.Admin, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var admin models.Admin
+	if err := r.db.WithContext(ctx).Where("name = ?", name).First(&admin).Error; err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+func (r *authRepository) FindAdminByID(ctx context.Context, id uint) (*models.Admin, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var admin models.Admin
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&admin).Error; err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+func (r *authRepository) UpdateAdminPasswordHash(ctx context.Context, adminID uint, newPasswordHash string) (passwordVersion uint32, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Update password and increment password_version
+	err = r.db.WithContext(ctx).Model(&models.Admin{}).
+		Where("id = ?", adminID).
+		Updates(map[string]interface{}{
+			"password_hash":    newPasswordHash,
+			"password_version": gorm.Expr("password_version + 1"),
+		}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// Fetch the new password_version
+	var admin models.Admin
+	if err := r.db.WithContext(ctx).Select("password_version").Where("id = ?", adminID).First(&admin).Error; err != nil {
+		return 0, err
+	}
+	return admin.PasswordVersion, nil
+}
+
+func (r *authRepository) FindTwoFactor(ctx context.Context, role string, accountID uint) (*models.TwoFactor, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var twoFactor models.TwoFactor
+	if err := r.db.WithContext(ctx).Where("role = ? AND account_id = ?", role, accountID).First(&twoFactor).Error; err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+func (r *authRepository) TwoFactorEnabled(ctx context.Context, role string, accountID uint) (bool, error) {
+	twoFactor, err := r.FindTwoFactor(ctx, role, accountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return twoFactor.Enabled, nil
+}
+
+// ResetTwoFactor replaces the account's two-factor state with a new, not yet enabled secret
+func (r *authRepository) ResetTwoFactor(ctx context.Context, role string, accountID uint, secret string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("role = ? AND account_id = ?", role, accountID).Delete(&models.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TwoFactor{Role: role, AccountID: accountID, Secret: secret}).Error
+	})
+}
+
+// EnableTwoFactor turns on the confirmed secret and stores fresh recovery codes
+func (r *authRepository) EnableTwoFactor(ctx context.Context, twoFactorID uint, counter int64, codeHashes []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var twoFactor models.TwoFactor
+		if err := tx.Where("id = ?", twoFactorID).First(&twoFactor).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&twoFactor).Updates(map[string]interface{}{
+			"enabled":      true,
+			"last_counter": counter,
+		}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, twoFactor.Role, twoFactor.AccountID, codeHashes)
+	})
+}
+
+// UseTOTPCounter records the period of an accepted code. It fails when a code of the same or a
+// later period was already used, so concurrent logins cannot reuse a code.
+func (r *authRepository) UseTOTPCounter(ctx context.Context, twoFactorID uint, counter int64) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Model(&models.TwoFactor{}).
+		Where("id = ? AND last_counter < ?", twoFactorID, counter).
+		Update("last_counter", counter)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *authRepository) UseRecoveryCode(ctx context.Context, role string, accountID uint, codeHash string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("role = ? AND account_id = ? AND code_hash = ? AND used_at IS NULL", role, accountID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *authRepository) ReplaceRecoveryCodes(ctx context.Context, role string, accountID uint, codeHashes []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, role, accountID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, role string, accountID uint, codeHashes []string) error {
+	if err := tx.Where("role = ? AND account_id = ?", role, accountID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.RecoveryCode{Role: role, AccountID: accountID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+func (r *authRepository) CountUnusedRecoveryCodes(ctx context.Context, role string, accountID uint) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("role = ? AND account_id = ? AND used_at IS NULL", role, accountID).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *authRepository) DeleteTwoFactor(ctx context.Context, role string, accountID uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("role = ? AND account_id = ?", role, accountID).Delete(&models.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("role = ? AND account_id = ?", role, accountID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+func (r *authRepository) CreateSession(ctx context.Context, session *models.RefreshSession) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *authRepository) FindSession(ctx context.Context, sessionID string) (*models.RefreshSession, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var session models.RefreshSession
+	if err := r.db.WithContext(ctx).Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RotateSession stores the new token of the session, unless another refresh rotated it first
+func (r *authRepository) RotateSession(ctx context.Context, session *models.RefreshSession, previousGeneration uint32) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Model(&models.RefreshSession{}).
+		Where("id = ? AND generation = ? AND revoked_at IS NULL", session.ID, previousGeneration).
+		Updates(map[string]interface{}{
+			"generation":   session.Generation,
+			"token_hash":   session.TokenHash,
+			"user_agent":   session.UserAgent,
+			"remote_addr":  session.RemoteAddr,
+			"last_used_at": session.LastUsedAt,
+			"expires_at":   session.ExpiresAt,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *authRepository) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.RefreshSession{}).
+		Where("session_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListSessions returns the active sessions of an admin, or of a vendor with those of its POS
+func (r *authRepository) ListSessions(ctx context.Context, role string, accountID uint) ([]models.RefreshSession, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := r.db.WithContext(ctx).Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+	if role == "vendor" {
+		query = query.Where("vendor_id = ?", accountID)
+	} else {
+		query = query.Where("role = ? AND account_id = ?", role, accountID)
+	}
+	var sessions []models.RefreshSession
+	if err := query.Order("last_used_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *authRepository) RevokeSession(ctx context.Context, sessionID string, reason string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Model(&models.RefreshSession{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+func (r *authRepository) RevokeAccountSessions(ctx context.Context, role string, accountID uint, reason string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Model(&models.RefreshSession{}).
+		Where("role = ? AND account_id = ? AND revoked_at IS NULL", role, accountID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+func (r *authRepository) RevokeStaffSessions(ctx context.Context, staffID uint, reason string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Model(&models.RefreshSession{}).
+		Where("staff_id = ? AND revoked_at IS NULL", staffID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// ClaimPairingCode uses up an unexpired pairing code and creates the pending device for its POS.
+// A code that is unknown, expired or already used returns gorm.ErrRecordNotFound.
+func (r *authRepository) ClaimPairingCode(ctx context.Context, codeHash string, device *models.PosDevice) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var code models.PairingCode
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", codeHash, time.Now()).
+			First(&code).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&code).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		device.VendorID = code.VendorID
+		device.PosID = code.PosID
+		device.Status = models.PosDeviceStatusPending
+		return tx.Create(device).Error
+	})
+}
+
+func (r *authRepository) FindPosDevice(ctx context.Context, id uint) (*models.PosDevice, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var device models.PosDevice
+	if err := r.db.WithContext(ctx).First(&device, id).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (r *authRepository) TouchPosDevice(ctx context.Context, id uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Model(&models.PosDevice{}).
+		Where("id = ?", id).
+		Update("last_seen_at", time.Now()).Error
+}
+
+func (r *authRepository) FindAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// TouchAPIKey records the use of an API key, at most once a minute so busy integrations do not
+// write on every request
+func (r *authRepository) TouchAPIKey(ctx context.Context, id uint, ip string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	now := time.Now()
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-time.Minute)).
+		Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error
+}
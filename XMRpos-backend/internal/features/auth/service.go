@@ -7,16 +7,23 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/notify"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/ratelimit"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/signing"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService struct {
-	repo   AuthRepository
-	config *config.Config
+	repo     AuthRepository
+	config   *config.Config
+	keyring  *signing.Keyring
+	limiter  *ratelimit.Limiter
+	notifier *notify.Notifier
 }
 
-func NewAuthService(repo AuthRepository, cfg *config.Config) *AuthService {
-	return &AuthService{repo: repo, config: cfg}
+func NewAuthService(repo AuthRepository, cfg *config.Config, keyring *signing.Keyring, limiter *ratelimit.Limiter, notifier *notify.Notifier) *AuthService {
+	return &AuthService{repo: repo, config: cfg, keyring: keyring, limiter: limiter, notifier: notifier}
 }
 
 /*
@@ -34,58 +41,116 @@ func NewAuthService(repo AuthRepository, cfg *config.Config) *AuthService {
 		return s.repo.CreateDevice(device)
 	}
 */
-func (s *AuthService) AuthenticateAdmin(ctx context.Context, name string, password string) (accessToken string, refreshToken string, err error) {
+// AuthenticateAdmin checks the password. With two-factor authentication enabled only a pre-auth
+// token is returned, exchanged for the tokens at /auth/login-2fa.
+func (s *AuthService) AuthenticateAdmin(ctx context.Context, name string, password string) (*LoginResult, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
-	if name != s.config.AdminName || password != s.config.AdminPassword {
-		return "", "", errors.New("invalid credentials")
+	account := loginAccount("admin", 0, name)
+	if err := s.checkLogin(ctx, account); err != nil {
+		return nil, err
 	}
 
-	accessToken, refreshToken, err = s.generateAdminToken()
+	admin, err := s.repo.FindAdminByName(ctx, name)
 	if err != nil {
-		return "", "", errors.New("failed to generate tokens")
+		s.loginFailed(ctx, account, nil)
+		return nil, errors.New("invalid credentials")
 	}
 
-	return accessToken, refreshToken, nil
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password)); err != nil {
+		s.loginFailed(ctx, account, func(subject string, message string) {
+			s.notifier.NotifyAdmin(ctx, subject, message)
+		})
+		return nil, errors.New("invalid credentials")
+	}
+
+	enabled, err := s.repo.TwoFactorEnabled(ctx, "admin", admin.ID)
+	if err != nil {
+		return nil, errors.New("failed to check two-factor authentication")
+	}
+	if enabled {
+		// Failures are only forgotten once the second factor passed too
+		return s.preAuthResult("admin", admin.ID, admin.PasswordVersion)
+	}
+	s.loginSucceeded(ctx, account)
+
+	accessToken, refreshToken, err := s.generateAdminToken(ctx, nil, admin.ID, admin.PasswordVersion)
+	if err != nil {
+		return nil, errors.New("failed to generate tokens")
+	}
+
+	return &LoginResult{
+		AccessToken:            accessToken,
+		RefreshToken:           refreshToken,
+		TwoFactorSetupRequired: s.config.AdminRequire2FA,
+	}, nil
 }
 
-func (s *AuthService) AuthenticateVendor(ctx context.Context, name string, password string) (accessToken string, refreshToken string, err error) {
+func (s *AuthService) AuthenticateVendor(ctx context.Context, name string, password string) (*LoginResult, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	account := loginAccount("vendor", 0, name)
+	if err := s.checkLogin(ctx, account); err != nil {
+		return nil, err
+	}
+
 	vendor, err := s.repo.FindVendorByName(ctx, name)
 	if err != nil {
-		return "", "", errors.New("invalid credentials")
+		s.loginFailed(ctx, account, nil)
+		return nil, errors.New("invalid credentials")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(vendor.PasswordHash), []byte(password)); err != nil {
-		return "", "", errors.New("invalid credentials")
+		s.loginFailed(ctx, account, func(subject string, message string) {
+			s.notifier.NotifyVendor(ctx, vendor.ID, subject, message)
+		})
+		return nil, errors.New("invalid credentials")
 	}
 
-	accessToken, refreshToken, err = s.generateVendorToken(vendor.ID, vendor.PasswordVersion)
+	enabled, err := s.repo.TwoFactorEnabled(ctx, "vendor", vendor.ID)
 	if err != nil {
-		return "", "", errors.New("failed to generate tokens")
+		return nil, errors.New("failed to check two-factor authentication")
+	}
+	if enabled {
+		return s.preAuthResult("vendor", vendor.ID, vendor.PasswordVersion)
 	}
+	s.loginSucceeded(ctx, account)
 
-	return accessToken, refreshToken, nil
+	accessToken, refreshToken, err := s.generateVendorToken(ctx, nil, vendor.ID, vendor.PasswordVersion)
+	if err != nil {
+		return nil, errors.New("failed to generate tokens")
+	}
+
+	return &LoginResult{AccessToken: accessToken, RefreshToken: refreshToken}, nil
 }
 
 func (s *AuthService) AuthenticatePos(ctx context.Context, vendorID uint, name string, password string) (accessToken string, refreshToken string, err error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	account := loginAccount("pos", vendorID, name)
+	if err := s.checkLogin(ctx, account); err != nil {
+		return "", "", err
+	}
+
 	pos, err := s.repo.FindPosByVendorIDAndName(ctx, vendorID, name)
 	if err != nil {
+		s.loginFailed(ctx, account, nil)
 		return "", "", errors.New("invalid credentials")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(pos.PasswordHash), []byte(password)); err != nil {
+		s.loginFailed(ctx, account, func(subject string, message string) {
+			s.notifier.NotifyVendor(ctx, vendorID, subject, message)
+		})
 		return "", "", errors.New("invalid credentials")
 	}
+	s.loginSucceeded(ctx, account)
 
-	accessToken, refreshToken, err = s.generatePosToken(vendorID, pos.ID, pos.PasswordVersion)
+	accessToken, refreshToken, err = s.generatePosToken(ctx, nil, vendorID, pos.ID, pos.PasswordVersion)
 	if err != nil {
 		return "", "", errors.New("failed to generate tokens")
 	}
@@ -93,6 +158,74 @@ func (s *AuthService) AuthenticatePos(ctx context.Context, vendorID uint, name s
 	return accessToken, refreshToken, nil
 }
 
+// AuthenticateStaff logs a staff member in on the POS the request came from. The POS must belong
+// to the staff member's vendor; the device login stays valid.
+func (s *AuthService) AuthenticateStaff(ctx context.Context, vendorID uint, posID uint, posPasswordVersion uint32, name string, password string) (accessToken string, refreshToken string, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	account := loginAccount("staff", vendorID, name)
+	if err := s.checkLogin(ctx, account); err != nil {
+		return "", "", err
+	}
+
+	staff, err := s.repo.FindStaffByVendorIDAndName(ctx, vendorID, name)
+	if err != nil {
+		s.loginFailed(ctx, account, nil)
+		return "", "", errors.New("invalid credentials")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(staff.PasswordHash), []byte(password)); err != nil {
+		s.loginFailed(ctx, account, func(subject string, message string) {
+			s.notifier.NotifyVendor(ctx, vendorID, subject, message)
+		})
+		return "", "", errors.New("invalid credentials")
+	}
+	s.loginSucceeded(ctx, account)
+
+	session := &models.RefreshSession{Role: "pos", AccountID: posID, VendorID: &vendorID, StaffID: &staff.ID, DeviceID: s.callerDevice(ctx)}
+	accessToken, refreshToken, err = s.generateStaffToken(ctx, session, vendorID, posID, posPasswordVersion, staff.ID, staff.PasswordVersion)
+	if err != nil {
+		return "", "", errors.New("failed to generate tokens")
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+func (s *AuthService) UpdateAdminPassword(ctx context.Context, adminID uint, currentPassword string, newPassword string) (accessToken string, newRefreshToken string, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// check if the old password is correct
+	admin, err := s.repo.FindAdminByID(ctx, adminID)
+	if err != nil {
+		return "", "", errors.New("admin not found")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(currentPassword)); err != nil {
+		return "", "", errors.New("invalid current password")
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+
+	passwordVersion, err := s.repo.UpdateAdminPasswordHash(ctx, adminID, string(hashedPassword))
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.repo.RevokeAccountSessions(ctx, "admin", adminID, "password"); err != nil {
+		return "", "", err
+	}
+
+	accessToken, newRefreshToken, err = s.generateAdminToken(ctx, nil, adminID, passwordVersion)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, newRefreshToken, nil
+}
+
 func (s *AuthService) UpdateVendorPassword(ctx context.Context, vendorID uint, currentPassword string, newPassword string) (accessToken string, newRefreshToken string, err error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -115,8 +248,11 @@ func (s *AuthService) UpdateVendorPassword(ctx context.Context, vendorID uint, c
 	if err != nil {
 		return "", "", err
 	}
+	if err := s.repo.RevokeAccountSessions(ctx, "vendor", vendorID, "password"); err != nil {
+		return "", "", err
+	}
 
-	accessToken, newRefreshToken, err = s.generateVendorToken(vendorID, passwordVersion)
+	accessToken, newRefreshToken, err = s.generateVendorToken(ctx, nil, vendorID, passwordVersion)
 	if err != nil {
 		return "", "", err
 	}
@@ -146,8 +282,47 @@ func (s *AuthService) UpdatePosPassword(ctx context.Context, posID uint, vendorI
 	if err != nil {
 		return "", "", err
 	}
+	if err := s.repo.RevokeAccountSessions(ctx, "pos", posID, "password"); err != nil {
+		return "", "", err
+	}
+
+	session := &models.RefreshSession{Role: "pos", AccountID: posID, VendorID: &vendorID, DeviceID: s.callerDevice(ctx)}
+	accessToken, newRefreshToken, err = s.generatePosToken(ctx, session, vendorID, posID, passwordVersion)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, newRefreshToken, nil
+}
+
+func (s *AuthService) UpdateStaffPassword(ctx context.Context, staffID uint, vendorID uint, posID uint, posPasswordVersion uint32, currentPassword string, newPassword string) (accessToken string, newRefreshToken string, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// check if the old password is correct
+	staff, err := s.repo.FindStaffByID(ctx, staffID)
+	if err != nil {
+		return "", "", errors.New("staff not found")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(staff.PasswordHash), []byte(currentPassword)); err != nil {
+		return "", "", errors.New("invalid current password")
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+
+	passwordVersion, err := s.repo.UpdateStaffPasswordHash(ctx, staffID, string(hashedPassword))
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.repo.RevokeStaffSessions(ctx, staffID, "password"); err != nil {
+		return "", "", err
+	}
 
-	accessToken, newRefreshToken, err = s.generatePosToken(vendorID, posID, passwordVersion)
+	session := &models.RefreshSession{Role: "pos", AccountID: posID, VendorID: &vendorID, StaffID: &staffID, DeviceID: s.callerDevice(ctx)}
+	accessToken, newRefreshToken, err = s.generateStaffToken(ctx, session, vendorID, posID, posPasswordVersion, staffID, passwordVersion)
 	if err != nil {
 		return "", "", err
 	}
@@ -169,8 +344,11 @@ func (s *AuthService) UpdatePosPasswordFromVendor(ctx context.Context, posID uin
 	if err != nil {
 		return "", "", err
 	}
+	if err := s.repo.RevokeAccountSessions(ctx, "pos", posID, "password"); err != nil {
+		return "", "", err
+	}
 
-	accessToken, newRefreshToken, err = s.generatePosToken(vendorID, posID, passwordVersion)
+	accessToken, newRefreshToken, err = s.generatePosToken(ctx, nil, vendorID, posID, passwordVersion)
 	if err != nil {
 		return "", "", err
 	}
@@ -178,128 +356,119 @@ func (s *AuthService) UpdatePosPasswordFromVendor(ctx context.Context, posID uin
 	return accessToken, newRefreshToken, nil
 }
 
-func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string, vendorID uint, role string, passwordVersion uint32, posID uint) (accessToken string, newRefreshToken string, err error) {
+// RefreshToken rotates the refresh token of a session. The account behind it must still exist
+// with the password the session was opened with.
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (accessToken string, newRefreshToken string, err error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return []byte(s.config.JWTRefreshSecret), nil
-	})
 
-	if err != nil || !token.Valid {
-		return "", "", errors.New("invalid refresh token")
+	session, claims, err := s.useRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return "", "", err
 	}
+	passwordVersionClaim, _ := claims["password_version"].(float64)
+	staffVersionClaim, _ := claims["staff_version"].(float64)
+	passwordVersion, staffVersion := uint32(passwordVersionClaim), uint32(staffVersionClaim)
 
-	switch role {
+	switch session.Role {
 	case "admin":
-		return s.generateAdminToken()
+		// check that the password version matches
+		admin, err := s.repo.FindAdminByID(ctx, session.AccountID)
+		if err != nil {
+			return "", "", errors.New("invalid credentials")
+		}
+		if admin.PasswordVersion != passwordVersion {
+			return "", "", errors.New("token is outdated (password changed)")
+		}
+		return s.generateAdminToken(ctx, session, admin.ID, passwordVersion)
 	case "vendor":
 		// check that the password version matches
-		vendor, err := s.repo.FindVendorByID(ctx, vendorID)
+		vendor, err := s.repo.FindVendorByID(ctx, session.AccountID)
 		if err != nil {
 			return "", "", errors.New("invalid credentials")
 		}
 		if vendor.PasswordVersion != passwordVersion {
 			return "", "", errors.New("token is outdated (password changed)")
 		}
-		return s.generateVendorToken(vendorID, passwordVersion)
+		return s.generateVendorToken(ctx, session, vendor.ID, passwordVersion)
 	case "pos":
 		// check that the password version matches
-		pos, err := s.repo.FindPosByID(ctx, posID)
+		pos, err := s.repo.FindPosByID(ctx, session.AccountID)
 		if err != nil {
 			return "", "", errors.New("invalid credentials")
 		}
 		if pos.PasswordVersion != passwordVersion {
 			return "", "", errors.New("token is outdated (password changed)")
 		}
-		return s.generatePosToken(vendorID, posID, passwordVersion)
+		if err := s.checkDevice(ctx, session); err != nil {
+			return "", "", err
+		}
+		if session.StaffID != nil {
+			// A revoked staff member is not found anymore
+			staff, err := s.repo.FindStaffByID(ctx, *session.StaffID)
+			if err != nil || staff.VendorID != pos.VendorID {
+				return "", "", errors.New("invalid credentials")
+			}
+			if staff.PasswordVersion != staffVersion {
+				return "", "", errors.New("token is outdated (password changed)")
+			}
+			return s.generateStaffToken(ctx, session, pos.VendorID, pos.ID, passwordVersion, staff.ID, staffVersion)
+		}
+		return s.generatePosToken(ctx, session, pos.VendorID, pos.ID, passwordVersion)
 	default:
 		return "", "", errors.New("invalid role in token")
 	}
 }
 
-func (s *AuthService) generateVendorToken(vendorID uint, passwordVersion uint32) (accessToken string, refreshToken string, err error) {
-	accessTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"vendor_id":        vendorID,
-		"role":             "vendor",
-		"password_version": passwordVersion,
-		"exp":              time.Now().Add(time.Minute * 5).Unix(),
-	})
+// The generate functions open a new session when session is nil and rotate it otherwise
 
-	refreshTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+func (s *AuthService) generateVendorToken(ctx context.Context, session *models.RefreshSession, vendorID uint, passwordVersion uint32) (accessToken string, refreshToken string, err error) {
+	if session == nil {
+		session = &models.RefreshSession{Role: "vendor", AccountID: vendorID, VendorID: &vendorID}
+	}
+	return s.signTokens(ctx, session, jwt.MapClaims{
 		"vendor_id":        vendorID,
 		"role":             "vendor",
 		"password_version": passwordVersion,
-	})
-
-	accessToken, err = accessTokenJWT.SignedString([]byte(s.config.JWTSecret))
-	if err != nil {
-		return "", "", err
-	}
-
-	refreshToken, err = refreshTokenJWT.SignedString([]byte(s.config.JWTRefreshSecret))
-	if err != nil {
-		return "", "", err
-	}
-
-	return accessToken, refreshToken, nil
+	}, time.Minute*5)
 }
 
-func (s *AuthService) generatePosToken(vendorID uint, posID uint, passwordVersion uint32) (accessToken string, refreshToken string, err error) {
-	accessTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+func (s *AuthService) generatePosToken(ctx context.Context, session *models.RefreshSession, vendorID uint, posID uint, passwordVersion uint32) (accessToken string, refreshToken string, err error) {
+	if session == nil {
+		session = &models.RefreshSession{Role: "pos", AccountID: posID, VendorID: &vendorID}
+	}
+	return s.signTokens(ctx, session, jwt.MapClaims{
 		"vendor_id":        vendorID,
 		"role":             "pos",
 		"password_version": passwordVersion,
 		"pos_id":           posID,
-		"exp":              time.Now().Add(time.Minute * 5).Unix(),
-	})
+	}, time.Minute*5)
+}
 
-	refreshTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// generateStaffToken issues a POS token that also names the staff member logged in on the device
+func (s *AuthService) generateStaffToken(ctx context.Context, session *models.RefreshSession, vendorID uint, posID uint, passwordVersion uint32, staffID uint, staffVersion uint32) (accessToken string, refreshToken string, err error) {
+	if session == nil {
+		session = &models.RefreshSession{Role: "pos", AccountID: posID, VendorID: &vendorID, StaffID: &staffID}
+	}
+	return s.signTokens(ctx, session, jwt.MapClaims{
 		"vendor_id":        vendorID,
 		"role":             "pos",
 		"password_version": passwordVersion,
 		"pos_id":           posID,
-	})
-
-	accessToken, err = accessTokenJWT.SignedString([]byte(s.config.JWTSecret))
-	if err != nil {
-		return "", "", err
-	}
-
-	refreshToken, err = refreshTokenJWT.SignedString([]byte(s.config.JWTRefreshSecret))
-	if err != nil {
-		return "", "", err
-	}
-
-	return accessToken, refreshToken, nil
+		"staff_id":         staffID,
+		"staff_version":    staffVersion,
+	}, time.Minute*5)
 }
 
-func (s *AuthService) generateAdminToken() (accessToken string, refreshToken string, err error) {
-	accessTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"vendor_id":        0,
-		"role":             "admin",
-		"password_version": 0,
-		"exp":              time.Now().Add(time.Minute * 30).Unix(),
-	})
-
-	refreshTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+func (s *AuthService) generateAdminToken(ctx context.Context, session *models.RefreshSession, adminID uint, passwordVersion uint32) (accessToken string, refreshToken string, err error) {
+	if session == nil {
+		session = &models.RefreshSession{Role: "admin", AccountID: adminID}
+	}
+	return s.signTokens(ctx, session, jwt.MapClaims{
 		"vendor_id":        0,
 		"role":             "admin",
-		"password_version": 0,
-	})
-
-	accessToken, err = accessTokenJWT.SignedString([]byte(s.config.JWTSecret))
-	if err != nil {
-		return "", "", err
-	}
-
-	refreshToken, err = refreshTokenJWT.SignedString([]byte(s.config.JWTRefreshSecret))
-	if err != nil {
-		return "", "", err
-	}
-
-	return accessToken, refreshToken, nil
+		"password_version": passwordVersion,
+		"admin_id":         adminID,
+	}, time.Minute*30)
 }
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/signing"
+	"gorm.io/gorm"
+)
+
+// Session is an active login as shown to its owner
+type Session struct {
+	ID         string    `json:"id"`
+	Role       string    `json:"role"`
+	PosID      *uint     `json:"pos_id,omitempty"`
+	StaffID    *uint     `json:"staff_id,omitempty"`
+	DeviceID   *uint     `json:"device_id,omitempty"` // Paired device the POS session runs on
+	UserAgent  string    `json:"user_agent"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // The session of the token making the request
+}
+
+type sessionClientKey struct{}
+
+type sessionClient struct {
+	userAgent  string
+	remoteAddr string
+}
+
+// withSessionClient remembers the device of the request for the sessions it opens or refreshes
+func withSessionClient(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, sessionClientKey{}, sessionClient{
+		userAgent:  r.UserAgent(),
+		remoteAddr: r.RemoteAddr,
+	})
+}
+
+// signTokens issues the access and refresh tokens of a session. A session without an ID is new
+// and gets created, an existing one is rotated: its generation goes up and only the new refresh
+// token is accepted from then on.
+func (s *AuthService) signTokens(ctx context.Context, session *models.RefreshSession, claims jwt.MapClaims, accessTTL time.Duration) (accessToken string, refreshToken string, err error) {
+	now := time.Now()
+	previousGeneration := session.Generation
+	if session.ID == 0 {
+		session.SessionID, err = newSessionID()
+		if err != nil {
+			return "", "", err
+		}
+		session.Generation = 1
+	} else {
+		session.Generation++
+	}
+	session.ExpiresAt = now.Add(s.config.RefreshTokenTTL)
+	session.LastUsedAt = now
+	if client, ok := ctx.Value(sessionClientKey{}).(sessionClient); ok {
+		session.UserAgent = client.userAgent
+		session.RemoteAddr = client.remoteAddr
+	}
+
+	accessClaims := jwt.MapClaims{"sid": session.SessionID, "exp": now.Add(accessTTL).Unix()}
+	refreshClaims := jwt.MapClaims{"sid": session.SessionID, "gen": session.Generation, "exp": session.ExpiresAt.Unix()}
+	for key, value := range claims {
+		accessClaims[key] = value
+		refreshClaims[key] = value
+	}
+
+	accessToken, err = s.keyring.Sign(signing.Access, accessClaims)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err = s.keyring.Sign(signing.Refresh, refreshClaims)
+	if err != nil {
+		return "", "", err
+	}
+	session.TokenHash = hashToken(refreshToken)
+
+	if session.ID == 0 {
+		if err := s.repo.CreateSession(ctx, session); err != nil {
+			return "", "", err
+		}
+		return accessToken, refreshToken, nil
+	}
+
+	rotated, err := s.repo.RotateSession(ctx, session, previousGeneration)
+	if err != nil {
+		return "", "", err
+	}
+	if !rotated {
+		// A concurrent refresh used the same token first
+		_ = s.repo.RevokeSession(ctx, session.SessionID, "reuse")
+		return "", "", errors.New("refresh token was already used, session revoked")
+	}
+	return accessToken, refreshToken, nil
+}
+
+// useRefreshToken checks a refresh token against its session. A token of an older generation
+// means it was copied and both copies got used: the session is revoked for everyone holding it.
+func (s *AuthService) useRefreshToken(ctx context.Context, refreshToken string) (*models.RefreshSession, jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := s.keyring.Parse(signing.Refresh, refreshToken, claims)
+	if err != nil || !token.Valid {
+		return nil, nil, errors.New("invalid refresh token")
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	generation, _ := claims["gen"].(float64)
+	if sessionID == "" {
+		// Issued before sessions were tracked
+		return nil, nil, errors.New("refresh token is outdated, log in again")
+	}
+
+	session, err := s.repo.FindSession(ctx, sessionID)
+	if err != nil {
+		return nil, nil, errors.New("invalid refresh token")
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, nil, errors.New("session expired or revoked")
+	}
+
+	if uint32(generation) != session.Generation ||
+		subtle.ConstantTimeCompare([]byte(hashToken(refreshToken)), []byte(session.TokenHash)) != 1 {
+		if err := s.repo.RevokeSession(ctx, session.SessionID, "reuse"); err != nil {
+			return nil, nil, errors.New("failed to revoke session")
+		}
+		return nil, nil, errors.New("refresh token was already used, session revoked")
+	}
+
+	return session, claims, nil
+}
+
+// ListSessions returns the active sessions of an admin, or those of a vendor and its POS
+func (s *AuthService) ListSessions(ctx context.Context, role string, accountID uint, currentSessionID string) ([]Session, *models.HTTPError) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	sessions, err := s.repo.ListSessions(ctx, role, accountID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error listing sessions: "+err.Error())
+	}
+
+	result := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		entry := Session{
+			ID:         session.SessionID,
+			Role:       session.Role,
+			StaffID:    session.StaffID,
+			DeviceID:   session.DeviceID,
+			UserAgent:  session.UserAgent,
+			RemoteAddr: session.RemoteAddr,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.SessionID == currentSessionID,
+		}
+		if session.Role == "pos" {
+			posID := session.AccountID
+			entry.PosID = &posID
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// RevokeSession ends a session listed for the caller; its tokens stop working immediately
+func (s *AuthService) RevokeSession(ctx context.Context, role string, accountID uint, sessionID string) *models.HTTPError {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	session, err := s.repo.FindSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.NewHTTPError(http.StatusNotFound, "session not found")
+		}
+		return models.NewHTTPError(http.StatusInternalServerError, "error retrieving session: "+err.Error())
+	}
+
+	var owned bool
+	switch role {
+	case "admin":
+		owned = session.Role == "admin" && session.AccountID == accountID
+	case "vendor":
+		owned = session.VendorID != nil && *session.VendorID == accountID
+	}
+	if !owned {
+		return models.NewHTTPError(http.StatusNotFound, "session not found")
+	}
+
+	if err := s.repo.RevokeSession(ctx, session.SessionID, "revoked"); err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "error revoking session: "+err.Error())
+	}
+	return nil
+}
+
+// Logout ends the session of the token making the request
+func (s *AuthService) Logout(ctx context.Context, sessionID string) *models.HTTPError {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if sessionID == "" {
+		return models.NewHTTPError(http.StatusBadRequest, "token has no session")
+	}
+	if err := s.repo.RevokeSession(ctx, sessionID, "logout"); err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "error revoking session: "+err.Error())
+	}
+	return nil
+}
+
+func newSessionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
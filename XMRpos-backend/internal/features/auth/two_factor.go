@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/signing"
+	"github.com/monerokon/xmrpos/xmrpos-backend/pkg/qr"
+	"github.com/monerokon/xmrpos/xmrpos-backend/pkg/totp"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	totpIssuer        = "XMRpos"
+	preAuthTTL        = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// LoginResult is the answer to an admin or vendor login: the tokens, or a pre-auth token when a
+// second factor is needed first
+type LoginResult struct {
+	AccessToken            string `json:"access_token,omitempty"`
+	RefreshToken           string `json:"refresh_token,omitempty"`
+	TwoFactorRequired      bool   `json:"two_factor_required,omitempty"`
+	PreAuthToken           string `json:"pre_auth_token,omitempty"`
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required,omitempty"` // Admin routes stay closed until 2FA is enabled
+}
+
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`    // otpauth:// provisioning URI
+	QRCode string `json:"qr_png"` // Base64 PNG of the URI
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+// preAuthResult issues the short-lived token proving the password was checked. AuthMiddleware
+// refuses it, it is only accepted by /auth/login-2fa.
+func (s *AuthService) preAuthResult(role string, accountID uint, passwordVersion uint32) (*LoginResult, error) {
+	preAuthToken, err := s.keyring.Sign(signing.Access, jwt.MapClaims{
+		"role":             "preauth",
+		"subject_role":     role,
+		"account_id":       accountID,
+		"password_version": passwordVersion,
+		"exp":              time.Now().Add(preAuthTTL).Unix(),
+	})
+	if err != nil {
+		return nil, errors.New("failed to generate tokens")
+	}
+	return &LoginResult{TwoFactorRequired: true, PreAuthToken: preAuthToken}, nil
+}
+
+// CompleteLogin exchanges a pre-auth token and a TOTP or recovery code for the tokens
+func (s *AuthService) CompleteLogin(ctx context.Context, preAuthToken string, code string) (accessToken string, refreshToken string, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := s.keyring.Parse(signing.Access, preAuthToken, claims)
+	if err != nil || !token.Valid || claims["role"] != "preauth" {
+		return "", "", errors.New("invalid or expired pre-auth token")
+	}
+	role, _ := claims["subject_role"].(string)
+	accountIDClaim, _ := claims["account_id"].(float64)
+	passwordVersionClaim, _ := claims["password_version"].(float64)
+	accountID, passwordVersion := uint(accountIDClaim), uint32(passwordVersionClaim)
+
+	// The password must not have changed since the first step
+	var currentVersion uint32
+	var account string
+	var notifyOwner func(subject string, message string)
+	switch role {
+	case "admin":
+		admin, err := s.repo.FindAdminByID(ctx, accountID)
+		if err != nil {
+			return "", "", errors.New("invalid credentials")
+		}
+		currentVersion = admin.PasswordVersion
+		account = loginAccount("admin", 0, admin.Name)
+		notifyOwner = func(subject string, message string) {
+			s.notifier.NotifyAdmin(ctx, subject, message)
+		}
+	case "vendor":
+		vendor, err := s.repo.FindVendorByID(ctx, accountID)
+		if err != nil {
+			return "", "", errors.New("invalid credentials")
+		}
+		currentVersion = vendor.PasswordVersion
+		account = loginAccount("vendor", 0, vendor.Name)
+		notifyOwner = func(subject string, message string) {
+			s.notifier.NotifyVendor(ctx, vendor.ID, subject, message)
+		}
+	default:
+		return "", "", errors.New("invalid or expired pre-auth token")
+	}
+	if currentVersion != passwordVersion {
+		return "", "", errors.New("token is outdated (password changed)")
+	}
+
+	// Wrong codes count like wrong passwords
+	if err := s.checkLogin(ctx, account); err != nil {
+		return "", "", err
+	}
+	if err := s.verifySecondFactor(ctx, role, accountID, code); err != nil {
+		s.loginFailed(ctx, account, notifyOwner)
+		return "", "", err
+	}
+	s.loginSucceeded(ctx, account)
+
+	if role == "admin" {
+		return s.generateAdminToken(ctx, nil, accountID, passwordVersion)
+	}
+	return s.generateVendorToken(ctx, nil, accountID, passwordVersion)
+}
+
+// verifySecondFactor accepts a TOTP code not used before, or an unused recovery code
+func (s *AuthService) verifySecondFactor(ctx context.Context, role string, accountID uint, code string) error {
+	twoFactor, err := s.repo.FindTwoFactor(ctx, role, accountID)
+	if err != nil || !twoFactor.Enabled {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	if counter, ok := totp.Validate(twoFactor.Secret, code, time.Now()); ok {
+		used, err := s.repo.UseTOTPCounter(ctx, twoFactor.ID, counter)
+		if err != nil {
+			return errors.New("failed to check code")
+		}
+		if !used {
+			return errors.New("code was already used, wait for the next one")
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, role, accountID, hashRecoveryCode(code))
+	if err != nil {
+		return errors.New("failed to check code")
+	}
+	if !used {
+		return errors.New("invalid code")
+	}
+	return nil
+}
+
+// StartTwoFactorSetup creates a new secret for the account. It is only enforced after
+// EnableTwoFactor confirmed a code, so an abandoned setup does not lock the account.
+func (s *AuthService) StartTwoFactorSetup(ctx context.Context, role string, accountID uint) (*TwoFactorSetup, *models.HTTPError) {
+	enabled, err := s.repo.TwoFactorEnabled(ctx, role, accountID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error checking two-factor authentication: "+err.Error())
+	}
+	if enabled {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "two-factor authentication is already enabled, disable it first")
+	}
+
+	accountName, httpErr := s.accountName(ctx, role, accountID)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error generating secret: "+err.Error())
+	}
+	if err := s.repo.ResetTwoFactor(ctx, role, accountID, secret); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error storing secret: "+err.Error())
+	}
+
+	uri := totp.URI(totpIssuer, accountName, secret)
+	code, err := qr.Encode(uri)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error encoding QR code: "+err.Error())
+	}
+	png, err := code.PNG(6)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error rendering QR code: "+err.Error())
+	}
+
+	return &TwoFactorSetup{Secret: secret, URI: uri, QRCode: base64.StdEncoding.EncodeToString(png)}, nil
+}
+
+// EnableTwoFactor confirms the secret with a code from the authenticator and returns the
+// recovery codes, which are only shown this once
+func (s *AuthService) EnableTwoFactor(ctx context.Context, role string, accountID uint, code string) ([]string, *models.HTTPError) {
+	twoFactor, err := s.repo.FindTwoFactor(ctx, role, accountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.NewHTTPError(http.StatusBadRequest, "start the setup first")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving two-factor authentication: "+err.Error())
+	}
+	if twoFactor.Enabled {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "two-factor authentication is already enabled")
+	}
+
+	counter, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "invalid code")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error generating recovery codes: "+err.Error())
+	}
+	if err := s.repo.EnableTwoFactor(ctx, twoFactor.ID, counter, hashes); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error enabling two-factor authentication: "+err.Error())
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor needs the password and a code. Admins cannot disable it while it is required.
+func (s *AuthService) DisableTwoFactor(ctx context.Context, role string, accountID uint, password string, code string) *models.HTTPError {
+	if role == "admin" && s.config.AdminRequire2FA {
+		return models.NewHTTPError(http.StatusForbidden, "two-factor authentication is required for admins")
+	}
+	if httpErr := s.checkPassword(ctx, role, accountID, password); httpErr != nil {
+		return httpErr
+	}
+	if err := s.verifySecondFactor(ctx, role, accountID, code); err != nil {
+		return models.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	if err := s.repo.DeleteTwoFactor(ctx, role, accountID); err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "error disabling two-factor authentication: "+err.Error())
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the account
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, role string, accountID uint, code string) ([]string, *models.HTTPError) {
+	if err := s.verifySecondFactor(ctx, role, accountID, code); err != nil {
+		return nil, models.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error generating recovery codes: "+err.Error())
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, role, accountID, hashes); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error storing recovery codes: "+err.Error())
+	}
+	return codes, nil
+}
+
+func (s *AuthService) GetTwoFactorStatus(ctx context.Context, role string, accountID uint) (*TwoFactorStatus, *models.HTTPError) {
+	enabled, err := s.repo.TwoFactorEnabled(ctx, role, accountID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error checking two-factor authentication: "+err.Error())
+	}
+	status := &TwoFactorStatus{Enabled: enabled}
+	if enabled {
+		left, err := s.repo.CountUnusedRecoveryCodes(ctx, role, accountID)
+		if err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "error counting recovery codes: "+err.Error())
+		}
+		status.RecoveryCodesLeft = left
+	}
+	return status, nil
+}
+
+func (s *AuthService) accountName(ctx context.Context, role string, accountID uint) (string, *models.HTTPError) {
+	switch role {
+	case "admin":
+		admin, err := s.repo.FindAdminByID(ctx, accountID)
+		if err != nil {
+			return "", models.NewHTTPError(http.StatusNotFound, "admin not found")
+		}
+		return admin.Name, nil
+	case "vendor":
+		vendor, err := s.repo.FindVendorByID(ctx, accountID)
+		if err != nil {
+			return "", models.NewHTTPError(http.StatusNotFound, "vendor not found")
+		}
+		return vendor.Name, nil
+	}
+	return "", models.NewHTTPError(http.StatusForbidden, "two-factor authentication is only available for admins and vendors")
+}
+
+func (s *AuthService) checkPassword(ctx context.Context, role string, accountID uint, password string) *models.HTTPError {
+	var passwordHash string
+	switch role {
+	case "admin":
+		admin, err := s.repo.FindAdminByID(ctx, accountID)
+		if err != nil {
+			return models.NewHTTPError(http.StatusNotFound, "admin not found")
+		}
+		passwordHash = admin.PasswordHash
+	case "vendor":
+		vendor, err := s.repo.FindVendorByID(ctx, accountID)
+		if err != nil {
+			return models.NewHTTPError(http.StatusNotFound, "vendor not found")
+		}
+		passwordHash = vendor.PasswordHash
+	default:
+		return models.NewHTTPError(http.StatusForbidden, "two-factor authentication is only available for admins and vendors")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
+		return models.NewHTTPError(http.StatusUnauthorized, "invalid password")
+	}
+	return nil
+}
+
+// generateRecoveryCodes returns codes like ABCDE-FGHIJ (50 random bits each) and their hashes
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		encoded := encoding.EncodeToString(raw)[:10]
+		codes = append(codes, encoded[:5]+"-"+encoded[5:])
+		hashes = append(hashes, hashRecoveryCode(encoded))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed loosely
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
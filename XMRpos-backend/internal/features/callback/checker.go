@@ -0,0 +1,278 @@
+package callback
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/pos"
+)
+
+// Failed checks and callbacks are retried after checkBackoffBase, doubling up to checkBackoffMax
+const (
+	checkBackoffBase = 5 * time.Second
+	checkBackoffMax  = 5 * time.Minute
+)
+
+// checkQueue holds the transactions waiting for a worker. The priority lane is always served
+// first; a transaction queued in the normal lane can be promoted, its normal entry is then skipped.
+type checkQueue struct {
+	mu       sync.Mutex
+	priority []uint
+	normal   []uint
+	queued   map[uint]bool // transactionID -> queued in the priority lane
+	ready    chan struct{}
+}
+
+type checkBackoff struct {
+	failures uint
+	next     time.Time
+}
+
+func newCheckQueue() *checkQueue {
+	return &checkQueue{queued: make(map[uint]bool), ready: make(chan struct{}, 1)}
+}
+
+func (q *checkQueue) push(transactionID uint, priority bool) {
+	q.mu.Lock()
+	inPriority, queued := q.queued[transactionID]
+	if queued && (inPriority || !priority) {
+		q.mu.Unlock()
+		return
+	}
+	q.queued[transactionID] = priority
+	if priority {
+		q.priority = append(q.priority, transactionID)
+	} else {
+		q.normal = append(q.normal, transactionID)
+	}
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *checkQueue) pop() (uint, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.priority) > 0 {
+		transactionID := q.priority[0]
+		q.priority = q.priority[1:]
+		delete(q.queued, transactionID)
+		q.signalIfPending()
+		return transactionID, true
+	}
+	for len(q.normal) > 0 {
+		transactionID := q.normal[0]
+		q.normal = q.normal[1:]
+		if inPriority, queued := q.queued[transactionID]; !queued || inPriority {
+			continue // Promoted or already checked
+		}
+		delete(q.queued, transactionID)
+		q.signalIfPending()
+		return transactionID, true
+	}
+	return 0, false
+}
+
+// signalIfPending wakes another worker while entries are left, the caller holds q.mu
+func (q *checkQueue) signalIfPending() {
+	if len(q.priority) > 0 || len(q.normal) > 0 {
+		q.signal()
+	}
+}
+
+func (q *checkQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// transactionLocks serializes the processing of each transaction between the checker workers
+// and MoneroPay callbacks, while different transactions are processed concurrently
+type transactionLocks struct {
+	mu    sync.Mutex
+	locks map[uint]*transactionLock
+}
+
+type transactionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (l *transactionLocks) lock(transactionID uint) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[uint]*transactionLock)
+	}
+	lock := l.locks[transactionID]
+	if lock == nil {
+		lock = &transactionLock{}
+		l.locks[transactionID] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, transactionID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// StartConfirmationChecker re-checks the unconfirmed transactions whenever the chain height
+// grows, as only a new block changes confirmations. The invoices a POS is watching are checked
+// on every poll, so a payment entering the pool shows up without waiting for a block.
+func (s *CallbackService) StartConfirmationChecker(ctx context.Context, pollInterval time.Duration, workers int) {
+	queue := newCheckQueue()
+	for i := 0; i < workers; i++ {
+		go s.runCheckWorker(ctx, queue)
+	}
+
+	go func() {
+		lastHeight := int64(0)
+		poll := func() {
+			pollCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			height, err := s.chainHeight(pollCtx)
+			if err != nil {
+				log.Printf("Confirmation checker: error getting chain height: %v", err)
+			} else if height > lastHeight {
+				lastHeight = height
+				ids, err := s.repo.FindUnconfirmedTransactionIDs(pollCtx)
+				if err != nil {
+					log.Printf("Confirmation checker: error loading unconfirmed transactions: %v", err)
+				}
+				for _, id := range ids {
+					queue.push(id, false)
+				}
+			}
+
+			for _, id := range pos.WatchedTransactionIDs() {
+				queue.push(id, true)
+			}
+		}
+
+		poll()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				poll()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s *CallbackService) runCheckWorker(ctx context.Context, queue *checkQueue) {
+	for {
+		transactionID, ok := queue.pop()
+		if !ok {
+			select {
+			case <-queue.ready:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+		s.checkTransaction(checkCtx, transactionID)
+		cancel()
+	}
+}
+
+// checkTransaction asks the transaction's payment backend for its status, unless an earlier
+// failure put it on backoff
+func (s *CallbackService) checkTransaction(ctx context.Context, transactionID uint) {
+	s.backoffMu.Lock()
+	backoff := s.backoff[transactionID]
+	s.backoffMu.Unlock()
+	if backoff != nil && time.Now().Before(backoff.next) {
+		return
+	}
+
+	unlock := s.locks.lock(transactionID)
+	defer unlock()
+
+	transaction, err := s.repo.FindTransactionByID(ctx, transactionID)
+	// Confirmed transactions are final and transactions without a subaddress have nothing to check
+	if err != nil || transaction.Confirmed || transaction.SubAddress == nil {
+		s.clearBackoff(transactionID)
+		return
+	}
+
+	backend, err := s.payments.For(transaction)
+	if err != nil {
+		s.recordFailure(transactionID)
+		return
+	}
+	status, err := backend.GetStatus(ctx, transaction)
+	if err != nil {
+		s.recordFailure(transactionID)
+		return
+	}
+	if httpErr := s.processTransaction(ctx, transaction.ID, status); httpErr != nil {
+		s.recordFailure(transactionID)
+		return
+	}
+	s.clearBackoff(transactionID)
+}
+
+func (s *CallbackService) recordFailure(transactionID uint) {
+	s.backoffMu.Lock()
+	defer s.backoffMu.Unlock()
+
+	backoff := s.backoff[transactionID]
+	if backoff == nil {
+		backoff = &checkBackoff{}
+		s.backoff[transactionID] = backoff
+	}
+	backoff.next = time.Now().Add(retryDelay(backoff.failures))
+	backoff.failures++
+}
+
+// retryDelay is the wait after the given number of earlier failures
+func retryDelay(failures uint) time.Duration {
+	if failures >= 6 {
+		return checkBackoffMax
+	}
+	return min(checkBackoffBase<<failures, checkBackoffMax)
+}
+
+func (s *CallbackService) clearBackoff(transactionID uint) {
+	s.backoffMu.Lock()
+	delete(s.backoff, transactionID)
+	s.backoffMu.Unlock()
+}
+
+// chainHeight reads the height from the daemon, or from the wallet when no daemon is configured
+func (s *CallbackService) chainHeight(ctx context.Context) (int64, error) {
+	if s.daemon != nil {
+		var result struct {
+			Count int64 `json:"count"`
+		}
+		if err := s.daemon.Call(ctx, "get_block_count", nil, &result); err != nil {
+			return 0, err
+		}
+		return result.Count, nil
+	}
+
+	var result struct {
+		Height int64 `json:"height"`
+	}
+	if err := s.wallet.Call(ctx, "get_height", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.Height, nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
 )
 
@@ -24,23 +25,33 @@ func (h *CallbackHandler) ReceiveTransaction(w http.ResponseWriter, r *http.Requ
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 	r = r.WithContext(ctx)
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10) // A MoneroPay callback is about 1KB
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
 	var req moneropay.CallbackResponse
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.Unmarshal(payload, &req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	jwtToken := chi.URLParam(r, "jwt")
+	token := chi.URLParam(r, "token")
+
+	remoteAddr := utils.GetPeerAddr(ctx)
+	if remoteAddr == "" {
+		remoteAddr = r.RemoteAddr
+	}
 
-	if err := h.service.HandleCallback(ctx, jwtToken, req); err != nil {
-		http.Error(w, "callback handling failed", http.StatusInternalServerError)
+	if httpErr := h.service.HandleCallback(ctx, token, remoteAddr, req, payload); httpErr != nil {
+		http.Error(w, "callback handling failed", httpErr.Code)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	resp := "OK"
 	_ = json.NewEncoder(w).Encode(resp)
-	io.Copy(io.Discard, r.Body)
 }
@@ -0,0 +1,138 @@
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/payment"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
+)
+
+const (
+	inboxBatchSize   = 10
+	inboxLease       = 2 * time.Minute // Time a claimed entry has before another worker may take it
+	inboxMaxAttempts = 8
+)
+
+// errCallbackMismatch marks callbacks that claim more than MoneroPay reports; they are not retried
+var errCallbackMismatch = errors.New("callback does not match MoneroPay")
+
+// StartCallbackInbox processes stored callbacks as they arrive, and every interval for retries
+func (s *CallbackService) StartCallbackInbox(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.drainInbox(ctx)
+			select {
+			case <-s.inboxWake:
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s *CallbackService) wakeInbox() {
+	select {
+	case s.inboxWake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *CallbackService) drainInbox(ctx context.Context) {
+	for ctx.Err() == nil {
+		entries, err := s.repo.ClaimInboxEntries(ctx, inboxBatchSize, inboxLease)
+		if err != nil {
+			log.Printf("Callback inbox: error claiming entries: %v", err)
+			return
+		}
+		if len(entries) == 0 {
+			return
+		}
+		for _, entry := range entries {
+			s.processInboxEntry(ctx, entry)
+		}
+	}
+}
+
+func (s *CallbackService) processInboxEntry(ctx context.Context, entry *models.CallbackInboxEntry) {
+	entryCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	err := s.applyCallback(entryCtx, entry)
+	cancel()
+
+	now := time.Now()
+	entry.UpdatedAt = now
+	switch {
+	case err == nil:
+		entry.Status = models.CallbackInboxProcessed
+		entry.ProcessedAt = &now
+		entry.LastError = nil
+	case errors.Is(err, errCallbackMismatch):
+		message := err.Error()
+		entry.Status = models.CallbackInboxRejected
+		entry.LastError = &message
+		log.Printf("Callback inbox: rejected callback %d for transaction %d: %v", entry.ID, entry.TransactionID, err)
+	case entry.Attempts >= inboxMaxAttempts:
+		message := err.Error()
+		entry.Status = models.CallbackInboxFailed
+		entry.LastError = &message
+		log.Printf("Callback inbox: giving up on callback %d for transaction %d: %v", entry.ID, entry.TransactionID, err)
+	default:
+		message := err.Error()
+		entry.Status = models.CallbackInboxPending
+		entry.NextAttemptAt = now.Add(retryDelay(uint(entry.Attempts - 1)))
+		entry.LastError = &message
+	}
+
+	// The entry is stored with a fresh context so a shutdown does not leave it leased for nothing
+	updateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.repo.UpdateInboxEntry(updateCtx, entry); err != nil {
+		log.Printf("Callback inbox: error updating entry %d: %v", entry.ID, err)
+	}
+}
+
+// applyCallback checks the callback against MoneroPay and processes what MoneroPay reports
+func (s *CallbackService) applyCallback(ctx context.Context, entry *models.CallbackInboxEntry) error {
+	backend, ok := s.payments.Get(payment.BackendMoneroPay)
+	if !ok {
+		return errors.New("MoneroPay backend is not configured")
+	}
+
+	var callback moneropay.CallbackResponse
+	if err := json.Unmarshal([]byte(entry.Payload), &callback); err != nil {
+		return fmt.Errorf("%w: invalid payload: %v", errCallbackMismatch, err)
+	}
+
+	unlock := s.locks.lock(entry.TransactionID)
+	defer unlock()
+
+	transaction, err := s.repo.FindTransactionByID(ctx, entry.TransactionID)
+	if err != nil {
+		return err
+	}
+	if transaction.Confirmed {
+		return nil
+	}
+
+	status, err := backend.GetStatus(ctx, transaction)
+	if err != nil {
+		return err
+	}
+	receiveAddress := callback.ToReceiveAddressResponse()
+	if err := compareCallback(payment.StatusFromMoneroPay(&receiveAddress), status); err != nil {
+		return fmt.Errorf("%w: %v", errCallbackMismatch, err)
+	}
+
+	if httpErr := s.processTransaction(ctx, transaction.ID, status); httpErr != nil {
+		return errors.New(httpErr.Message)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/payment"
+)
+
+// blockHash returns the hash of the main chain block at height, cached in hashes for the rest of
+// the check. It returns nil when no daemon is configured, the payment is in the pool or the daemon
+// cannot be reached; the hash is then recorded on a later check.
+func (s *CallbackService) blockHash(ctx context.Context, hashes map[int64]*string, height int64) *string {
+	if s.daemon == nil || height <= 0 {
+		return nil
+	}
+	if hash, ok := hashes[height]; ok {
+		return hash
+	}
+
+	var result struct {
+		BlockHeader struct {
+			Hash string `json:"hash"`
+		} `json:"block_header"`
+	}
+	params := map[string]any{"height": height}
+	if err := s.daemon.Call(ctx, "get_block_header_by_height", params, &result); err != nil || result.BlockHeader.Hash == "" {
+		return nil
+	}
+
+	hashes[height] = &result.BlockHeader.Hash
+	return hashes[height]
+}
+
+// detectReorg compares the stored payments of the transaction with the status reported by its
+// backend. A payment was hit by a reorg when it disappeared, lost confirmations, moved to another
+// height or the block it was recorded in is no longer part of the main chain. Payments that
+// disappeared are returned so they can be removed, together with a reason for each finding.
+func (s *CallbackService) detectReorg(ctx context.Context, transaction *models.Transaction, status *payment.Status, hashes map[int64]*string) (dropped []*models.SubTransaction, reasons []string) {
+	for _, subTx := range transaction.SubTransactions {
+		var current *payment.Payment
+		for i := range status.Payments {
+			if status.Payments[i].TxHash == subTx.TxHash {
+				current = &status.Payments[i]
+				break
+			}
+		}
+
+		switch {
+		case current == nil:
+			dropped = append(dropped, subTx)
+			reasons = append(reasons, fmt.Sprintf("payment %s disappeared", subTx.TxHash))
+		case current.Confirmations < subTx.Confirmations:
+			reasons = append(reasons, fmt.Sprintf("payment %s went from %d to %d confirmations", subTx.TxHash, subTx.Confirmations, current.Confirmations))
+		case subTx.Height > 0 && current.Height != subTx.Height:
+			reasons = append(reasons, fmt.Sprintf("payment %s moved from block %d to %d", subTx.TxHash, subTx.Height, current.Height))
+		case subTx.BlockHash != nil:
+			if hash := s.blockHash(ctx, hashes, subTx.Height); hash != nil && *hash != *subTx.BlockHash {
+				reasons = append(reasons, fmt.Sprintf("block %d of payment %s was replaced", subTx.Height, subTx.TxHash))
+			}
+		}
+	}
+	return dropped, reasons
+}
+
+// revertConfirmedTransaction takes a confirmed transaction back to pending after a reorg and
+// takes back the vendor's credit for it. If the credit was already paid out the vendor's balance
+// goes negative until the transaction is confirmed again, which the admin is told about.
+func (s *CallbackService) revertConfirmedTransaction(ctx context.Context, transaction *models.Transaction, reasons []string) *models.HTTPError {
+	reversed := false
+	if transaction.PaymentBackend != payment.BackendViewOnly {
+		var err error
+		reversed, err = s.ledger.ReverseSaleCredit(ctx, transaction)
+		if err != nil {
+			return models.NewHTTPError(http.StatusInternalServerError, "Failed to reverse credit: "+err.Error())
+		}
+	}
+	if err := s.repo.RevertConfirmedTransaction(ctx, transaction.ID); err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "Failed to revert transaction: "+err.Error())
+	}
+	transaction.Confirmed = false
+	transaction.Accepted = false
+
+	findings := strings.Join(reasons, "; ")
+	message := fmt.Sprintf("Transaction %d was confirmed, but %s. It is pending again until its payments are confirmed again.", transaction.ID, findings)
+	if reversed {
+		message += " Its credit was taken back from the balance in the meantime."
+	}
+	s.notifier.NotifyVendor(ctx, transaction.VendorID, "Payment reverted by a blockchain reorg", message)
+
+	adminMessage := fmt.Sprintf("Transaction %d of vendor %d was confirmed, but %s. It was reverted to pending", transaction.ID, transaction.VendorID, findings)
+	if reversed {
+		adminMessage += " and its credit was taken back"
+	}
+	if transaction.Transferred {
+		adminMessage += "; it was already paid out, so the vendor's balance may be negative"
+	}
+	s.notifier.NotifyAdmin(ctx, "Reorg below a confirmed transaction", adminMessage+".")
+	return nil
+}
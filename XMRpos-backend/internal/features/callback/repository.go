@@ -2,17 +2,27 @@ package callback
 
 import (
 	"context"
+	"time"
 
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CallbackRepository interface {
 	FindTransactionByID(ctx context.Context, id uint) (*models.Transaction, error)
-	FindUnconfirmedTransactions(ctx context.Context) ([]*models.Transaction, error)
+	FirstCallbackSecretAt(ctx context.Context) (*time.Time, error)
+	FindUnconfirmedTransactionIDs(ctx context.Context) ([]uint, error)
 	UpdateTransaction(ctx context.Context, transaction *models.Transaction) (*models.Transaction, error)
 	UpdateSubTransaction(ctx context.Context, subTx *models.SubTransaction) (*models.SubTransaction, error)
 	CreateSubTransaction(ctx context.Context, subTx *models.SubTransaction) (*models.SubTransaction, error)
+	DeleteSubTransaction(ctx context.Context, subTxID uint) error
+	RevertTransaction(ctx context.Context, transactionID uint) error
+	RevertConfirmedTransaction(ctx context.Context, transactionID uint) error
+	CreateCallbackAuditLog(ctx context.Context, entry *models.CallbackAuditLog) error
+	CreateInboxEntry(ctx context.Context, entry *models.CallbackInboxEntry) (bool, error)
+	ClaimInboxEntries(ctx context.Context, limit int, lease time.Duration) ([]*models.CallbackInboxEntry, error)
+	UpdateInboxEntry(ctx context.Context, entry *models.CallbackInboxEntry) error
 }
 
 type callbackRepository struct {
@@ -34,18 +44,34 @@ func (r *callbackRepository) FindTransactionByID(ctx context.Context, id uint) (
 	return &transaction, nil
 }
 
-func (r *callbackRepository) FindUnconfirmedTransactions(ctx context.Context) ([]*models.Transaction, error) {
+// FirstCallbackSecretAt returns when the first transaction with a callback secret was created,
+// nil while there is none. Transactions before it are the ones still called back with a JWT.
+func (r *callbackRepository) FirstCallbackSecretAt(ctx context.Context) (*time.Time, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	var transactions []*models.Transaction
+	var first *time.Time
+	err := r.db.WithContext(ctx).Model(&models.Transaction{}).
+		Where("callback_secret_hash IS NOT NULL").
+		Select("MIN(created_at)").
+		Scan(&first).Error
+	return first, err
+}
+
+// FindUnconfirmedTransactionIDs lists the transactions the checker still has to follow
+func (r *callbackRepository) FindUnconfirmedTransactionIDs(ctx context.Context) ([]uint, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var ids []uint
 	if err := r.db.WithContext(ctx).
-		Preload("SubTransactions").
-		Where("confirmed = ?", false).
-		Find(&transactions).Error; err != nil {
+		Model(&models.Transaction{}).
+		Where("confirmed = ? AND sub_address IS NOT NULL", false).
+		Order("id ASC").
+		Pluck("id", &ids).Error; err != nil {
 		return nil, err
 	}
-	return transactions, nil
+	return ids, nil
 }
 
 // Update only the main transaction fields
@@ -64,7 +90,10 @@ func (r *callbackRepository) UpdateSubTransaction(ctx context.Context, subTx *mo
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	if err := r.db.WithContext(ctx).Model(&models.SubTransaction{}).Where("id = ?", subTx.ID).Updates(subTx).Error; err != nil {
+	// Columns are selected so zero values (back in the pool, no confirmations, unlocked) are written too
+	if err := r.db.WithContext(ctx).Model(&models.SubTransaction{}).Where("id = ?", subTx.ID).
+		Select("amount", "confirmations", "double_spend_seen", "fee", "height", "block_hash", "timestamp", "unlock_time", "locked").
+		Updates(subTx).Error; err != nil {
 		return nil, err
 	}
 	return subTx, nil
@@ -80,3 +109,90 @@ func (r *callbackRepository) CreateSubTransaction(ctx context.Context, subTx *mo
 	}
 	return subTx, nil
 }
+
+// Delete a subtransaction that is no longer part of the chain or the pool
+func (r *callbackRepository) DeleteSubTransaction(ctx context.Context, subTxID uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Delete(&models.SubTransaction{}, subTxID).Error
+}
+
+// RevertTransaction takes back the acceptance of a transaction; UpdateTransaction cannot, as it skips false
+func (r *callbackRepository) RevertTransaction(ctx context.Context, transactionID uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Model(&models.Transaction{}).
+		Where("id = ? AND confirmed = ?", transactionID, false).
+		Update("accepted", false).Error
+}
+
+// RevertConfirmedTransaction takes a confirmed transaction back to pending after a reorg
+func (r *callbackRepository) RevertConfirmedTransaction(ctx context.Context, transactionID uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Model(&models.Transaction{}).
+		Where("id = ?", transactionID).
+		Updates(map[string]interface{}{
+			"accepted":  false,
+			"confirmed": false,
+		}).Error
+}
+
+func (r *callbackRepository) CreateCallbackAuditLog(ctx context.Context, entry *models.CallbackAuditLog) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+// CreateInboxEntry stores the callback and reports false when the same callback is already in the inbox
+func (r *callbackRepository) CreateInboxEntry(ctx context.Context, entry *models.CallbackInboxEntry) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(entry)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ClaimInboxEntries takes up to limit due entries and leases them for the given time by moving
+// their next attempt forward. SKIP LOCKED keeps concurrent workers from claiming the same entry,
+// and an entry whose worker died is claimed again when its lease runs out.
+func (r *callbackRepository) ClaimInboxEntries(ctx context.Context, limit int, lease time.Duration) ([]*models.CallbackInboxEntry, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	now := time.Now()
+	var entries []*models.CallbackInboxEntry
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE callback_inbox_entries
+		SET attempts = attempts + 1, next_attempt_at = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM callback_inbox_entries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(lease), now, models.CallbackInboxPending, now, limit,
+	).Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *callbackRepository) UpdateInboxEntry(ctx context.Context, entry *models.CallbackInboxEntry) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Model(&models.CallbackInboxEntry{}).Where("id = ?", entry.ID).
+		Select("status", "next_attempt_at", "last_error", "processed_at", "updated_at").
+		Updates(entry).Error
+}
@@ -2,83 +2,60 @@ package callback
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
 
 	"net/http"
-
 	"time"
 
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/checkout"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/ledger"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/pos"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/risk"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/notify"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/payment"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/rpc"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
 )
 
 type CallbackService struct {
-	repo      CallbackRepository
-	config    *config.Config
-	moneroPay *moneropay.MoneroPayAPIClient
-	mu        sync.Mutex
-}
-
-func NewCallbackService(repo CallbackRepository, cfg *config.Config, moneroPay *moneropay.MoneroPayAPIClient) *CallbackService {
-	return &CallbackService{repo: repo, config: cfg, moneroPay: moneroPay}
-}
-
-func (s *CallbackService) StartConfirmationChecker(ctx context.Context, interval time.Duration) {
-	go func() {
-		runSweep := func(parent context.Context) {
-			sweepCtx, cancel := context.WithTimeout(parent, 20*time.Second)
-			s.checkUnconfirmedTransactions(sweepCtx)
-			cancel()
-		}
-
-		runSweep(ctx)
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				runSweep(ctx)
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	repo     CallbackRepository
+	config   *config.Config
+	payments *payment.Backends
+	ledger   *ledger.LedgerService
+	risk     *risk.RiskService
+	notifier *notify.Notifier
+	checkout *checkout.CheckoutService
+	wallet   *rpc.Client
+	daemon   *rpc.Client // Optional, block hashes are only tracked with a daemon
+
+	locks     transactionLocks
+	backoffMu sync.Mutex
+	backoff   map[uint]*checkBackoff
+	inboxWake chan struct{}
 }
 
-// This method queries for unconfirmed transactions and checks MoneroPay
-func (s *CallbackService) checkUnconfirmedTransactions(ctx context.Context) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	unconfirmed, err := s.repo.FindUnconfirmedTransactions(ctx)
-	if err != nil {
-		return
-	}
-
-	for _, tx := range unconfirmed {
-		callCtx, cancel := context.WithTimeout(ctx, 8*time.Second)
-		// Skip transactions without a subaddress
-		if tx.SubAddress == nil {
-			cancel()
-			continue
-		}
-		moneroStatus, err := s.moneroPay.GetReceiveAddress(callCtx, *tx.SubAddress, &moneropay.GetReceiveAddressParams{})
-		cancel()
-		if err != nil {
-			continue
-		}
-
-		if moneroStatus != nil {
-			_ = s.processTransaction(ctx, tx.ID, *moneroStatus)
-		}
+func NewCallbackService(repo CallbackRepository, cfg *config.Config, payments *payment.Backends, ledgerService *ledger.LedgerService, riskService *risk.RiskService, notifier *notify.Notifier, checkoutService *checkout.CheckoutService, walletRPC *rpc.Client, daemonRPC *rpc.Client) *CallbackService {
+	return &CallbackService{
+		repo:      repo,
+		config:    cfg,
+		payments:  payments,
+		ledger:    ledgerService,
+		risk:      riskService,
+		notifier:  notifier,
+		checkout:  checkoutService,
+		wallet:    walletRPC,
+		daemon:    daemonRPC,
+		backoff:   make(map[uint]*checkBackoff),
+		inboxWake: make(chan struct{}, 1),
 	}
 }
 
-func (s *CallbackService) processTransaction(ctx context.Context, transactionID uint, transactionToProcess moneropay.ReceiveAddressResponse) *models.HTTPError {
+func (s *CallbackService) processTransaction(ctx context.Context, transactionID uint, transactionToProcess *payment.Status) *models.HTTPError {
 
 	// Get the transaction by ID
 	transaction, err := s.repo.FindTransactionByID(ctx, transactionID)
@@ -86,7 +63,24 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 		return models.NewHTTPError(http.StatusNotFound, "Transaction not found")
 	}
 
-	for _, subTxToProcess := range transactionToProcess.Transactions {
+	// Look for payments a reorg took out of their block before the stored state is overwritten
+	hashes := make(map[int64]*string)
+	dropped, reorgReasons := s.detectReorg(ctx, transaction, transactionToProcess, hashes)
+	// A confirmed transaction hit by a reorg goes back to pending with its credit before anything
+	// else is stored, so a failure is retried with the same findings. It is confirmed and credited
+	// again below if its payments still qualify.
+	if transaction.Confirmed && len(reorgReasons) > 0 {
+		if httpErr := s.revertConfirmedTransaction(ctx, transaction, reorgReasons); httpErr != nil {
+			return httpErr
+		}
+	}
+	for _, subTx := range dropped {
+		if err := s.repo.DeleteSubTransaction(ctx, subTx.ID); err != nil {
+			return models.NewHTTPError(http.StatusInternalServerError, "Failed to delete subtransaction: "+err.Error())
+		}
+	}
+
+	for _, subTxToProcess := range transactionToProcess.Payments {
 		// Create or update the subtransaction
 		subTransaction := &models.SubTransaction{
 			TransactionID:   transaction.ID,
@@ -95,6 +89,7 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 			DoubleSpendSeen: subTxToProcess.DoubleSpendSeen,
 			Fee:             subTxToProcess.Fee,
 			Height:          subTxToProcess.Height,
+			BlockHash:       s.blockHash(ctx, hashes, subTxToProcess.Height),
 			Timestamp:       subTxToProcess.Timestamp,
 			TxHash:          subTxToProcess.TxHash,
 			UnlockTime:      subTxToProcess.UnlockTime,
@@ -107,6 +102,10 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 			if subTx.TxHash == subTransaction.TxHash {
 				subTransaction.ID = subTx.ID // Ensure we set the ID for update
 				existing = true
+				// Keep the recorded block hash when the daemon could not be asked this time
+				if subTransaction.BlockHash == nil && subTransaction.Height > 0 && subTx.Height == subTransaction.Height {
+					subTransaction.BlockHash = subTx.BlockHash
+				}
 				break
 			}
 		}
@@ -131,6 +130,8 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 	if err != nil {
 		return models.NewHTTPError(http.StatusNotFound, "Transaction not found after update")
 	}
+	wasAccepted := transaction.Accepted
+	wasConfirmed := transaction.Confirmed
 
 	// Calculate if transaction is accepted
 	allAccepted := true
@@ -141,26 +142,59 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 		}
 	}
 
-	if transactionToProcess.Amount.Covered.Total < transaction.Amount {
+	if transactionToProcess.Received < transaction.Amount {
 		allAccepted = false
 	}
 
+	// The vendor's risk policy can hold back payments that reached their confirmations
+	policy, err := s.risk.Policy(ctx, transaction.VendorID)
+	if err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "Failed to load risk policy: "+err.Error())
+	}
+	assessment := policy.Assess(transaction)
+	if !assessment.Acceptable {
+		allAccepted = false
+	}
+	if len(reorgReasons) > 0 {
+		assessment.Flags = append(assessment.Flags, models.RiskFlagReorg)
+	}
+	transaction.RiskFlags = risk.MergeFlags(transaction.RiskFlags, assessment.Flags)
+
 	transaction.Accepted = allAccepted
 
-	// Calculate if the transaction is confirmed
+	// Calculate if the transaction is confirmed: every payment must be as deep as the depth the
+	// transaction was created with and unlocked, which also honours a payment's unlock_time
 	allConfirmed := true
 	for _, subTx := range transaction.SubTransactions {
-		if subTx.Confirmations < 10 {
+		if subTx.Confirmations < transaction.ConfirmedDepth || subTx.Locked {
 			allConfirmed = false
 			break
 		}
 	}
 
-	if transactionToProcess.Amount.Covered.Unlocked < transaction.Amount {
+	if transactionToProcess.Unlocked < transaction.Amount {
 		allConfirmed = false
 	}
 
-	transaction.Confirmed = allConfirmed
+	// Once confirmed a transaction stays confirmed unless a reorg reverted it above
+	transaction.Confirmed = allConfirmed || wasConfirmed
+
+	// Credit the vendor before the transaction is stored as confirmed, so a failure is retried
+	// on the next check instead of leaving a confirmed transaction without a ledger entry.
+	// Payments into a self-custody vendor's own wallet never pass through the ledger.
+	if transaction.Confirmed && transaction.PaymentBackend != payment.BackendViewOnly {
+		// The commission is fixed at confirmation so later rule changes do not alter past sales
+		if transaction.Commission == nil {
+			commission, err := s.ledger.CommissionFor(ctx, transaction.VendorID, transaction.Amount)
+			if err != nil {
+				return models.NewHTTPError(http.StatusInternalServerError, "Failed to compute commission: "+err.Error())
+			}
+			transaction.Commission = &commission
+		}
+		if err := s.ledger.PostSaleCredit(ctx, transaction, transactionToProcess.Received); err != nil {
+			return models.NewHTTPError(http.StatusInternalServerError, "Failed to credit vendor: "+err.Error())
+		}
+	}
 
 	// Update the transaction in the repository
 	_, err = s.repo.UpdateTransaction(ctx, transaction)
@@ -168,47 +202,83 @@ func (s *CallbackService) processTransaction(ctx context.Context, transactionID
 		return models.NewHTTPError(http.StatusInternalServerError, "Failed to update transaction: "+err.Error())
 	}
 
+	// An accepted transaction that no longer qualifies goes back to pending
+	if !wasConfirmed && wasAccepted && !transaction.Accepted {
+		if err := s.repo.RevertTransaction(ctx, transaction.ID); err != nil {
+			return models.NewHTTPError(http.StatusInternalServerError, "Failed to revert transaction: "+err.Error())
+		}
+		if len(reorgReasons) > 0 {
+			s.notifier.NotifyVendor(ctx, transaction.VendorID, "Payment reverted by a blockchain reorg",
+				fmt.Sprintf("Transaction %d is no longer accepted: %s", transaction.ID, strings.Join(reorgReasons, "; ")))
+		}
+	}
+
+	// Online checkouts follow their transaction and tell the shop through its webhook
+	if err := s.checkout.TransactionUpdated(ctx, transaction); err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "Failed to update checkout: "+err.Error())
+	}
+
 	go pos.NotifyTransactionUpdate(transaction.ID, transaction)
 
 	return nil
 }
 
-func (s *CallbackService) HandleCallback(ctx context.Context, jwtToken string, callback moneropay.CallbackResponse) (httpErr *models.HTTPError) {
+// HandleCallback authenticates a MoneroPay callback and stores it in the inbox, where a worker
+// checks it against MoneroPay and processes it. Acknowledging right away keeps slow moments of
+// the database or MoneroPay from losing callbacks. Every callback ends up in the audit log.
+func (s *CallbackService) HandleCallback(ctx context.Context, token string, remoteAddr string, callback moneropay.CallbackResponse, payload []byte) (httpErr *models.HTTPError) {
 	if ctx == nil {
 		return models.NewHTTPError(http.StatusInternalServerError, "context required")
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Validate JWT
-	if jwtToken == "" {
-		return models.NewHTTPError(http.StatusUnauthorized, "JWT is required")
-	}
-
-	type Claims struct {
-		TransactionID uint `json:"transaction_id"`
-		jwt.RegisteredClaims
+	audit := &models.CallbackAuditLog{
+		RemoteAddr: remoteAddr,
+		Outcome:    models.CallbackOutcomeAccepted,
 	}
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(jwtToken, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, models.NewHTTPError(http.StatusUnauthorized, "invalid signing method")
+	defer func() {
+		if httpErr != nil {
+			audit.Outcome = models.CallbackOutcomeRejected
+			audit.Reason = &httpErr.Message
 		}
-		return []byte(s.config.JWTMoneroPaySecret), nil
-	})
+		auditPayload(audit, payload)
+		s.auditCallback(ctx, audit)
+	}()
 
-	if err != nil {
-		return models.NewHTTPError(http.StatusUnauthorized, "Invalid token: "+err.Error())
+	if _, ok := s.payments.Get(payment.BackendMoneroPay); !ok {
+		return models.NewHTTPError(http.StatusNotFound, "MoneroPay callbacks are not enabled")
 	}
 
-	if !token.Valid {
-		return models.NewHTTPError(http.StatusUnauthorized, "Invalid token")
+	if !s.callbackSourceAllowed(remoteAddr) {
+		return models.NewHTTPError(http.StatusForbidden, "Callback source not allowed")
 	}
 
-	httpErr = s.processTransaction(ctx, claims.TransactionID, callback.ToReceiveAddressResponse())
+	transaction, httpErr := s.authenticateCallback(ctx, token)
 	if httpErr != nil {
 		return httpErr
 	}
+	audit.TransactionID = &transaction.ID
+
+	entry := &models.CallbackInboxEntry{
+		TransactionID: transaction.ID,
+		Payload:       string(payload),
+		Status:        models.CallbackInboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	if callback.Transaction != nil {
+		entry.TxHash = callback.Transaction.TxHash
+		entry.Confirmations = callback.Transaction.Confirmations
+	}
+	created, err := s.repo.CreateInboxEntry(ctx, entry)
+	if err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "Failed to store callback: "+err.Error())
+	}
+	if !created {
+		reason := "duplicate callback"
+		audit.Outcome = models.CallbackOutcomeIgnored
+		audit.Reason = &reason
+		return nil
+	}
+
+	s.wakeInbox()
 	return nil
 }
@@ -0,0 +1,195 @@
+package callback
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/payment"
+)
+
+// callbackSourceAllowed checks the callback's peer against CALLBACK_ALLOWED_IPS
+func (s *CallbackService) callbackSourceAllowed(remoteAddr string) bool {
+	if len(s.config.CallbackAllowedIPs) == 0 {
+		return true
+	}
+
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	var addr netip.Addr
+	if err == nil {
+		addr = addrPort.Addr()
+	} else if addr, err = netip.ParseAddr(remoteAddr); err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range s.config.CallbackAllowedIPs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyCallbackMaxAge is how long after its creation a transaction may still be called back
+// with a JWT. Older ones are left to the confirmation checker, so JWT_MONEROPAY_SECRET can be
+// removed once this long has passed since the upgrade to callback secrets.
+const legacyCallbackMaxAge = 7 * 24 * time.Hour
+
+// authenticateCallback resolves the callback token to its transaction. Tokens are
+// "<transaction id>.<secret>", checked against the hash stored with the transaction. Invoices
+// created before callback secrets still carry a JWT, see legacyTokenAccepted.
+//
+// Unlike a single-use token, the secret is deliberately accepted more than once until the
+// transaction is confirmed, as MoneroPay posts to the same callback URL for every payment and
+// confirmation of the invoice. Reuse is harmless: a secret only reaches its own transaction, a
+// callback only tells the inbox worker to look the invoice up in MoneroPay, and one claiming more
+// than MoneroPay reports is dropped (compareCallback). A replayed callback therefore costs at most
+// one extra status lookup. Once the transaction is confirmed its token is refused.
+func (s *CallbackService) authenticateCallback(ctx context.Context, token string) (*models.Transaction, *models.HTTPError) {
+	transaction, httpErr := s.resolveCallbackToken(ctx, token)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if transaction.Confirmed {
+		return nil, models.NewHTTPError(http.StatusGone, "Callback token expired, the transaction is confirmed")
+	}
+	return transaction, nil
+}
+
+func (s *CallbackService) resolveCallbackToken(ctx context.Context, token string) (*models.Transaction, *models.HTTPError) {
+	if token == "" {
+		return nil, models.NewHTTPError(http.StatusUnauthorized, "Callback token is required")
+	}
+
+	if idPart, secret, found := strings.Cut(token, "."); found {
+		if id, err := strconv.ParseUint(idPart, 10, 64); err == nil {
+			transaction, err := s.repo.FindTransactionByID(ctx, uint(id))
+			if err != nil || transaction.CallbackSecretHash == nil || transaction.PaymentBackend != payment.BackendMoneroPay {
+				return nil, models.NewHTTPError(http.StatusUnauthorized, "Invalid callback token")
+			}
+			hash := payment.HashCallbackSecret(secret)
+			if subtle.ConstantTimeCompare([]byte(hash), []byte(*transaction.CallbackSecretHash)) != 1 {
+				return nil, models.NewHTTPError(http.StatusUnauthorized, "Invalid callback token")
+			}
+			return transaction, nil
+		}
+	}
+
+	if s.config.JWTMoneroPaySecret == "" {
+		return nil, models.NewHTTPError(http.StatusUnauthorized, "Invalid callback token")
+	}
+
+	type Claims struct {
+		TransactionID uint `json:"transaction_id"`
+		jwt.RegisteredClaims
+	}
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, models.NewHTTPError(http.StatusUnauthorized, "invalid signing method")
+		}
+		return []byte(s.config.JWTMoneroPaySecret), nil
+	})
+	if err != nil || !parsed.Valid {
+		return nil, models.NewHTTPError(http.StatusUnauthorized, "Invalid callback token")
+	}
+
+	transaction, err := s.repo.FindTransactionByID(ctx, claims.TransactionID)
+	if err != nil || transaction.PaymentBackend != payment.BackendMoneroPay {
+		return nil, models.NewHTTPError(http.StatusUnauthorized, "Invalid callback token")
+	}
+	firstSecretAt, err := s.repo.FirstCallbackSecretAt(ctx)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "Failed to check callback token: "+err.Error())
+	}
+	if !legacyTokenAccepted(transaction, firstSecretAt, time.Now()) {
+		return nil, models.NewHTTPError(http.StatusUnauthorized, "Invalid callback token")
+	}
+	return transaction, nil
+}
+
+// legacyTokenAccepted reports whether a JWT may still call back the transaction: only
+// transactions without a callback secret that were created before the first one with a secret,
+// and for legacyCallbackMaxAge at most
+func legacyTokenAccepted(transaction *models.Transaction, firstSecretAt *time.Time, now time.Time) bool {
+	if transaction.CallbackSecretHash != nil {
+		return false
+	}
+	if firstSecretAt != nil && !transaction.CreatedAt.Before(*firstSecretAt) {
+		return false
+	}
+	return now.Sub(transaction.CreatedAt) < legacyCallbackMaxAge
+}
+
+// compareCallback rejects a callback that claims more than MoneroPay reports. MoneroPay may be
+// ahead of the callback, so higher confirmations or amounts on its side are fine.
+func compareCallback(claimed *payment.Status, actual *payment.Status) error {
+	if claimed.Received > actual.Received {
+		return fmt.Errorf("callback reports %d received, MoneroPay %d", claimed.Received, actual.Received)
+	}
+	if claimed.Unlocked > actual.Unlocked {
+		return fmt.Errorf("callback reports %d unlocked, MoneroPay %d", claimed.Unlocked, actual.Unlocked)
+	}
+	for _, claimedPayment := range claimed.Payments {
+		var found *payment.Payment
+		for i := range actual.Payments {
+			if actual.Payments[i].TxHash == claimedPayment.TxHash {
+				found = &actual.Payments[i]
+				break
+			}
+		}
+		switch {
+		case found == nil:
+			return fmt.Errorf("payment %s is unknown to MoneroPay", claimedPayment.TxHash)
+		case found.Amount != claimedPayment.Amount:
+			return fmt.Errorf("payment %s amount is %d, MoneroPay reports %d", claimedPayment.TxHash, claimedPayment.Amount, found.Amount)
+		case found.Confirmations < claimedPayment.Confirmations:
+			return fmt.Errorf("payment %s has %d confirmations, MoneroPay reports %d", claimedPayment.TxHash, claimedPayment.Confirmations, found.Confirmations)
+		}
+	}
+	return nil
+}
+
+// auditCallback stores the audit entry even when the request context has run out
+func (s *CallbackService) auditCallback(ctx context.Context, entry *models.CallbackAuditLog) {
+	auditCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.repo.CreateCallbackAuditLog(auditCtx, entry); err != nil {
+		log.Printf("Error storing callback audit log: %v", err)
+	}
+}
+
+// Stored bytes of a callback body. Rejected callbacks come from anyone who can reach the
+// endpoint, so only enough of them is kept to recognise the sender.
+const (
+	maxAuditPayload         = 16 << 10
+	maxRejectedAuditPayload = 256
+)
+
+// auditPayload stores the size and hash of the callback body and as much of it as the outcome
+// allows
+func auditPayload(entry *models.CallbackAuditLog, payload []byte) {
+	hash := sha256.Sum256(payload)
+	entry.PayloadHash = hex.EncodeToString(hash[:])
+	entry.PayloadSize = len(payload)
+
+	limit := maxAuditPayload
+	if entry.Outcome == models.CallbackOutcomeRejected {
+		limit = maxRejectedAuditPayload
+	}
+	if len(payload) > limit {
+		payload = payload[:limit]
+	}
+	entry.Payload = strings.ToValidUTF8(string(payload), "")
+}
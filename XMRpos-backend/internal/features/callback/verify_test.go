@@ -0,0 +1,76 @@
+package callback
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+func TestAuditPayload(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), maxAuditPayload+1)
+	tests := []struct {
+		name    string
+		outcome models.CallbackOutcome
+		payload []byte
+		stored  int
+	}{
+		{"accepted", models.CallbackOutcomeAccepted, []byte(`{"amount":{"expected":1}}`), 25},
+		{"accepted too large", models.CallbackOutcomeAccepted, large, maxAuditPayload},
+		{"rejected", models.CallbackOutcomeRejected, large, maxRejectedAuditPayload},
+		{"rejected small", models.CallbackOutcomeRejected, []byte("{}"), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &models.CallbackAuditLog{Outcome: tt.outcome}
+			auditPayload(entry, tt.payload)
+
+			if len(entry.Payload) != tt.stored {
+				t.Errorf("stored %d bytes, want %d", len(entry.Payload), tt.stored)
+			}
+			if entry.PayloadSize != len(tt.payload) {
+				t.Errorf("PayloadSize = %d, want %d", entry.PayloadSize, len(tt.payload))
+			}
+			hash := sha256.Sum256(tt.payload)
+			if entry.PayloadHash != hex.EncodeToString(hash[:]) {
+				t.Errorf("PayloadHash = %s, want the hash of the whole body", entry.PayloadHash)
+			}
+		})
+	}
+}
+
+func TestLegacyTokenAccepted(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	firstSecretAt := now.Add(-24 * time.Hour)
+	secretHash := "hash"
+	tests := []struct {
+		name          string
+		createdAt     time.Time
+		secretHash    *string
+		firstSecretAt *time.Time
+		want          bool
+	}{
+		{"before the upgrade", firstSecretAt.Add(-time.Hour), nil, &firstSecretAt, true},
+		{"no secret issued yet", now.Add(-time.Hour), nil, nil, true},
+		{"has a secret", firstSecretAt.Add(-time.Hour), &secretHash, &firstSecretAt, false},
+		{"created with the first secret", firstSecretAt, nil, &firstSecretAt, false},
+		{"created after the upgrade", now.Add(-time.Hour), nil, &firstSecretAt, false},
+		{"almost too old", now.Add(-legacyCallbackMaxAge + time.Second), nil, nil, true},
+		{"too old", now.Add(-legacyCallbackMaxAge), nil, nil, false},
+		{"too old before the upgrade", now.Add(-30 * 24 * time.Hour), nil, &firstSecretAt, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := &models.Transaction{CallbackSecretHash: tt.secretHash}
+			transaction.CreatedAt = tt.createdAt
+			if got := legacyTokenAccepted(transaction, tt.firstSecretAt, now); got != tt.want {
+				t.Errorf("legacyTokenAccepted() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
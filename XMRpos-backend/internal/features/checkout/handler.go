@@ -0,0 +1,192 @@
+package checkout
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+type CheckoutHandler struct {
+	service *CheckoutService
+}
+
+func NewCheckoutHandler(service *CheckoutService) *CheckoutHandler {
+	return &CheckoutHandler{service: service}
+}
+
+// vendorScope returns the vendor of a vendor login or API key. A POS takes its payments in
+// person through /pos/create-transaction.
+func vendorScope(w http.ResponseWriter, r *http.Request) (vendorID uint, ok bool) {
+	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
+	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
+	if vendorIDPtr == nil {
+		http.Error(w, "Vendor ID is required", http.StatusBadRequest)
+		return 0, false
+	}
+	if posIDPtr != nil {
+		http.Error(w, "POS logins create transactions under /pos", http.StatusForbidden)
+		return 0, false
+	}
+	return *vendorIDPtr, true
+}
+
+func (h *CheckoutHandler) CreateCheckout(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB cap
+
+	var req CreateCheckoutRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vendorID, ok := vendorScope(w, r)
+	if !ok {
+		return
+	}
+	apiKeyID, _ := r.Context().Value(models.ClaimsAPIKeyIDKey).(*uint)
+
+	checkout, httpErr := h.service.CreateCheckout(ctx, vendorID, apiKeyID, req)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(checkout)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *CheckoutHandler) GetCheckout(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	checkoutID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid checkout ID", http.StatusBadRequest)
+		return
+	}
+
+	vendorID, ok := vendorScope(w, r)
+	if !ok {
+		return
+	}
+
+	checkout, httpErr := h.service.GetCheckout(ctx, vendorID, uint(checkoutID))
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(checkout)
+}
+
+func (h *CheckoutHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vendorID, ok := vendorScope(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, httpErr := h.service.GetWebhook(ctx, vendorID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(webhook)
+}
+
+type setWebhookRequest struct {
+	URL string `json:"url"`
+}
+
+// SetWebhook answers with the signing secret, which is not shown again
+func (h *CheckoutHandler) SetWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req setWebhookRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vendorID, ok := vendorScope(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, httpErr := h.service.SetWebhook(ctx, vendorID, req.URL)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(webhook)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *CheckoutHandler) RemoveWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vendorID, ok := vendorScope(w, r)
+	if !ok {
+		return
+	}
+
+	if httpErr := h.service.RemoveWebhook(ctx, vendorID); httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := "Checkout webhook removed successfully"
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// PaymentPage renders the hosted payment page of a checkout for the customer
+func (h *CheckoutHandler) PaymentPage(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	page, httpErr := h.service.GetPaymentPage(ctx, chi.URLParam(r, "publicID"))
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src data:; style-src 'unsafe-inline'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := paymentPageTemplate.Execute(w, page); err != nil {
+		log.Printf("Error rendering payment page: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package checkout
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/pkg/qr"
+	"gorm.io/gorm"
+)
+
+const moneroAtomicUnitsPerXMR int64 = 1_000_000_000_000
+
+// PaymentPage is what the customer sees on the hosted payment page
+type PaymentPage struct {
+	OrderID          string
+	Status           string
+	PaymentSeen      bool // A payment arrived and waits for its confirmations
+	AmountXMR        string
+	AmountInCurrency float64
+	Currency         string
+	Address          string
+	PaymentURI       template.URL // monero: URI with the address and amount, for wallets
+	QRCode           template.URL // PNG data URI of PaymentURI
+	ExpiresAt        time.Time
+	RedirectURL      string
+	CancelURL        string
+}
+
+// GetPaymentPage looks up a checkout by the random ID of its payment page
+func (s *CheckoutService) GetPaymentPage(ctx context.Context, publicID string) (*PaymentPage, *models.HTTPError) {
+	checkout, err := s.repo.FindCheckoutByPublicID(ctx, publicID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.NewHTTPError(http.StatusNotFound, "payment not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving payment: "+err.Error())
+	}
+	transaction, err := s.repo.FindTransactionByID(ctx, checkout.TransactionID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving payment: "+err.Error())
+	}
+
+	page := &PaymentPage{
+		OrderID:          checkout.OrderID,
+		Status:           checkout.Status,
+		PaymentSeen:      len(transaction.SubTransactions) > 0,
+		AmountXMR:        formatXMR(transaction.Amount),
+		AmountInCurrency: transaction.AmountInCurrency,
+		Currency:         transaction.Currency,
+		ExpiresAt:        checkout.ExpiresAt.UTC(),
+		RedirectURL:      checkout.RedirectURL,
+		CancelURL:        checkout.CancelURL,
+	}
+	// The page can be opened before the sweeper expired the checkout
+	if page.Status == models.CheckoutStatusPending && !page.PaymentSeen && time.Now().After(checkout.ExpiresAt) {
+		page.Status = models.CheckoutStatusExpired
+	}
+
+	if page.Status == models.CheckoutStatusPending && !page.PaymentSeen && transaction.SubAddress != nil {
+		page.Address = *transaction.SubAddress
+		uri := "monero:" + page.Address + "?tx_amount=" + page.AmountXMR
+		page.PaymentURI = template.URL(uri)
+		qrCode, err := qr.Encode(uri)
+		if err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "error encoding QR code: "+err.Error())
+		}
+		png, err := qrCode.PNG(5)
+		if err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "error rendering QR code: "+err.Error())
+		}
+		page.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+
+	return page, nil
+}
+
+// formatXMR writes atomic units as XMR without trailing zeros, as wallets expect in tx_amount
+func formatXMR(amount int64) string {
+	formatted := fmt.Sprintf("%d.%012d", amount/moneroAtomicUnitsPerXMR, amount%moneroAtomicUnitsPerXMR)
+	return strings.TrimSuffix(strings.TrimRight(formatted, "0"), ".")
+}
+
+var paymentPageTemplate = template.Must(template.New("payment").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="referrer" content="no-referrer">
+{{- if eq .Status "pending"}}
+<meta http-equiv="refresh" content="10">
+{{- else if and (ne .Status "expired") .RedirectURL}}
+<meta http-equiv="refresh" content="3;url={{.RedirectURL}}">
+{{- end}}
+<title>Pay order {{.OrderID}} with Monero</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 2rem auto; padding: 0 1rem; text-align: center; color: #222; }
+code { display: block; word-break: break-all; background: #f4f4f4; padding: .5rem; }
+img { width: 100%; max-width: 16rem; image-rendering: pixelated; }
+</style>
+</head>
+<body>
+<h1>Order {{.OrderID}}</h1>
+{{- if and (eq .Status "pending") .PaymentSeen}}
+<p>Payment seen, waiting for its confirmations. This page updates once it is accepted.</p>
+{{- else if eq .Status "pending"}}
+<p>Send exactly <strong>{{.AmountXMR}} XMR</strong>{{if .Currency}} ({{printf "%.2f" .AmountInCurrency}} {{.Currency}}){{end}} to</p>
+{{- if .QRCode}}
+<p><a href="{{.PaymentURI}}"><img src="{{.QRCode}}" alt="QR code of the payment"></a></p>
+{{- end}}
+<code>{{.Address}}</code>
+<p>This page updates once the payment is seen. It expires at {{.ExpiresAt.Format "2006-01-02 15:04 UTC"}}.</p>
+{{- if .CancelURL}}
+<p><a href="{{.CancelURL}}">Cancel and return to the shop</a></p>
+{{- end}}
+{{- else if eq .Status "expired"}}
+<p>This payment expired. Do not send anything to its address.</p>
+{{- if .CancelURL}}
+<p><a href="{{.CancelURL}}">Return to the shop</a></p>
+{{- end}}
+{{- else}}
+<p>Payment received, thank you.</p>
+{{- if .RedirectURL}}
+<p><a href="{{.RedirectURL}}">Return to the shop</a></p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
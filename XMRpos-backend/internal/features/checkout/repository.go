@@ -0,0 +1,255 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CheckoutRepository interface {
+	OrderExists(ctx context.Context, vendorID uint, orderID string) (bool, error)
+	CreateCheckout(ctx context.Context, checkout *models.Checkout) error
+	FindCheckout(ctx context.Context, vendorID uint, id uint) (*models.Checkout, error)
+	FindCheckoutByPublicID(ctx context.Context, publicID string) (*models.Checkout, error)
+	FindCheckoutByTransactionID(ctx context.Context, transactionID uint) (*models.Checkout, error)
+	FindTransactionByID(ctx context.Context, id uint) (*models.Transaction, error)
+	AdvanceCheckout(ctx context.Context, checkout *models.Checkout, from []string, event string, payload string) (bool, error)
+	FindExpiredCheckouts(ctx context.Context, now time.Time, limit int) ([]*models.Checkout, error)
+	FindCheckoutsBehind(ctx context.Context, limit int) ([]*models.Checkout, error)
+	FindCheckoutWebhook(ctx context.Context, vendorID uint) (*models.CheckoutWebhook, error)
+	SaveCheckoutWebhook(ctx context.Context, webhook *models.CheckoutWebhook) error
+	DeleteCheckoutWebhook(ctx context.Context, vendorID uint) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+type checkoutRepository struct {
+	db *gorm.DB
+}
+
+func NewCheckoutRepository(db *gorm.DB) CheckoutRepository {
+	return &checkoutRepository{db: db}
+}
+
+func (r *checkoutRepository) OrderExists(ctx context.Context, vendorID uint, orderID string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.Checkout{}).
+		Where("vendor_id = ? AND order_id = ?", vendorID, orderID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *checkoutRepository) CreateCheckout(ctx context.Context, checkout *models.Checkout) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Create(checkout).Error
+}
+
+func (r *checkoutRepository) FindCheckout(ctx context.Context, vendorID uint, id uint) (*models.Checkout, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var checkout models.Checkout
+	if err := r.db.WithContext(ctx).Where("vendor_id = ?", vendorID).First(&checkout, id).Error; err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+func (r *checkoutRepository) FindCheckoutByPublicID(ctx context.Context, publicID string) (*models.Checkout, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var checkout models.Checkout
+	if err := r.db.WithContext(ctx).Where("public_id = ?", publicID).First(&checkout).Error; err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+func (r *checkoutRepository) FindCheckoutByTransactionID(ctx context.Context, transactionID uint) (*models.Checkout, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var checkout models.Checkout
+	if err := r.db.WithContext(ctx).Where("transaction_id = ?", transactionID).First(&checkout).Error; err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+func (r *checkoutRepository) FindTransactionByID(ctx context.Context, id uint) (*models.Transaction, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var transaction models.Transaction
+	if err := r.db.WithContext(ctx).Preload("SubTransactions").First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// AdvanceCheckout moves the checkout to its new status if it is still in one of the from
+// statuses, and queues the event for the vendor's webhook in the same database transaction. It
+// reports false when another worker moved the checkout first.
+func (r *checkoutRepository) AdvanceCheckout(ctx context.Context, checkout *models.Checkout, from []string, event string, payload string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	advanced := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Checkout{}).
+			Where("id = ? AND status IN ?", checkout.ID, from).
+			Updates(map[string]interface{}{"status": checkout.Status, "paid_at": checkout.PaidAt})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		advanced = true
+
+		var webhook models.CheckoutWebhook
+		err := tx.Where("vendor_id = ?", checkout.VendorID).First(&webhook).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.WebhookDelivery{
+			VendorID:      checkout.VendorID,
+			CheckoutID:    checkout.ID,
+			Event:         event,
+			Payload:       payload,
+			NextAttemptAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return advanced, nil
+}
+
+// FindExpiredCheckouts lists pending checkouts past their expiry. A checkout whose payment was
+// already seen is left to finish, even if it waits for confirmations past the expiry.
+func (r *checkoutRepository) FindExpiredCheckouts(ctx context.Context, now time.Time, limit int) ([]*models.Checkout, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var checkouts []*models.Checkout
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND expires_at <= ?", models.CheckoutStatusPending, now).
+		Where("NOT EXISTS (SELECT 1 FROM sub_transactions s WHERE s.transaction_id = checkouts.transaction_id AND s.deleted_at IS NULL)").
+		Order("id ASC").
+		Limit(limit).
+		Find(&checkouts).Error; err != nil {
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+// FindCheckoutsBehind lists checkouts whose transaction was accepted or confirmed without the
+// checkout following, because updating it failed after the transaction was stored
+func (r *checkoutRepository) FindCheckoutsBehind(ctx context.Context, limit int) ([]*models.Checkout, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var checkouts []*models.Checkout
+	if err := r.db.WithContext(ctx).
+		Joins("JOIN transactions t ON t.id = checkouts.transaction_id").
+		Where("(t.confirmed AND checkouts.status <> ?) OR (t.accepted AND checkouts.status IN ?)",
+			models.CheckoutStatusConfirmed, []string{models.CheckoutStatusPending, models.CheckoutStatusExpired}).
+		Order("checkouts.id ASC").
+		Limit(limit).
+		Find(&checkouts).Error; err != nil {
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+func (r *checkoutRepository) FindCheckoutWebhook(ctx context.Context, vendorID uint) (*models.CheckoutWebhook, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var webhook models.CheckoutWebhook
+	if err := r.db.WithContext(ctx).Where("vendor_id = ?", vendorID).First(&webhook).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// SaveCheckoutWebhook creates or replaces the vendor's webhook
+func (r *checkoutRepository) SaveCheckoutWebhook(ctx context.Context, webhook *models.CheckoutWebhook) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "vendor_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"url", "secret", "updated_at"}),
+	}).Create(webhook).Error
+}
+
+// DeleteCheckoutWebhook removes the webhook and drops the deliveries still waiting for it
+func (r *checkoutRepository) DeleteCheckoutWebhook(ctx context.Context, vendorID uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("vendor_id = ?", vendorID).Delete(&models.CheckoutWebhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("vendor_id = ? AND delivered_at IS NULL AND failed_at IS NULL", vendorID).
+			Delete(&models.WebhookDelivery{}).Error
+	})
+}
+
+// ClaimWebhookDeliveries takes up to limit due deliveries and leases them like the callback
+// inbox does, so concurrent senders never post the same delivery at once
+func (r *checkoutRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	now := time.Now()
+	var deliveries []*models.WebhookDelivery
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?
+			ORDER BY id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(lease), now, limit,
+	).Scan(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *checkoutRepository) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).
+		Select("next_attempt_at", "delivered_at", "failed_at", "last_error").
+		Updates(delivery).Error
+}
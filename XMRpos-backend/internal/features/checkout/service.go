@@ -0,0 +1,369 @@
+package checkout
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/notify"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/pos"
+	"gorm.io/gorm"
+)
+
+const (
+	maxCheckoutTTL   = 7 * 24 * time.Hour
+	maxMetadataBytes = 4096
+	sweepBatchSize   = 100
+)
+
+type CheckoutService struct {
+	repo     CheckoutRepository
+	config   *config.Config
+	pos      *pos.PosService
+	notifier *notify.Notifier
+	client   *http.Client
+
+	webhookWake chan struct{}
+}
+
+func NewCheckoutService(repo CheckoutRepository, cfg *config.Config, posService *pos.PosService, notifier *notify.Notifier) *CheckoutService {
+	return &CheckoutService{
+		repo:        repo,
+		config:      cfg,
+		pos:         posService,
+		notifier:    notifier,
+		client:      newWebhookClient(cfg.CheckoutWebhookAllowPrivate),
+		webhookWake: make(chan struct{}, 1),
+	}
+}
+
+// CreateCheckoutRequest is an online order to be paid on the hosted payment page
+type CreateCheckoutRequest struct {
+	OrderID               string          `json:"order_id"`
+	Amount                int64           `json:"amount"`
+	AmountInCurrency      float64         `json:"amount_in_currency"`
+	Currency              string          `json:"currency"`
+	Description           *string         `json:"description"`
+	RedirectURL           string          `json:"redirect_url"`
+	CancelURL             string          `json:"cancel_url"`
+	Metadata              json.RawMessage `json:"metadata"`
+	RequiredConfirmations int64           `json:"required_confirmations"`
+	ExpiresInMinutes      int64           `json:"expires_in_minutes"`
+}
+
+// Checkout is a checkout as returned to the vendor and sent in its webhooks
+type Checkout struct {
+	ID               uint            `json:"id"`
+	OrderID          string          `json:"order_id"`
+	TransactionID    uint            `json:"transaction_id"`
+	Status           string          `json:"status"`
+	Amount           int64           `json:"amount"`
+	AmountInCurrency float64         `json:"amount_in_currency"`
+	Currency         string          `json:"currency"`
+	Address          string          `json:"address"`
+	PaymentURL       string          `json:"payment_url"`
+	RedirectURL      string          `json:"redirect_url"`
+	CancelURL        string          `json:"cancel_url"`
+	Metadata         json.RawMessage `json:"metadata"`
+	CreatedAt        time.Time       `json:"created_at"`
+	ExpiresAt        time.Time       `json:"expires_at"`
+	PaidAt           *time.Time      `json:"paid_at"`
+}
+
+// CreateCheckout creates the transaction of an online order the same way a POS does, and a
+// payment page for the customer. apiKeyID is the API key that made the request, if any.
+func (s *CheckoutService) CreateCheckout(ctx context.Context, vendorID uint, apiKeyID *uint, req CreateCheckoutRequest) (*Checkout, *models.HTTPError) {
+	if s.config.PublicBaseURL == "" {
+		return nil, models.NewHTTPError(http.StatusServiceUnavailable, "online checkout is not enabled, PUBLIC_BASE_URL is not set")
+	}
+
+	req.OrderID = strings.TrimSpace(req.OrderID)
+	if len(req.OrderID) < 1 || len(req.OrderID) > 100 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "order_id must be at least 1 character and no more than 100 characters")
+	}
+	if req.Amount <= 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "amount must be positive")
+	}
+	req.Currency = strings.TrimSpace(req.Currency)
+	if len(req.Currency) < 1 || len(req.Currency) > 10 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "currency must be at least 1 character and no more than 10 characters")
+	}
+	if req.RequiredConfirmations < 0 || req.RequiredConfirmations > 10 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "required_confirmations must be between 0 and 10")
+	}
+	if err := validateShopURL(req.RedirectURL, false); err != nil {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "redirect_url "+err.Error())
+	}
+	if err := validateShopURL(req.CancelURL, true); err != nil {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "cancel_url "+err.Error())
+	}
+	metadata, err := normalizeMetadata(req.Metadata)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "metadata "+err.Error())
+	}
+
+	ttl := s.config.CheckoutTTL
+	if req.ExpiresInMinutes != 0 {
+		ttl = time.Duration(req.ExpiresInMinutes) * time.Minute
+		if req.ExpiresInMinutes < 0 || ttl > maxCheckoutTTL {
+			return nil, models.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("expires_in_minutes must be between 1 and %d", int64(maxCheckoutTTL/time.Minute)))
+		}
+	}
+
+	// Checked before the transaction so a retried order does not take another subaddress
+	exists, err := s.repo.OrderExists(ctx, vendorID, req.OrderID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error checking order: "+err.Error())
+	}
+	if exists {
+		return nil, models.NewHTTPError(http.StatusConflict, "a checkout for this order_id already exists")
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error generating checkout ID: "+err.Error())
+	}
+
+	transactionID, address, err := s.pos.CreateTransaction(ctx, vendorID, nil, nil, req.Amount, req.Description, req.AmountInCurrency, req.Currency, req.RequiredConfirmations)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error creating transaction: "+err.Error())
+	}
+
+	checkout := &models.Checkout{
+		VendorID:      vendorID,
+		OrderID:       req.OrderID,
+		TransactionID: transactionID,
+		APIKeyID:      apiKeyID,
+		PublicID:      hex.EncodeToString(raw),
+		RedirectURL:   req.RedirectURL,
+		CancelURL:     req.CancelURL,
+		Metadata:      metadata,
+		Status:        models.CheckoutStatusPending,
+		ExpiresAt:     time.Now().Add(ttl),
+	}
+	if err := s.repo.CreateCheckout(ctx, checkout); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error creating checkout: "+err.Error())
+	}
+
+	return &Checkout{
+		ID:               checkout.ID,
+		OrderID:          checkout.OrderID,
+		TransactionID:    transactionID,
+		Status:           checkout.Status,
+		Amount:           req.Amount,
+		AmountInCurrency: req.AmountInCurrency,
+		Currency:         req.Currency,
+		Address:          address,
+		PaymentURL:       s.paymentURL(checkout),
+		RedirectURL:      checkout.RedirectURL,
+		CancelURL:        checkout.CancelURL,
+		Metadata:         json.RawMessage(checkout.Metadata),
+		CreatedAt:        checkout.CreatedAt,
+		ExpiresAt:        checkout.ExpiresAt,
+	}, nil
+}
+
+func (s *CheckoutService) GetCheckout(ctx context.Context, vendorID uint, id uint) (*Checkout, *models.HTTPError) {
+	checkout, err := s.repo.FindCheckout(ctx, vendorID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.NewHTTPError(http.StatusNotFound, "checkout not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving checkout: "+err.Error())
+	}
+	transaction, err := s.repo.FindTransactionByID(ctx, checkout.TransactionID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving transaction: "+err.Error())
+	}
+	return s.describe(checkout, transaction), nil
+}
+
+// TransactionUpdated moves the checkout of an online transaction along after a payment was
+// processed, and queues the webhook for the vendor. Transactions of a POS are ignored.
+func (s *CheckoutService) TransactionUpdated(ctx context.Context, transaction *models.Transaction) error {
+	if transaction.PosID != nil {
+		return nil
+	}
+	checkout, err := s.repo.FindCheckoutByTransactionID(ctx, transaction.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.advance(ctx, checkout, transaction)
+}
+
+// advance moves the checkout to the status its transaction reached. Statuses only move forward:
+// a payment arriving after the checkout expired still marks it paid, so the shop learns of it.
+func (s *CheckoutService) advance(ctx context.Context, checkout *models.Checkout, transaction *models.Transaction) error {
+	var status, event string
+	var from []string
+	switch {
+	case transaction.Confirmed:
+		status, event = models.CheckoutStatusConfirmed, models.CheckoutEventConfirmed
+		from = []string{models.CheckoutStatusPending, models.CheckoutStatusExpired, models.CheckoutStatusPaid}
+	case transaction.Accepted:
+		status, event = models.CheckoutStatusPaid, models.CheckoutEventPaid
+		from = []string{models.CheckoutStatusPending, models.CheckoutStatusExpired}
+	default:
+		return nil
+	}
+	if checkout.Status == status {
+		return nil
+	}
+
+	checkout.Status = status
+	if checkout.PaidAt == nil {
+		now := time.Now()
+		checkout.PaidAt = &now
+	}
+	return s.queueEvent(ctx, checkout, transaction, from, event)
+}
+
+// StartCheckoutSweeper expires checkouts that were not paid in time, and catches up on
+// checkouts whose transaction moved on while updating them failed
+func (s *CheckoutService) StartCheckoutSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.sweep(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s *CheckoutService) sweep(ctx context.Context) {
+	expired, err := s.repo.FindExpiredCheckouts(ctx, time.Now(), sweepBatchSize)
+	if err != nil {
+		log.Printf("Checkout sweeper: error finding expired checkouts: %v", err)
+		return
+	}
+	for _, checkout := range expired {
+		transaction, err := s.repo.FindTransactionByID(ctx, checkout.TransactionID)
+		if err != nil {
+			log.Printf("Checkout sweeper: error retrieving transaction of checkout %d: %v", checkout.ID, err)
+			continue
+		}
+		checkout.Status = models.CheckoutStatusExpired
+		if err := s.queueEvent(ctx, checkout, transaction, []string{models.CheckoutStatusPending}, models.CheckoutEventExpired); err != nil {
+			log.Printf("Checkout sweeper: error expiring checkout %d: %v", checkout.ID, err)
+		}
+	}
+
+	behind, err := s.repo.FindCheckoutsBehind(ctx, sweepBatchSize)
+	if err != nil {
+		log.Printf("Checkout sweeper: error finding checkouts to update: %v", err)
+		return
+	}
+	for _, checkout := range behind {
+		transaction, err := s.repo.FindTransactionByID(ctx, checkout.TransactionID)
+		if err != nil {
+			log.Printf("Checkout sweeper: error retrieving transaction of checkout %d: %v", checkout.ID, err)
+			continue
+		}
+		if err := s.advance(ctx, checkout, transaction); err != nil {
+			log.Printf("Checkout sweeper: error updating checkout %d: %v", checkout.ID, err)
+		}
+	}
+}
+
+func (s *CheckoutService) queueEvent(ctx context.Context, checkout *models.Checkout, transaction *models.Transaction, from []string, event string) error {
+	payload, err := json.Marshal(webhookEvent{
+		Event:     event,
+		Checkout:  s.describe(checkout, transaction),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	advanced, err := s.repo.AdvanceCheckout(ctx, checkout, from, event, string(payload))
+	if err != nil {
+		return err
+	}
+	if advanced {
+		s.wakeWebhookSender()
+	}
+	return nil
+}
+
+func (s *CheckoutService) describe(checkout *models.Checkout, transaction *models.Transaction) *Checkout {
+	var address string
+	if transaction.SubAddress != nil {
+		address = *transaction.SubAddress
+	}
+	return &Checkout{
+		ID:               checkout.ID,
+		OrderID:          checkout.OrderID,
+		TransactionID:    checkout.TransactionID,
+		Status:           checkout.Status,
+		Amount:           transaction.Amount,
+		AmountInCurrency: transaction.AmountInCurrency,
+		Currency:         transaction.Currency,
+		Address:          address,
+		PaymentURL:       s.paymentURL(checkout),
+		RedirectURL:      checkout.RedirectURL,
+		CancelURL:        checkout.CancelURL,
+		Metadata:         json.RawMessage(checkout.Metadata),
+		CreatedAt:        checkout.CreatedAt,
+		ExpiresAt:        checkout.ExpiresAt,
+		PaidAt:           checkout.PaidAt,
+	}
+}
+
+func (s *CheckoutService) paymentURL(checkout *models.Checkout) string {
+	return s.config.PublicBaseURL + "/pay/" + checkout.PublicID
+}
+
+// validateShopURL accepts absolute http and https URLs, which is all a browser is sent back to
+func validateShopURL(raw string, optional bool) error {
+	if raw == "" {
+		if optional {
+			return nil
+		}
+		return errors.New("is required")
+	}
+	if len(raw) > 2048 {
+		return errors.New("must be no more than 2048 characters")
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// normalizeMetadata checks the metadata is a JSON object of a few kilobytes and compacts it
+func normalizeMetadata(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "{}", nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return "", errors.New("must be a JSON object")
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return "", err
+	}
+	if compact.Len() > maxMetadataBytes {
+		return "", fmt.Errorf("must be no more than %d bytes", maxMetadataBytes)
+	}
+	return compact.String(), nil
+}
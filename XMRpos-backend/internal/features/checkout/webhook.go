@@ -0,0 +1,267 @@
+package checkout
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+const (
+	webhookBatchSize   = 10
+	webhookLease       = 2 * time.Minute // Time a claimed delivery has before another sender may take it
+	webhookMaxAttempts = 14              // With the growing delay, retries run for about a day
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = 6 * time.Hour
+)
+
+// Headers of a webhook delivery. The signature is "t=<unix time>,v1=<hex HMAC-SHA256>" over
+// "<unix time>.<body>", keyed with the vendor's webhook secret.
+const (
+	webhookSignatureHeader = "X-XMRpos-Signature"
+	webhookEventHeader     = "X-XMRpos-Event"
+	webhookDeliveryHeader  = "X-XMRpos-Delivery"
+)
+
+var errPrivateAddress = errors.New("webhook address is not public")
+
+// carrierGradeNAT is the shared address space of RFC 6598, internal to the provider like private ranges
+var carrierGradeNAT = netip.MustParsePrefix("100.64.0.0/10")
+
+// webhookEvent is the body posted to the vendor's webhook
+type webhookEvent struct {
+	Event     string    `json:"event"`
+	Checkout  *Checkout `json:"checkout"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CheckoutWebhook is the vendor's webhook as shown to it. The secret is only returned when the
+// webhook is set.
+type CheckoutWebhook struct {
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (s *CheckoutService) GetWebhook(ctx context.Context, vendorID uint) (*CheckoutWebhook, *models.HTTPError) {
+	webhook, err := s.repo.FindCheckoutWebhook(ctx, vendorID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.NewHTTPError(http.StatusNotFound, "no checkout webhook set")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving checkout webhook: "+err.Error())
+	}
+	return &CheckoutWebhook{URL: webhook.URL, UpdatedAt: webhook.UpdatedAt}, nil
+}
+
+// SetWebhook sets the URL checkout events are posted to, with a new signing secret. The old
+// secret stops working right away.
+func (s *CheckoutService) SetWebhook(ctx context.Context, vendorID uint, webhookURL string) (*CheckoutWebhook, *models.HTTPError) {
+	if err := validateShopURL(webhookURL, false); err != nil {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "url "+err.Error())
+	}
+	if !s.config.CheckoutWebhookAllowPrivate && !strings.HasPrefix(webhookURL, "https://") {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "url must use https")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error generating webhook secret: "+err.Error())
+	}
+
+	webhook := &models.CheckoutWebhook{
+		VendorID: vendorID,
+		URL:      webhookURL,
+		Secret:   "whsec_" + hex.EncodeToString(raw),
+	}
+	if err := s.repo.SaveCheckoutWebhook(ctx, webhook); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error saving checkout webhook: "+err.Error())
+	}
+	return &CheckoutWebhook{URL: webhook.URL, Secret: webhook.Secret, UpdatedAt: webhook.UpdatedAt}, nil
+}
+
+// RemoveWebhook stops checkout events, including the deliveries still waiting
+func (s *CheckoutService) RemoveWebhook(ctx context.Context, vendorID uint) *models.HTTPError {
+	if err := s.repo.DeleteCheckoutWebhook(ctx, vendorID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.NewHTTPError(http.StatusNotFound, "no checkout webhook set")
+		}
+		return models.NewHTTPError(http.StatusInternalServerError, "error removing checkout webhook: "+err.Error())
+	}
+	return nil
+}
+
+// StartWebhookSender delivers queued checkout events as they are queued, and every interval
+// for retries
+func (s *CheckoutService) StartWebhookSender(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.drainWebhooks(ctx)
+			select {
+			case <-s.webhookWake:
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s *CheckoutService) wakeWebhookSender() {
+	select {
+	case s.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *CheckoutService) drainWebhooks(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := s.repo.ClaimWebhookDeliveries(ctx, webhookBatchSize, webhookLease)
+		if err != nil {
+			log.Printf("Checkout webhooks: error claiming deliveries: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+		for _, delivery := range deliveries {
+			s.processDelivery(ctx, delivery)
+		}
+	}
+}
+
+func (s *CheckoutService) processDelivery(ctx context.Context, delivery *models.WebhookDelivery) {
+	deliveryCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	err := s.deliver(deliveryCtx, delivery)
+	cancel()
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		delivery.DeliveredAt = &now
+		delivery.LastError = nil
+	case delivery.Attempts >= webhookMaxAttempts:
+		message := err.Error()
+		delivery.FailedAt = &now
+		delivery.LastError = &message
+		log.Printf("Checkout webhooks: giving up on delivery %d of vendor %d: %v", delivery.ID, delivery.VendorID, err)
+		s.notifier.NotifyVendor(ctx, delivery.VendorID, "Checkout webhook failed",
+			fmt.Sprintf("The %s event of checkout %d could not be delivered to your webhook: %s", delivery.Event, delivery.CheckoutID, message))
+	default:
+		message := err.Error()
+		delivery.NextAttemptAt = now.Add(webhookRetryDelay(delivery.Attempts))
+		delivery.LastError = &message
+	}
+
+	// Stored with a fresh context so a shutdown does not leave the delivery leased for nothing
+	updateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.repo.UpdateWebhookDelivery(updateCtx, delivery); err != nil {
+		log.Printf("Checkout webhooks: error updating delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// deliver posts the event to the vendor's current webhook. Any 2xx answer counts as delivered;
+// redirects are not followed.
+func (s *CheckoutService) deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	webhook, err := s.repo.FindCheckoutWebhook(ctx, delivery.VendorID)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "XMRpos-Webhook")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(webhookSignatureHeader, "t="+timestamp+",v1="+signWebhook(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func signWebhook(secret string, timestamp string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookRetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 10 {
+		return webhookRetryMax
+	}
+	return min(webhookRetryBase<<(attempts-1), webhookRetryMax)
+}
+
+// newWebhookClient refuses to connect to loopback, private, carrier-grade NAT and link-local
+// addresses unless allowed, so a vendor cannot point its webhook at the operator's internal
+// services. The check runs on the resolved address, which also covers DNS names pointing inside.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddress(host) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would connect on our behalf, past the address check
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func publicAddress(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return !carrierGradeNAT.Contains(addr.Unmap())
+}
@@ -0,0 +1,65 @@
+package checkout
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"203.0.113.7", true},
+		{"100.63.255.255", true},
+		{"100.128.0.1", true},
+		{"2001:db8::1", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"::ffff:100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"224.0.0.1", false},
+		{"not an ip", false},
+	}
+
+	for _, tt := range tests {
+		if got := publicAddress(tt.host); got != tt.want {
+			t.Errorf("publicAddress(%q) = %t, want %t", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookClientBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := newWebhookClient(false)
+	// The check runs before connecting, so the unroutable addresses fail without a network
+	for _, url := range []string{server.URL, "http://100.64.0.1/", "http://[::ffff:100.100.100.100]/", "http://10.0.0.1:8080/"} {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("GET %s succeeded, want it blocked", url)
+			continue
+		}
+		if !errors.Is(err, errPrivateAddress) {
+			t.Errorf("GET %s error = %v, want %v", url, err, errPrivateAddress)
+		}
+	}
+
+	resp, err := newWebhookClient(true).Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET with private addresses allowed error = %v", err)
+	}
+	resp.Body.Close()
+}
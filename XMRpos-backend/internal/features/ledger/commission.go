@@ -0,0 +1,126 @@
+package ledger
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+type CommissionSettings struct {
+	VendorID    uint  `json:"vendor_id"`
+	BasisPoints uint  `json:"basis_points"`
+	FixedAmount int64 `json:"fixed_amount"`
+	Default     bool  `json:"default"` // True when the vendor has no rule of its own
+}
+
+// CommissionFor returns the commission on a transaction of amount, never more than the amount itself
+func (s *LedgerService) CommissionFor(ctx context.Context, vendorID uint, amount int64) (int64, error) {
+	settings, err := s.commissionSettings(ctx, vendorID)
+	if err != nil {
+		return 0, err
+	}
+
+	return commissionOn(amount, settings), nil
+}
+
+// commissionOn applies a rule to amount: the basis points rounded down plus the fixed amount,
+// clamped between zero and the amount. The split multiplication keeps large amounts from overflowing.
+func commissionOn(amount int64, settings *CommissionSettings) int64 {
+	basisPoints := int64(settings.BasisPoints)
+	commission := amount/10000*basisPoints + amount%10000*basisPoints/10000 + settings.FixedAmount
+	if commission > amount {
+		commission = amount
+	}
+	if commission < 0 {
+		commission = 0
+	}
+	return commission
+}
+
+// PostCommission charges the commission stored on a confirmed transaction. It must run in the
+// transaction creating the transfer that pays the vendor out, and returns the amount charged.
+func (s *LedgerService) PostCommission(ctx context.Context, tx *gorm.DB, transaction *models.Transaction) (int64, error) {
+	if transaction.Commission == nil || *transaction.Commission <= 0 {
+		return 0, nil
+	}
+	created, err := s.repo.CreateEntry(ctx, tx, &models.LedgerEntry{
+		VendorID:      transaction.VendorID,
+		Type:          models.LedgerEntryFee,
+		Amount:        *transaction.Commission,
+		DebitAccount:  models.LedgerAccountVendor,
+		CreditAccount: models.LedgerAccountFees,
+		TransactionID: &transaction.ID,
+	})
+	if err != nil || !created {
+		return 0, err
+	}
+	return *transaction.Commission, nil
+}
+
+// GetPendingCommission returns the commission that will be charged with the vendor's next payout
+func (s *LedgerService) GetPendingCommission(ctx context.Context, vendorID uint) (int64, error) {
+	return s.repo.GetPendingCommission(ctx, vendorID)
+}
+
+func (s *LedgerService) GetCommissionSettings(ctx context.Context, vendorID uint) (*CommissionSettings, *models.HTTPError) {
+	settings, err := s.commissionSettings(ctx, vendorID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving commission rule: "+err.Error())
+	}
+	return settings, nil
+}
+
+// SetCommissionRule applies to transactions confirmed from now on; earlier ones keep their commission
+func (s *LedgerService) SetCommissionRule(ctx context.Context, vendorID uint, basisPoints uint, fixedAmount int64) (*CommissionSettings, *models.HTTPError) {
+	if basisPoints > 10000 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "basis_points must be between 0 and 10000")
+	}
+	if fixedAmount < 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "fixed_amount must not be negative")
+	}
+
+	rule := &models.CommissionRule{
+		VendorID:    vendorID,
+		BasisPoints: basisPoints,
+		FixedAmount: fixedAmount,
+	}
+	if err := s.repo.SaveCommissionRule(ctx, rule); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error saving commission rule: "+err.Error())
+	}
+
+	return &CommissionSettings{
+		VendorID:    vendorID,
+		BasisPoints: basisPoints,
+		FixedAmount: fixedAmount,
+	}, nil
+}
+
+// ResetCommissionRule removes the vendor's rule so the configured default applies again
+func (s *LedgerService) ResetCommissionRule(ctx context.Context, vendorID uint) *models.HTTPError {
+	if err := s.repo.DeleteCommissionRule(ctx, vendorID); err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "error removing commission rule: "+err.Error())
+	}
+	return nil
+}
+
+func (s *LedgerService) commissionSettings(ctx context.Context, vendorID uint) (*CommissionSettings, error) {
+	rule, err := s.repo.GetCommissionRule(ctx, vendorID)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		return &CommissionSettings{
+			VendorID:    vendorID,
+			BasisPoints: s.config.CommissionBasisPoints,
+			FixedAmount: s.config.CommissionFixedAmount,
+			Default:     true,
+		}, nil
+	}
+	return &CommissionSettings{
+		VendorID:    vendorID,
+		BasisPoints: rule.BasisPoints,
+		FixedAmount: rule.FixedAmount,
+	}, nil
+}
@@ -0,0 +1,40 @@
+package ledger
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCommissionOn(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      int64
+		basisPoints uint
+		fixedAmount int64
+		want        int64
+	}{
+		{"no rule", 1000000000000, 0, 0, 0},
+		{"basis points", 1000000000000, 150, 0, 15000000000},
+		{"basis points round down", 9999, 1, 0, 0},
+		{"basis points round down above a unit", 19999, 1, 0, 1},
+		{"fractional remainder", 123456789, 250, 0, 3086419},
+		{"fixed amount only", 1000000000000, 0, 20000000, 20000000},
+		{"basis points and fixed amount", 1000000000000, 100, 20000000, 10020000000},
+		{"fixed amount clamped to the sale", 15000000, 0, 20000000, 15000000},
+		{"both clamped to the sale", 1000, 10000, 1, 1000},
+		{"everything", 1000, 10000, 0, 1000},
+		{"zero amount", 0, 100, 0, 0},
+		{"zero amount with fixed amount", 0, 100, 20000000, 0},
+		{"large amount", math.MaxInt64, 10000, 0, math.MaxInt64},
+		{"large amount basis points", math.MaxInt64, 5000, 0, math.MaxInt64 / 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := &CommissionSettings{BasisPoints: tt.basisPoints, FixedAmount: tt.fixedAmount}
+			if got := commissionOn(tt.amount, settings); got != tt.want {
+				t.Errorf("commissionOn(%d) = %d, want %d", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package ledger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+)
+
+type LedgerHandler struct {
+	service *LedgerService
+}
+
+func NewLedgerHandler(service *LedgerService) *LedgerHandler {
+	return &LedgerHandler{service: service}
+}
+
+type adjustmentRequest struct {
+	VendorID uint   `json:"vendor_id"`
+	Amount   int64  `json:"amount"`
+	Memo     string `json:"memo"`
+}
+
+type commissionRuleRequest struct {
+	VendorID    uint  `json:"vendor_id"`
+	BasisPoints uint  `json:"basis_points"`
+	FixedAmount int64 `json:"fixed_amount"`
+	Reset       bool  `json:"reset"` // Remove the vendor's rule and fall back to the default
+}
+
+type refundRequest struct {
+	VendorID      uint    `json:"vendor_id"`
+	TransactionID uint    `json:"transaction_id"`
+	Amount        int64   `json:"amount"`
+	Memo          *string `json:"memo"`
+}
+
+func (h *LedgerHandler) GetVendorStatement(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vendorID, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsVendorIDKey)
+	if !ok {
+		http.Error(w, "Unauthorized: vendorID not found", http.StatusUnauthorized)
+		return
+	}
+
+	from, to, err := parsePeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statement, httpErr := h.service.GetStatement(ctx, *(vendorID.(*uint)), from, to)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statement)
+}
+
+func (h *LedgerHandler) GetAdminStatement(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vendorID, err := strconv.ParseUint(r.URL.Query().Get("vendor_id"), 10, 64)
+	if err != nil || vendorID == 0 {
+		http.Error(w, "vendor_id is required", http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parsePeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statement, httpErr := h.service.GetStatement(ctx, uint(vendorID), from, to)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statement)
+}
+
+func (h *LedgerHandler) CreateAdjustment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req adjustmentRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.VendorID == 0 {
+		http.Error(w, "vendor_id is required", http.StatusBadRequest)
+		return
+	}
+
+	entry, httpErr := h.service.Adjust(ctx, req.VendorID, req.Amount, req.Memo)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entry)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *LedgerHandler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req refundRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.VendorID == 0 || req.TransactionID == 0 {
+		http.Error(w, "vendor_id and transaction_id are required", http.StatusBadRequest)
+		return
+	}
+
+	entry, httpErr := h.service.Refund(ctx, req.VendorID, req.TransactionID, req.Amount, req.Memo)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entry)
+	io.Copy(io.Discard, r.Body)
+}
+
+func (h *LedgerHandler) GetCommissionRule(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vendorID, err := strconv.ParseUint(r.URL.Query().Get("vendor_id"), 10, 64)
+	if err != nil || vendorID == 0 {
+		http.Error(w, "vendor_id is required", http.StatusBadRequest)
+		return
+	}
+
+	settings, httpErr := h.service.GetCommissionSettings(ctx, uint(vendorID))
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(settings)
+}
+
+func (h *LedgerHandler) SetCommissionRule(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req commissionRuleRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.VendorID == 0 {
+		http.Error(w, "vendor_id is required", http.StatusBadRequest)
+		return
+	}
+
+	var settings *CommissionSettings
+	var httpErr *models.HTTPError
+	if req.Reset {
+		if httpErr = h.service.ResetCommissionRule(ctx, req.VendorID); httpErr == nil {
+			settings, httpErr = h.service.GetCommissionSettings(ctx, req.VendorID)
+		}
+	} else {
+		settings, httpErr = h.service.SetCommissionRule(ctx, req.VendorID, req.BasisPoints, req.FixedAmount)
+	}
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(settings)
+	io.Copy(io.Discard, r.Body)
+}
+
+// parsePeriod reads the optional from/to query parameters as unix timestamps
+func parsePeriod(r *http.Request) (from *time.Time, to *time.Time, err error) {
+	query := r.URL.Query()
+	if value := query.Get("from"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, nil, errors.New("from must be a unix timestamp")
+		}
+		t := time.Unix(seconds, 0)
+		from = &t
+	}
+	if value := query.Get("to"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, nil, errors.New("to must be a unix timestamp")
+		}
+		t := time.Unix(seconds, 0)
+		to = &t
+	}
+	return from, to, nil
+}
@@ -0,0 +1,203 @@
+package ledger
+
+import (
+	"context"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LedgerRepository interface {
+	CreateEntry(ctx context.Context, tx *gorm.DB, entry *models.LedgerEntry) (bool, error)
+	LockVendor(ctx context.Context, tx *gorm.DB, vendorID uint) error
+	GetBalance(ctx context.Context, tx *gorm.DB, vendorID uint) (int64, error)
+	GetBalanceBefore(ctx context.Context, vendorID uint, before time.Time) (int64, error)
+	ListEntries(ctx context.Context, vendorID uint, from *time.Time, to *time.Time) ([]*models.LedgerEntry, error)
+	FindTransaction(ctx context.Context, tx *gorm.DB, vendorID uint, transactionID uint) (*models.Transaction, error)
+	GetRefundedAmount(ctx context.Context, tx *gorm.DB, transactionID uint) (int64, error)
+	ListTransactionEntries(ctx context.Context, tx *gorm.DB, transactionID uint) ([]*models.LedgerEntry, error)
+	GetPendingCommission(ctx context.Context, vendorID uint) (int64, error)
+	GetCommissionRule(ctx context.Context, vendorID uint) (*models.CommissionRule, error)
+	SaveCommissionRule(ctx context.Context, rule *models.CommissionRule) error
+	DeleteCommissionRule(ctx context.Context, vendorID uint) error
+}
+
+type ledgerRepository struct {
+	db *gorm.DB
+}
+
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+// vendorBalanceSQL sums the entries from the vendor's point of view: credits add, debits subtract
+const vendorBalanceSQL = "COALESCE(SUM(CASE WHEN credit_account = ? THEN amount WHEN debit_account = ? THEN -amount ELSE 0 END), 0)"
+
+// CreateEntry inserts the entry and reports false when a unique index (one sale credit per
+// transaction, one payout debit per transfer) shows it was already posted
+func (r *ledgerRepository) CreateEntry(ctx context.Context, tx *gorm.DB, entry *models.LedgerEntry) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result := tx.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(entry)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// LockVendor serializes debits per vendor so two concurrent debits cannot both spend the same balance
+func (r *ledgerRepository) LockVendor(ctx context.Context, tx *gorm.DB, vendorID uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var vendor models.Vendor
+	return tx.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		First(&vendor, vendorID).Error
+}
+
+func (r *ledgerRepository) GetBalance(ctx context.Context, tx *gorm.DB, vendorID uint) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if tx == nil {
+		tx = r.db
+	}
+	var balance int64
+	err := tx.WithContext(ctx).Model(&models.LedgerEntry{}).
+		Where("vendor_id = ?", vendorID).
+		Select(vendorBalanceSQL, models.LedgerAccountVendor, models.LedgerAccountVendor).
+		Scan(&balance).Error
+	if err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+func (r *ledgerRepository) GetBalanceBefore(ctx context.Context, vendorID uint, before time.Time) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var balance int64
+	err := r.db.WithContext(ctx).Model(&models.LedgerEntry{}).
+		Where("vendor_id = ? AND created_at < ?", vendorID, before).
+		Select(vendorBalanceSQL, models.LedgerAccountVendor, models.LedgerAccountVendor).
+		Scan(&balance).Error
+	if err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+func (r *ledgerRepository) ListEntries(ctx context.Context, vendorID uint, from *time.Time, to *time.Time) ([]*models.LedgerEntry, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := r.db.WithContext(ctx).Where("vendor_id = ?", vendorID)
+	if from != nil {
+		query = query.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("created_at < ?", *to)
+	}
+	var entries []*models.LedgerEntry
+	if err := query.Order("created_at ASC, id ASC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *ledgerRepository) FindTransaction(ctx context.Context, tx *gorm.DB, vendorID uint, transactionID uint) (*models.Transaction, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var transaction models.Transaction
+	if err := tx.WithContext(ctx).
+		Where("id = ? AND vendor_id = ?", transactionID, vendorID).
+		First(&transaction).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (r *ledgerRepository) GetRefundedAmount(ctx context.Context, tx *gorm.DB, transactionID uint) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var refunded int64
+	err := tx.WithContext(ctx).Model(&models.LedgerEntry{}).
+		Where("transaction_id = ? AND type = ?", transactionID, models.LedgerEntryRefund).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&refunded).Error
+	if err != nil {
+		return 0, err
+	}
+	return refunded, nil
+}
+
+func (r *ledgerRepository) ListTransactionEntries(ctx context.Context, tx *gorm.DB, transactionID uint) ([]*models.LedgerEntry, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var entries []*models.LedgerEntry
+	if err := tx.WithContext(ctx).
+		Where("transaction_id = ?", transactionID).
+		Order("id ASC").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetPendingCommission sums the commission of confirmed transactions not yet part of a transfer
+func (r *ledgerRepository) GetPendingCommission(ctx context.Context, vendorID uint) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var commission int64
+	err := r.db.WithContext(ctx).Model(&models.Transaction{}).
+		Where("vendor_id = ? AND confirmed = ? AND transfer_id IS NULL", vendorID, true).
+		Select("COALESCE(SUM(commission), 0)").
+		Scan(&commission).Error
+	if err != nil {
+		return 0, err
+	}
+	return commission, nil
+}
+
+func (r *ledgerRepository) GetCommissionRule(ctx context.Context, vendorID uint) (*models.CommissionRule, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var rule models.CommissionRule
+	err := r.db.WithContext(ctx).Where("vendor_id = ?", vendorID).First(&rule).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil // Vendor uses the default commission
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *ledgerRepository) SaveCommissionRule(ctx context.Context, rule *models.CommissionRule) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "vendor_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"basis_points", "fixed_amount", "updated_at"}),
+	}).Create(rule).Error
+}
+
+func (r *ledgerRepository) DeleteCommissionRule(ctx context.Context, vendorID uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Hard delete so the vendor can get a new rule without clashing with the unique index
+	return r.db.WithContext(ctx).Unscoped().Where("vendor_id = ?", vendorID).Delete(&models.CommissionRule{}).Error
+}
@@ -0,0 +1,346 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+)
+
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+type LedgerService struct {
+	repo   LedgerRepository
+	db     *gorm.DB
+	config *config.Config
+}
+
+type StatementLine struct {
+	ID            uint                   `json:"id"`
+	CreatedAt     time.Time              `json:"created_at"`
+	Type          models.LedgerEntryType `json:"type"`
+	Amount        int64                  `json:"amount"` // Signed from the vendor's point of view
+	TransactionID *uint                  `json:"transaction_id,omitempty"`
+	TransferID    *uint                  `json:"transfer_id,omitempty"`
+	Memo          *string                `json:"memo,omitempty"`
+	Balance       int64                  `json:"balance"` // Running balance after this entry
+}
+
+type Statement struct {
+	VendorID       uint            `json:"vendor_id"`
+	OpeningBalance int64           `json:"opening_balance"`
+	ClosingBalance int64           `json:"closing_balance"`
+	Entries        []StatementLine `json:"entries"`
+}
+
+func NewLedgerService(repo LedgerRepository, db *gorm.DB, cfg *config.Config) *LedgerService {
+	return &LedgerService{repo: repo, db: db, config: cfg}
+}
+
+func (s *LedgerService) GetBalance(ctx context.Context, vendorID uint) (int64, error) {
+	return s.repo.GetBalance(ctx, nil, vendorID)
+}
+
+// LockVendor serializes ledger debits of the vendor until tx ends
+func (s *LedgerService) LockVendor(ctx context.Context, tx *gorm.DB, vendorID uint) error {
+	return s.repo.LockVendor(ctx, tx, vendorID)
+}
+
+// BalanceForUpdate locks the vendor for the rest of tx and returns its balance, so a debit
+// posted in the same transaction can rely on it
+func (s *LedgerService) BalanceForUpdate(ctx context.Context, tx *gorm.DB, vendorID uint) (int64, error) {
+	if err := s.repo.LockVendor(ctx, tx, vendorID); err != nil {
+		return 0, err
+	}
+	return s.repo.GetBalance(ctx, tx, vendorID)
+}
+
+// saleCreditState summarizes the credit entries of a transaction: whether the sale was credited,
+// whether that credit is currently taken back by a reorg, and the amount credited for it
+func saleCreditState(entries []*models.LedgerEntry) (credited bool, reversed bool, amount int64) {
+	reversals, recredits := 0, 0
+	for _, entry := range entries {
+		switch entry.Type {
+		case models.LedgerEntrySaleCredit:
+			credited = true
+			amount += entry.Amount
+		case models.LedgerEntryOverpaymentCredit:
+			amount += entry.Amount
+		case models.LedgerEntryReorgReversal:
+			reversals++
+		case models.LedgerEntryReorgCredit:
+			recredits++
+		}
+	}
+	return credited, reversals > recredits, amount
+}
+
+// PostSaleCredit credits the vendor for a confirmed transaction. Anything received above the
+// invoiced amount is credited as an overpayment. Posting twice for the same transaction is a no-op;
+// a transaction confirmed again after a reorg took its credit back is credited once more.
+func (s *LedgerService) PostSaleCredit(ctx context.Context, transaction *models.Transaction, received int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.repo.LockVendor(ctx, tx, transaction.VendorID); err != nil {
+			return err
+		}
+		entries, err := s.repo.ListTransactionEntries(ctx, tx, transaction.ID)
+		if err != nil {
+			return err
+		}
+		credited, reversed, amount := saleCreditState(entries)
+		if credited {
+			if !reversed {
+				return nil
+			}
+			_, err := s.repo.CreateEntry(ctx, tx, &models.LedgerEntry{
+				VendorID:      transaction.VendorID,
+				Type:          models.LedgerEntryReorgCredit,
+				Amount:        amount,
+				DebitAccount:  models.LedgerAccountWallet,
+				CreditAccount: models.LedgerAccountVendor,
+				TransactionID: &transaction.ID,
+			})
+			return err
+		}
+
+		created, err := s.repo.CreateEntry(ctx, tx, &models.LedgerEntry{
+			VendorID:      transaction.VendorID,
+			Type:          models.LedgerEntrySaleCredit,
+			Amount:        transaction.Amount,
+			DebitAccount:  models.LedgerAccountWallet,
+			CreditAccount: models.LedgerAccountVendor,
+			TransactionID: &transaction.ID,
+		})
+		if err != nil || !created {
+			return err
+		}
+
+		if received <= transaction.Amount {
+			return nil
+		}
+		_, err = s.repo.CreateEntry(ctx, tx, &models.LedgerEntry{
+			VendorID:      transaction.VendorID,
+			Type:          models.LedgerEntryOverpaymentCredit,
+			Amount:        received - transaction.Amount,
+			DebitAccount:  models.LedgerAccountWallet,
+			CreditAccount: models.LedgerAccountVendor,
+			TransactionID: &transaction.ID,
+		})
+		return err
+	})
+}
+
+// ReverseSaleCredit takes back the credit of a confirmed transaction that a reorg took out of the
+// chain. The vendor's balance can go negative if the credit was already paid out. It reports false
+// when there was no credit to take back.
+func (s *LedgerService) ReverseSaleCredit(ctx context.Context, transaction *models.Transaction) (bool, error) {
+	reversed := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.repo.LockVendor(ctx, tx, transaction.VendorID); err != nil {
+			return err
+		}
+		entries, err := s.repo.ListTransactionEntries(ctx, tx, transaction.ID)
+		if err != nil {
+			return err
+		}
+		credited, alreadyReversed, amount := saleCreditState(entries)
+		if !credited || alreadyReversed {
+			return nil
+		}
+		if _, err := s.repo.CreateEntry(ctx, tx, &models.LedgerEntry{
+			VendorID:      transaction.VendorID,
+			Type:          models.LedgerEntryReorgReversal,
+			Amount:        amount,
+			DebitAccount:  models.LedgerAccountVendor,
+			CreditAccount: models.LedgerAccountWallet,
+			TransactionID: &transaction.ID,
+		}); err != nil {
+			return err
+		}
+		reversed = true
+		return nil
+	})
+	return reversed, err
+}
+
+// PostPayoutDebit debits the vendor for a transfer. It must run in the transaction that created
+// the transfer, after BalanceForUpdate.
+func (s *LedgerService) PostPayoutDebit(ctx context.Context, tx *gorm.DB, transfer *models.Transfer) error {
+	_, err := s.repo.CreateEntry(ctx, tx, &models.LedgerEntry{
+		VendorID:      transfer.VendorID,
+		Type:          models.LedgerEntryPayoutDebit,
+		Amount:        transfer.Amount,
+		DebitAccount:  models.LedgerAccountVendor,
+		CreditAccount: models.LedgerAccountWallet,
+		TransferID:    &transfer.ID,
+	})
+	return err
+}
+
+// Adjust posts a manual correction; a positive amount credits the vendor, a negative one debits it
+func (s *LedgerService) Adjust(ctx context.Context, vendorID uint, amount int64, memo string) (*models.LedgerEntry, *models.HTTPError) {
+	memo = strings.TrimSpace(memo)
+	if amount == 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "amount must not be 0")
+	}
+	if memo == "" {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "memo is required for adjustments")
+	}
+
+	entry := &models.LedgerEntry{
+		VendorID:      vendorID,
+		Type:          models.LedgerEntryAdjustment,
+		Amount:        amount,
+		DebitAccount:  models.LedgerAccountOperator,
+		CreditAccount: models.LedgerAccountVendor,
+		Memo:          &memo,
+	}
+	if amount < 0 {
+		entry.Amount = -amount
+		entry.DebitAccount = models.LedgerAccountVendor
+		entry.CreditAccount = models.LedgerAccountOperator
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		balance, err := s.BalanceForUpdate(ctx, tx, vendorID)
+		if err != nil {
+			return err
+		}
+		if amount < 0 && balance < entry.Amount {
+			return ErrInsufficientBalance
+		}
+		_, err = s.repo.CreateEntry(ctx, tx, entry)
+		return err
+	})
+	if httpErr := toHTTPError(err, "error posting adjustment: "); httpErr != nil {
+		return nil, httpErr
+	}
+	return entry, nil
+}
+
+// Refund records a refund the operator paid back to the customer of one of the vendor's transactions
+func (s *LedgerService) Refund(ctx context.Context, vendorID uint, transactionID uint, amount int64, memo *string) (*models.LedgerEntry, *models.HTTPError) {
+	if amount <= 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "amount must be positive")
+	}
+
+	entry := &models.LedgerEntry{
+		VendorID:      vendorID,
+		Type:          models.LedgerEntryRefund,
+		Amount:        amount,
+		DebitAccount:  models.LedgerAccountVendor,
+		CreditAccount: models.LedgerAccountWallet,
+		TransactionID: &transactionID,
+		Memo:          memo,
+	}
+
+	var validationErr *models.HTTPError
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		balance, err := s.BalanceForUpdate(ctx, tx, vendorID)
+		if err != nil {
+			return err
+		}
+
+		transaction, err := s.repo.FindTransaction(ctx, tx, vendorID, transactionID)
+		if err != nil {
+			return err
+		}
+		if !transaction.Confirmed {
+			validationErr = models.NewHTTPError(http.StatusBadRequest, "only confirmed transactions can be refunded")
+			return nil
+		}
+
+		refunded, err := s.repo.GetRefundedAmount(ctx, tx, transactionID)
+		if err != nil {
+			return err
+		}
+		if refunded+amount > transaction.Amount {
+			validationErr = models.NewHTTPError(http.StatusBadRequest, "refunds cannot exceed the transaction amount")
+			return nil
+		}
+		if balance < amount {
+			return ErrInsufficientBalance
+		}
+
+		_, err = s.repo.CreateEntry(ctx, tx, entry)
+		return err
+	})
+	if validationErr != nil {
+		return nil, validationErr
+	}
+	if httpErr := toHTTPError(err, "error posting refund: "); httpErr != nil {
+		return nil, httpErr
+	}
+	return entry, nil
+}
+
+// GetStatement lists the entries between from and to with the running balance after each entry
+func (s *LedgerService) GetStatement(ctx context.Context, vendorID uint, from *time.Time, to *time.Time) (*Statement, *models.HTTPError) {
+	opening := int64(0)
+	if from != nil {
+		balance, err := s.repo.GetBalanceBefore(ctx, vendorID, *from)
+		if err != nil {
+			return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving opening balance: "+err.Error())
+		}
+		opening = balance
+	}
+
+	entries, err := s.repo.ListEntries(ctx, vendorID, from, to)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving ledger entries: "+err.Error())
+	}
+
+	statement := &Statement{
+		VendorID:       vendorID,
+		OpeningBalance: opening,
+		Entries:        make([]StatementLine, 0, len(entries)),
+	}
+	balance := opening
+	for _, entry := range entries {
+		amount := SignedAmount(entry)
+		balance += amount
+		statement.Entries = append(statement.Entries, StatementLine{
+			ID:            entry.ID,
+			CreatedAt:     entry.CreatedAt,
+			Type:          entry.Type,
+			Amount:        amount,
+			TransactionID: entry.TransactionID,
+			TransferID:    entry.TransferID,
+			Memo:          entry.Memo,
+			Balance:       balance,
+		})
+	}
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
+
+// SignedAmount returns the entry's effect on the vendor's balance
+func SignedAmount(entry *models.LedgerEntry) int64 {
+	switch {
+	case entry.CreditAccount == models.LedgerAccountVendor:
+		return entry.Amount
+	case entry.DebitAccount == models.LedgerAccountVendor:
+		return -entry.Amount
+	default:
+		return 0
+	}
+}
+
+func toHTTPError(err error, prefix string) *models.HTTPError {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return models.NewHTTPError(http.StatusNotFound, "vendor or transaction not found")
+	case errors.Is(err, ErrInsufficientBalance):
+		return models.NewHTTPError(http.StatusBadRequest, "vendor balance is too low")
+	default:
+		return models.NewHTTPError(http.StatusInternalServerError, prefix+err.Error())
+	}
+}
@@ -18,9 +18,15 @@ func NewMiscHandler(service *MiscService) *MiscHandler {
 	return &MiscHandler{service: service}
 }
 
+type PaymentBackendHealth struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+}
+
 type Services struct {
-	Postgresql bool                     `json:"postgresql"`
-	MoneroPay  moneropay.HealthResponse `json:"MoneroPay"`
+	Postgresql     bool                      `json:"postgresql"`
+	MoneroPay      *moneropay.HealthResponse `json:"MoneroPay,omitempty"` // Only reported when MoneroPay is configured
+	PaymentBackend PaymentBackendHealth      `json:"payment_backend"`
 }
 
 type HealthResponse struct {
@@ -5,16 +5,18 @@ import (
 
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/payment"
 )
 
 type MiscService struct {
 	repo      MiscRepository
 	config    *config.Config
-	moneroPay *moneropay.MoneroPayAPIClient
+	moneroPay *moneropay.MoneroPayAPIClient // nil when MoneroPay is not configured
+	payments  *payment.Backends
 }
 
-func NewMiscService(repo MiscRepository, cfg *config.Config, moneroPay *moneropay.MoneroPayAPIClient) *MiscService {
-	return &MiscService{repo: repo, config: cfg, moneroPay: moneroPay}
+func NewMiscService(repo MiscRepository, cfg *config.Config, moneroPay *moneropay.MoneroPayAPIClient, payments *payment.Backends) *MiscService {
+	return &MiscService{repo: repo, config: cfg, moneroPay: moneroPay, payments: payments}
 }
 
 // Check if the vendor and POS are authorized for the transaction
@@ -22,19 +24,26 @@ func (s *MiscService) GetHealth(ctx context.Context) HealthResponse {
 	h := HealthResponse{}
 
 	// Check MoneroPay service health
-	mp, mpErr := s.moneroPay.GetHealth(ctx)
-	if mpErr != nil {
-		h.Services.MoneroPay.Status = 503
-	} else {
-		h.Services.MoneroPay = *mp
+	if s.moneroPay != nil {
+		mp, mpErr := s.moneroPay.GetHealth(ctx)
+		if mpErr != nil {
+			h.Services.MoneroPay = &moneropay.HealthResponse{Status: 503}
+		} else {
+			h.Services.MoneroPay = mp
+		}
 	}
 
+	// Check the backend new invoices are created with
+	backend := s.payments.Default()
+	h.Services.PaymentBackend.Name = backend.Name()
+	h.Services.PaymentBackend.Healthy = backend.Health(ctx) == nil
+
 	// Check PostgreSQL service health
 	postgresqlStatus, pgErr := s.repo.GetPostgresqlHealth(ctx)
 	h.Services.Postgresql = postgresqlStatus && pgErr == nil
 
 	// Set overall status
-	if h.Services.Postgresql && h.Services.MoneroPay.Status == 200 {
+	if h.Services.Postgresql && h.Services.PaymentBackend.Healthy {
 		h.Status = 200
 	} else {
 		h.Status = 503
@@ -11,7 +11,6 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
-	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
 )
 
 type PosHandler struct {
@@ -63,16 +62,15 @@ func (h *PosHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-	if !ok || role != "pos" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
 	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
+	if vendorIDPtr == nil || posIDPtr == nil {
+		http.Error(w, "Vendor ID and POS ID are required", http.StatusBadRequest)
+		return
+	}
+	staffIDPtr, _ := r.Context().Value(models.ClaimsStaffIDKey).(*uint)
 
-	id, address, err := h.service.CreateTransaction(ctx, *vendorIDPtr, *posIDPtr, req.Amount, req.Description, req.AmountInCurrency, req.Currency, req.RequiredConfirmations)
+	id, address, err := h.service.CreateTransaction(ctx, *vendorIDPtr, posIDPtr, staffIDPtr, req.Amount, req.Description, req.AmountInCurrency, req.Currency, req.RequiredConfirmations)
 	if err != nil {
 		http.Error(w, "Failed to create transaction", http.StatusInternalServerError)
 		return
@@ -101,11 +99,6 @@ func (h *PosHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
 	}
 	transactionIDUint := uint(transactionID)
 
-	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-	if !ok || role != "pos" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
 	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
 	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
 	if vendorIDPtr == nil || posIDPtr == nil {
@@ -128,12 +121,6 @@ func (h *PosHandler) ListTransactions(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	r = r.WithContext(ctx)
 
-	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-	if !ok || role != "pos" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
 	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
 	if vendorIDPtr == nil || posIDPtr == nil {
@@ -161,12 +148,6 @@ func (h *PosHandler) ExportTransactions(w http.ResponseWriter, r *http.Request)
 	defer cancel()
 	r = r.WithContext(ctx)
 
-	role, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-	if !ok || role != "pos" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
 	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
 	if vendorIDPtr == nil || posIDPtr == nil {
@@ -190,3 +171,99 @@ func (h *PosHandler) ExportTransactions(w http.ResponseWriter, r *http.Request)
 	resp := exportTransactionsResponse{CSVData: csvData}
 	_ = json.NewEncoder(w).Encode(resp)
 }
+
+// vendorScope returns the vendor of a vendor login or API key. POS logins only see their own
+// transactions, through the /pos routes.
+func vendorScope(w http.ResponseWriter, r *http.Request) (vendorID uint, ok bool) {
+	vendorIDPtr, _ := r.Context().Value(models.ClaimsVendorIDKey).(*uint)
+	posIDPtr, _ := r.Context().Value(models.ClaimsPosIDKey).(*uint)
+	if vendorIDPtr == nil {
+		http.Error(w, "Vendor ID is required", http.StatusBadRequest)
+		return 0, false
+	}
+	if posIDPtr != nil {
+		http.Error(w, "POS logins list their transactions under /pos", http.StatusForbidden)
+		return 0, false
+	}
+	return *vendorIDPtr, true
+}
+
+// ListVendorTransactions lists the transactions of every POS of the vendor
+func (h *PosHandler) ListVendorTransactions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vendorID, ok := vendorScope(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.service.ListTransactionsByVendor(ctx, vendorID)
+	if err != nil {
+		http.Error(w, "Failed to list transactions", http.StatusInternalServerError)
+		return
+	}
+
+	resp := listTransactionsResponse{
+		ConfirmedTransactions: result.Confirmed,
+		PendingTransactions:   result.Pending,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *PosHandler) GetVendorTransaction(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	transactionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	vendorID, ok := vendorScope(w, r)
+	if !ok {
+		return
+	}
+
+	transaction, httpErr := h.service.GetVendorTransaction(ctx, uint(transactionID), vendorID)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(transaction)
+}
+
+// ExportVendorTransactions exports the confirmed transactions of every POS of the vendor
+func (h *PosHandler) ExportVendorTransactions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vendorID, ok := vendorScope(w, r)
+	if !ok {
+		return
+	}
+
+	csvData, err := h.service.ExportVendorTransactionsCSV(ctx, vendorID)
+	if err != nil {
+		if errors.Is(err, ErrNoConfirmedTransactions) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		http.Error(w, "Failed to export transactions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := exportTransactionsResponse{CSVData: csvData}
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -9,9 +9,11 @@ import (
 
 type PosRepository interface {
 	FindTransactionByID(ctx context.Context, id uint) (*models.Transaction, error)
+	FindVendorByID(ctx context.Context, id uint) (*models.Vendor, error)
 	CreateTransaction(ctx context.Context, transaction *models.Transaction) (*models.Transaction, error)
 	UpdateTransaction(ctx context.Context, transaction *models.Transaction) (*models.Transaction, error)
 	FindTransactionsByPosID(ctx context.Context, vendorID uint, posID uint) ([]*models.Transaction, error)
+	FindTransactionsByVendorID(ctx context.Context, vendorID uint) ([]*models.Transaction, error)
 }
 
 type posRepository struct {
@@ -33,6 +35,17 @@ func (r *posRepository) FindTransactionByID(ctx context.Context, id uint) (*mode
 	return &transaction, nil
 }
 
+func (r *posRepository) FindVendorByID(ctx context.Context, id uint) (*models.Vendor, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var vendor models.Vendor
+	if err := r.db.WithContext(ctx).First(&vendor, id).Error; err != nil {
+		return nil, err
+	}
+	return &vendor, nil
+}
+
 func (r *posRepository) CreateTransaction(ctx context.Context, transaction *models.Transaction) (*models.Transaction, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -69,3 +82,20 @@ func (r *posRepository) FindTransactionsByPosID(ctx context.Context, vendorID ui
 
 	return transactions, nil
 }
+
+func (r *posRepository) FindTransactionsByVendorID(ctx context.Context, vendorID uint) ([]*models.Transaction, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var transactions []*models.Transaction
+	if err := r.db.WithContext(ctx).
+		Preload("SubTransactions").
+		Where("vendor_id = ?", vendorID).
+		Order("created_at DESC").
+		Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
@@ -7,24 +7,25 @@ import (
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
 	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
-	"github.com/monerokon/xmrpos/xmrpos-backend/internal/thirdparty/moneropay"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/payment"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/features/risk"
 )
 
 type PosService struct {
-	repo      PosRepository
-	config    *config.Config
-	moneroPay *moneropay.MoneroPayAPIClient
+	repo     PosRepository
+	config   *config.Config
+	payments *payment.Backends
+	risk     *risk.RiskService
 }
 
 const moneroAtomicUnitsPerXMR int64 = 1_000_000_000_000
 
 var ErrNoConfirmedTransactions = errors.New("no confirmed transactions in DB")
 
-func NewPosService(repo PosRepository, cfg *config.Config, moneroPay *moneropay.MoneroPayAPIClient) *PosService {
-	return &PosService{repo: repo, config: cfg, moneroPay: moneroPay}
+func NewPosService(repo PosRepository, cfg *config.Config, payments *payment.Backends, riskService *risk.RiskService) *PosService {
+	return &PosService{repo: repo, config: cfg, payments: payments, risk: riskService}
 }
 
 type ConfirmedTransactionSummary struct {
@@ -37,10 +38,11 @@ type ConfirmedTransactionSummary struct {
 }
 
 type PendingTransactionSummary struct {
-	ID        uint  `json:"id"`
-	Amount    int64 `json:"amount"`
-	Accepted  bool  `json:"accepted"`
-	Confirmed bool  `json:"confirmed"`
+	ID        uint    `json:"id"`
+	Amount    int64   `json:"amount"`
+	Accepted  bool    `json:"accepted"`
+	Confirmed bool    `json:"confirmed"`
+	RiskFlags *string `json:"risk_flags,omitempty"`
 }
 
 type ListTransactionsResult struct {
@@ -48,16 +50,39 @@ type ListTransactionsResult struct {
 	Pending   []PendingTransactionSummary   `json:"pending_transactions"`
 }
 
-func (s *PosService) CreateTransaction(ctx context.Context, vendorID uint, posID uint, amount int64, description *string, amountInCurrency float64, currency string, requiredConfirmations int64) (id uint, address string, err error) {
+// CreateTransaction creates a transaction and the subaddress it is paid to. posID is nil for
+// online checkouts, which are not taken on a POS.
+func (s *PosService) CreateTransaction(ctx context.Context, vendorID uint, posID *uint, staffID *uint, amount int64, description *string, amountInCurrency float64, currency string, requiredConfirmations int64) (id uint, address string, err error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
+	vendor, err := s.repo.FindVendorByID(ctx, vendorID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// Invoices of vendors with their own wallet account are paid into that account
+	accountIndex := uint32(0)
+	if vendor.WalletAccountIndex != nil {
+		accountIndex = *vendor.WalletAccountIndex
+	}
+
+	// The POS may ask for more confirmations than the vendor's policy, never fewer. The
+	// confirmed depth is stored so the transaction keeps the rule it was created under.
+	policy, err := s.risk.Policy(ctx, vendorID)
+	if err != nil {
+		return 0, "", err
+	}
+	requiredConfirmations = policy.RequiredConfirmations(requiredConfirmations)
+
 	transaction := &models.Transaction{
 		VendorID:              vendorID,
 		PosID:                 posID,
+		StaffID:               staffID,
 		Amount:                amount,
 		RequiredConfirmations: requiredConfirmations,
+		ConfirmedDepth:        policy.ConfirmedDepth,
 		Currency:              currency,
 		AmountInCurrency:      amountInCurrency,
 		Description:           description,
@@ -68,51 +93,43 @@ func (s *PosService) CreateTransaction(ctx context.Context, vendorID uint, posID
 		return 0, "", err
 	}
 
-	// Create a jwt token for the transaction which contains the transaction ID
-	moneroPayTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"transaction_id": transactionDB.ID,
-		"exp":            time.Now().Add(time.Hour * 6).Unix(),
-	})
-
-	accessToken, err := moneroPayTokenJWT.SignedString([]byte(s.config.JWTMoneroPaySecret))
-	if err != nil {
-		return 0, "", err
-	}
-
-	callbackURLTemplate := s.config.MoneroPayCallbackURL
-	var callbackUrl string
-	if strings.Contains(callbackURLTemplate, "{jwt}") {
-		callbackUrl = strings.Replace(callbackURLTemplate, "{jwt}", accessToken, 1)
-	} else {
-		callbackUrl = strings.TrimRight(callbackURLTemplate, "/") + "/receive/" + accessToken
-	}
-
 	var desc string
 	if description != nil {
 		desc = *description
 	}
 
-	req := &moneropay.ReceiveRequest{
-		Amount:      amount,
-		Description: desc,
-		CallbackUrl: callbackUrl,
+	// Self-custody vendors are paid into their own wallet, which only the view-only backend can watch
+	backend := s.payments.Default()
+	if vendor.Custody == models.VendorCustodySelf {
+		viewOnly, ok := s.payments.Get(payment.BackendViewOnly)
+		if !ok {
+			return 0, "", errors.New("view-only wallets are not configured")
+		}
+		backend = viewOnly
 	}
 
-	// per-call timeout for external dependency
-	callCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	resp, err := s.moneroPay.PostReceive(callCtx, req)
+	invoice, err := backend.CreateInvoice(ctx, payment.InvoiceRequest{
+		TransactionID: transactionDB.ID,
+		VendorID:      vendorID,
+		AccountIndex:  accountIndex,
+		Amount:        amount,
+		Description:   desc,
+	})
 	if err != nil {
 		return 0, "", err
 	}
 
-	// Update the transaction with the subaddress received from MoneroPay
-	transactionDB.SubAddress = &resp.Address
+	// Update the transaction with the subaddress received from the payment backend
+	transactionDB.SubAddress = &invoice.Address
+	transactionDB.PaymentBackend = backend.Name()
+	transactionDB.AccountIndex = invoice.AccountIndex
+	transactionDB.SubaddressIndex = invoice.SubaddressIndex
+	transactionDB.CallbackSecretHash = invoice.CallbackSecretHash
 	if _, err := s.repo.UpdateTransaction(ctx, transactionDB); err != nil {
 		return 0, "", err
 	}
 
-	return transactionDB.ID, resp.Address, nil
+	return transactionDB.ID, invoice.Address, nil
 }
 
 // GetTransaction retrieves a transaction by its ID if authorized
@@ -136,7 +153,7 @@ func (s *PosService) GetTransaction(ctx context.Context, transactionID uint, ven
 
 // Check if the vendor and POS are authorized for the transaction
 func (s *PosService) IsAuthorizedForTransaction(vendorID uint, posID uint, transaction *models.Transaction) bool {
-	if transaction.VendorID != vendorID || transaction.PosID != posID {
+	if transaction.VendorID != vendorID || transaction.PosID == nil || *transaction.PosID != posID {
 		return false
 	}
 	return true
@@ -152,6 +169,36 @@ func (s *PosService) ListTransactionsByPos(ctx context.Context, vendorID uint, p
 		return nil, err
 	}
 
+	return summarizeTransactions(transactions), nil
+}
+
+// ListTransactionsByVendor lists the transactions of every POS of the vendor
+func (s *PosService) ListTransactionsByVendor(ctx context.Context, vendorID uint) (*ListTransactionsResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	transactions, err := s.repo.FindTransactionsByVendorID(ctx, vendorID)
+	if err != nil {
+		return nil, err
+	}
+
+	return summarizeTransactions(transactions), nil
+}
+
+// GetVendorTransaction returns a transaction of any POS of the vendor
+func (s *PosService) GetVendorTransaction(ctx context.Context, transactionID uint, vendorID uint) (*models.Transaction, *models.HTTPError) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	transaction, err := s.repo.FindTransactionByID(ctx, transactionID)
+	if err != nil || transaction.VendorID != vendorID {
+		return nil, models.NewHTTPError(404, "Transaction not found")
+	}
+	return transaction, nil
+}
+
+func summarizeTransactions(transactions []*models.Transaction) *ListTransactionsResult {
 	result := &ListTransactionsResult{
 		Confirmed: make([]ConfirmedTransactionSummary, 0),
 		Pending:   make([]PendingTransactionSummary, 0),
@@ -177,10 +224,11 @@ func (s *PosService) ListTransactionsByPos(ctx context.Context, vendorID uint, p
 			Amount:    transaction.Amount,
 			Accepted:  transaction.Accepted,
 			Confirmed: transaction.Confirmed,
+			RiskFlags: transaction.RiskFlags,
 		})
 	}
 
-	return result, nil
+	return result
 }
 
 func (s *PosService) ExportConfirmedTransactionsCSV(ctx context.Context, vendorID uint, posID uint) (string, error) {
@@ -193,8 +241,26 @@ func (s *PosService) ExportConfirmedTransactionsCSV(ctx context.Context, vendorI
 		return "", err
 	}
 
+	return exportTransactionsCSV(transactions)
+}
+
+// ExportVendorTransactionsCSV exports the confirmed transactions of every POS of the vendor
+func (s *PosService) ExportVendorTransactionsCSV(ctx context.Context, vendorID uint) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	transactions, err := s.repo.FindTransactionsByVendorID(ctx, vendorID)
+	if err != nil {
+		return "", err
+	}
+
+	return exportTransactionsCSV(transactions)
+}
+
+func exportTransactionsCSV(transactions []*models.Transaction) (string, error) {
 	var builder strings.Builder
-	builder.WriteString("Koinly Date,Amount,Currency,Label,TxHash")
+	builder.WriteString("Koinly Date,Amount,Currency,Fee Amount,Fee Currency,Label,TxHash")
 
 	rows := 0
 	for _, transaction := range transactions {
@@ -202,9 +268,16 @@ func (s *PosService) ExportConfirmedTransactionsCSV(ctx context.Context, vendorI
 			continue
 		}
 
+		// Amount is the gross payment; the commission is reported once, on the first payment
+		// of the transaction, so Koinly derives the net amount
+		commission := int64(0)
+		if transaction.Commission != nil {
+			commission = *transaction.Commission
+		}
 		for _, sub := range transaction.SubTransactions {
 			builder.WriteByte('\n')
-			builder.WriteString(formatExportRow(sub))
+			builder.WriteString(formatExportRow(sub, commission))
+			commission = 0
 			rows++
 		}
 	}
@@ -216,12 +289,17 @@ func (s *PosService) ExportConfirmedTransactionsCSV(ctx context.Context, vendorI
 	return builder.String(), nil
 }
 
-func formatExportRow(sub *models.SubTransaction) string {
+func formatExportRow(sub *models.SubTransaction, commission int64) string {
 	date := sub.Timestamp.UTC()
 	dateStr := fmt.Sprintf("%04d-%02d-%02d 00:00 UTC", date.Year(), date.Month(), date.Day())
 	amount := formatAtomicAmountTwoDecimals(sub.Amount)
 
-	return fmt.Sprintf("%s,%s,XMR,income,%s", dateStr, amount, sub.TxHash)
+	fee, feeCurrency := "", ""
+	if commission > 0 {
+		fee, feeCurrency = formatAtomicAmountTwoDecimals(commission), "XMR"
+	}
+
+	return fmt.Sprintf("%s,%s,XMR,%s,%s,income,%s", dateStr, amount, fee, feeCurrency, sub.TxHash)
 }
 
 func formatAtomicAmountTwoDecimals(amount int64) string {
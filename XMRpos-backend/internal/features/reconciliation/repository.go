@@ -0,0 +1,230 @@
+package reconciliation
+
+import (
+	"context"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/payment"
+	"gorm.io/gorm"
+)
+
+type vendorAmount struct {
+	VendorID uint
+	Amount   int64
+}
+
+type vendorReference struct {
+	VendorID uint
+	ID       uint
+	TxHash   string
+}
+
+type ReconciliationRepository interface {
+	ListVendorIDs(ctx context.Context) ([]uint, error)
+	GetVendorBalances(ctx context.Context) ([]vendorAmount, error)
+	GetUntransferredSales(ctx context.Context) ([]vendorAmount, error)
+	GetPendingTransfers(ctx context.Context) ([]vendorAmount, error)
+	GetUnconfirmedReceived(ctx context.Context) ([]vendorAmount, error)
+	GetRetainedCommission(ctx context.Context) (int64, error)
+	GetTransactionsMissingCredit(ctx context.Context) ([]vendorReference, error)
+	GetConfirmedPayments(ctx context.Context) ([]vendorReference, error)
+	GetCompletedTransfers(ctx context.Context) ([]vendorReference, error)
+	CreateReport(ctx context.Context, report *models.ReconciliationReport) error
+	GetLatestReport(ctx context.Context) (*models.ReconciliationReport, error)
+	ListReports(ctx context.Context, limit int) ([]*models.ReconciliationReport, error)
+	GetReport(ctx context.Context, id uint) (*models.ReconciliationReport, error)
+	GetLine(ctx context.Context, reportID uint, vendorID uint) (*models.ReconciliationLine, error)
+}
+
+type reconciliationRepository struct {
+	db *gorm.DB
+}
+
+func NewReconciliationRepository(db *gorm.DB) ReconciliationRepository {
+	return &reconciliationRepository{db: db}
+}
+
+func (r *reconciliationRepository) ListVendorIDs(ctx context.Context) ([]uint, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var ids []uint
+	if err := r.db.WithContext(ctx).Model(&models.Vendor{}).Order("id ASC").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *reconciliationRepository) GetVendorBalances(ctx context.Context) ([]vendorAmount, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var results []vendorAmount
+	err := r.db.WithContext(ctx).Model(&models.LedgerEntry{}).
+		Select("vendor_id, COALESCE(SUM(CASE WHEN credit_account = ? THEN amount WHEN debit_account = ? THEN -amount ELSE 0 END), 0) AS amount", models.LedgerAccountVendor, models.LedgerAccountVendor).
+		Group("vendor_id").
+		Scan(&results).Error
+	return results, err
+}
+
+func (r *reconciliationRepository) GetUntransferredSales(ctx context.Context) ([]vendorAmount, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var results []vendorAmount
+	err := r.db.WithContext(ctx).Model(&models.Transaction{}).
+		Select("vendor_id, COALESCE(SUM(amount), 0) AS amount").
+		Where("confirmed = ? AND transfer_id IS NULL AND payment_backend <> ?", true, payment.BackendViewOnly).
+		Group("vendor_id").
+		Scan(&results).Error
+	return results, err
+}
+
+// GetPendingTransfers sums transfers not yet signed, whose funds (payout and commission) are still in the wallet
+func (r *reconciliationRepository) GetPendingTransfers(ctx context.Context) ([]vendorAmount, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var results []vendorAmount
+	err := r.db.WithContext(ctx).Model(&models.Transfer{}).
+		Select("vendor_id, COALESCE(SUM(amount + commission), 0) AS amount").
+		Where("status = ?", models.TransferStatusPending).
+		Group("vendor_id").
+		Scan(&results).Error
+	return results, err
+}
+
+// GetUnconfirmedReceived sums mined payments of transactions that are not confirmed yet;
+// payments still in the pool are not part of the wallet balance
+func (r *reconciliationRepository) GetUnconfirmedReceived(ctx context.Context) ([]vendorAmount, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var results []vendorAmount
+	err := r.db.WithContext(ctx).Model(&models.SubTransaction{}).
+		Select("transactions.vendor_id AS vendor_id, COALESCE(SUM(sub_transactions.amount), 0) AS amount").
+		Joins("JOIN transactions ON transactions.id = sub_transactions.transaction_id AND transactions.deleted_at IS NULL").
+		Where("transactions.confirmed = ? AND sub_transactions.height > 0 AND transactions.payment_backend <> ?", false, payment.BackendViewOnly).
+		Group("transactions.vendor_id").
+		Scan(&results).Error
+	return results, err
+}
+
+// GetRetainedCommission is the commission charged to vendors minus what was sent to the operator address
+func (r *reconciliationRepository) GetRetainedCommission(ctx context.Context) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var charged int64
+	if err := r.db.WithContext(ctx).Model(&models.LedgerEntry{}).
+		Where("credit_account = ?", models.LedgerAccountFees).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&charged).Error; err != nil {
+		return 0, err
+	}
+	var forwarded int64
+	if err := r.db.WithContext(ctx).Model(&models.Transfer{}).
+		Select("COALESCE(SUM(commission), 0)").
+		Scan(&forwarded).Error; err != nil {
+		return 0, err
+	}
+	return charged - forwarded, nil
+}
+
+func (r *reconciliationRepository) GetTransactionsMissingCredit(ctx context.Context) ([]vendorReference, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var results []vendorReference
+	err := r.db.WithContext(ctx).Model(&models.Transaction{}).
+		Select("transactions.vendor_id AS vendor_id, transactions.id AS id").
+		Joins("LEFT JOIN ledger_entries ON ledger_entries.transaction_id = transactions.id AND ledger_entries.type = ?", models.LedgerEntrySaleCredit).
+		Where("transactions.confirmed = ? AND ledger_entries.id IS NULL AND transactions.payment_backend <> ?", true, payment.BackendViewOnly).
+		Scan(&results).Error
+	return results, err
+}
+
+// GetConfirmedPayments lists the payments expected in the wallet's incoming transfers; payments
+// into the wallets of self-custody vendors are not
+func (r *reconciliationRepository) GetConfirmedPayments(ctx context.Context) ([]vendorReference, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var results []vendorReference
+	err := r.db.WithContext(ctx).Model(&models.SubTransaction{}).
+		Select("transactions.vendor_id AS vendor_id, transactions.id AS id, sub_transactions.tx_hash AS tx_hash").
+		Joins("JOIN transactions ON transactions.id = sub_transactions.transaction_id AND transactions.deleted_at IS NULL").
+		Where("transactions.confirmed = ? AND transactions.payment_backend <> ?", true, payment.BackendViewOnly).
+		Scan(&results).Error
+	return results, err
+}
+
+func (r *reconciliationRepository) GetCompletedTransfers(ctx context.Context) ([]vendorReference, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var results []vendorReference
+	err := r.db.WithContext(ctx).Model(&models.Transfer{}).
+		Select("vendor_id, id, tx_hash").
+		Where("status = ? AND tx_hash IS NOT NULL", models.TransferStatusCompleted).
+		Scan(&results).Error
+	return results, err
+}
+
+func (r *reconciliationRepository) CreateReport(ctx context.Context, report *models.ReconciliationReport) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Create(report).Error
+}
+
+func (r *reconciliationRepository) GetLatestReport(ctx context.Context) (*models.ReconciliationReport, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var report models.ReconciliationReport
+	if err := r.db.WithContext(ctx).Order("id DESC").First(&report).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *reconciliationRepository) ListReports(ctx context.Context, limit int) ([]*models.ReconciliationReport, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var reports []*models.ReconciliationReport
+	if err := r.db.WithContext(ctx).Order("id DESC").Limit(limit).Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (r *reconciliationRepository) GetReport(ctx context.Context, id uint) (*models.ReconciliationReport, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var report models.ReconciliationReport
+	if err := r.db.WithContext(ctx).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("vendor_id ASC") }).
+		First(&report, id).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *reconciliationRepository) GetLine(ctx context.Context, reportID uint, vendorID uint) (*models.ReconciliationLine, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var line models.ReconciliationLine
+	if err := r.db.WithContext(ctx).
+		Where("report_id = ? AND vendor_id = ?", reportID, vendorID).
+		First(&line).Error; err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
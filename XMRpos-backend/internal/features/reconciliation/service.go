@@ -0,0 +1,293 @@
+package reconciliation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/notify"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/rpc"
+	"gorm.io/gorm"
+)
+
+type ReconciliationService struct {
+	repo      ReconciliationRepository
+	config    *config.Config
+	rpcClient *rpc.Client
+	notifier  *notify.Notifier
+	mu        sync.Mutex
+}
+
+// LineDetails lists what is behind the counts of a reconciliation line
+type LineDetails struct {
+	MissingCredits  []uint   `json:"missing_credits,omitempty"`  // Transaction IDs
+	MissingIncoming []string `json:"missing_incoming,omitempty"` // Payment tx hashes
+	MissingOutgoing []string `json:"missing_outgoing,omitempty"` // Transfer tx hashes
+}
+
+type walletTransfer struct {
+	TxID string `json:"txid"`
+}
+
+func NewReconciliationService(repo ReconciliationRepository, cfg *config.Config, rpcClient *rpc.Client, notifier *notify.Notifier) *ReconciliationService {
+	return &ReconciliationService{repo: repo, config: cfg, rpcClient: rpcClient, notifier: notifier}
+}
+
+func (s *ReconciliationService) StartReconciler(ctx context.Context, interval time.Duration) {
+	go func() {
+		runSweep := func(parent context.Context) {
+			sweepCtx, cancel := context.WithTimeout(parent, 2*time.Minute)
+			if _, err := s.Run(sweepCtx); err != nil {
+				log.Printf("Reconciliation failed: %v", err)
+			}
+			cancel()
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				runSweep(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Run compares the wallet with the database, stores the report and alerts the admin when
+// the wallet holds less than the database expects or a vendor's records do not add up
+func (s *ReconciliationService) Run(ctx context.Context) (*models.ReconciliationReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.repo.GetLatestReport(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report, runErr := s.buildReport(ctx)
+	if runErr != nil {
+		message := runErr.Error()
+		report = &models.ReconciliationReport{Error: &message}
+	}
+
+	if err := s.repo.CreateReport(ctx, report); err != nil {
+		return nil, fmt.Errorf("storing reconciliation report: %w", err)
+	}
+
+	if runErr != nil {
+		s.notifier.NotifyAdmin(ctx, "Reconciliation failed", runErr.Error())
+		return report, runErr
+	}
+
+	// Alert once per change instead of on every run of a known problem
+	if !report.Healthy && (previous == nil || previous.Healthy || previous.Discrepancy != report.Discrepancy) {
+		unhealthy := 0
+		for _, line := range report.Lines {
+			if !line.Healthy {
+				unhealthy++
+			}
+		}
+		s.notifier.NotifyAdmin(ctx, "Wallet and database do not reconcile", fmt.Sprintf(
+			"Report %d: wallet holds %d, database expects %d (discrepancy %d); %d vendor(s) need attention",
+			report.ID, report.WalletBalance, report.Expected, report.Discrepancy, unhealthy))
+	}
+
+	return report, nil
+}
+
+func (s *ReconciliationService) buildReport(ctx context.Context) (*models.ReconciliationReport, error) {
+	if s.rpcClient == nil {
+		return nil, fmt.Errorf("wallet RPC client not configured")
+	}
+
+	var balance struct {
+		Balance         int64 `json:"balance"`
+		UnlockedBalance int64 `json:"unlocked_balance"`
+	}
+	if err := s.rpcClient.Call(ctx, "get_balance", map[string]any{"account_index": 0, "all_accounts": true}, &balance); err != nil {
+		return nil, fmt.Errorf("fetching wallet balance: %w", err)
+	}
+
+	var history struct {
+		In      []walletTransfer `json:"in"`
+		Out     []walletTransfer `json:"out"`
+		Pending []walletTransfer `json:"pending"`
+	}
+	params := map[string]any{"in": true, "out": true, "pending": true, "all_accounts": true}
+	if err := s.rpcClient.Call(ctx, "get_transfers", params, &history); err != nil {
+		return nil, fmt.Errorf("fetching wallet transfers: %w", err)
+	}
+	incoming := make(map[string]bool, len(history.In))
+	for _, transfer := range history.In {
+		incoming[transfer.TxID] = true
+	}
+	outgoing := make(map[string]bool, len(history.Out)+len(history.Pending))
+	for _, transfer := range append(history.Out, history.Pending...) {
+		outgoing[transfer.TxID] = true
+	}
+
+	lines := make(map[uint]*models.ReconciliationLine)
+	details := make(map[uint]*LineDetails)
+	lineFor := func(vendorID uint) *models.ReconciliationLine {
+		if _, ok := lines[vendorID]; !ok {
+			lines[vendorID] = &models.ReconciliationLine{VendorID: vendorID}
+			details[vendorID] = &LineDetails{}
+		}
+		return lines[vendorID]
+	}
+
+	vendorIDs, err := s.repo.ListVendorIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, vendorID := range vendorIDs {
+		lineFor(vendorID)
+	}
+
+	report := &models.ReconciliationReport{
+		WalletBalance:  balance.Balance,
+		WalletUnlocked: balance.UnlockedBalance,
+	}
+
+	vendorBalances, err := s.repo.GetVendorBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, amount := range vendorBalances {
+		lineFor(amount.VendorID).LedgerBalance = amount.Amount
+		report.VendorBalances += amount.Amount
+	}
+
+	untransferred, err := s.repo.GetUntransferredSales(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, amount := range untransferred {
+		lineFor(amount.VendorID).UntransferredSales = amount.Amount
+	}
+
+	pending, err := s.repo.GetPendingTransfers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, amount := range pending {
+		lineFor(amount.VendorID).PendingTransfers = amount.Amount
+		report.PendingTransfers += amount.Amount
+	}
+
+	unconfirmed, err := s.repo.GetUnconfirmedReceived(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, amount := range unconfirmed {
+		report.UnconfirmedReceived += amount.Amount
+	}
+
+	if report.RetainedCommission, err = s.repo.GetRetainedCommission(ctx); err != nil {
+		return nil, err
+	}
+
+	missingCredits, err := s.repo.GetTransactionsMissingCredit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, reference := range missingCredits {
+		lineFor(reference.VendorID).MissingCredits++
+		details[reference.VendorID].MissingCredits = append(details[reference.VendorID].MissingCredits, reference.ID)
+	}
+
+	payments, err := s.repo.GetConfirmedPayments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, reference := range payments {
+		if !incoming[reference.TxHash] {
+			lineFor(reference.VendorID).MissingIncoming++
+			details[reference.VendorID].MissingIncoming = append(details[reference.VendorID].MissingIncoming, reference.TxHash)
+		}
+	}
+
+	transfers, err := s.repo.GetCompletedTransfers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, reference := range transfers {
+		if !outgoing[reference.TxHash] {
+			lineFor(reference.VendorID).MissingOutgoing++
+			details[reference.VendorID].MissingOutgoing = append(details[reference.VendorID].MissingOutgoing, reference.TxHash)
+		}
+	}
+
+	report.Expected = report.VendorBalances + report.PendingTransfers + report.UnconfirmedReceived + report.RetainedCommission
+	report.Discrepancy = report.WalletBalance - report.Expected
+	// A surplus (donations, dust) is reported but only a shortfall makes the report unhealthy
+	report.Healthy = report.Discrepancy >= -s.config.ReconciliationTolerance
+
+	report.Lines = make([]*models.ReconciliationLine, 0, len(lines))
+	for vendorID, line := range lines {
+		line.Healthy = line.MissingCredits == 0 && line.MissingIncoming == 0 && line.MissingOutgoing == 0 && line.LedgerBalance >= 0
+		if !line.Healthy {
+			report.Healthy = false
+			encoded, err := json.Marshal(details[vendorID])
+			if err != nil {
+				return nil, err
+			}
+			detailsJSON := string(encoded)
+			line.Details = &detailsJSON
+		}
+		report.Lines = append(report.Lines, line)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool { return report.Lines[i].VendorID < report.Lines[j].VendorID })
+
+	return report, nil
+}
+
+func (s *ReconciliationService) ListReports(ctx context.Context, limit int) ([]*models.ReconciliationReport, *models.HTTPError) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	reports, err := s.repo.ListReports(ctx, limit)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving reconciliation reports: "+err.Error())
+	}
+	return reports, nil
+}
+
+func (s *ReconciliationService) GetReport(ctx context.Context, id uint) (*models.ReconciliationReport, *models.HTTPError) {
+	report, err := s.repo.GetReport(ctx, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, models.NewHTTPError(http.StatusNotFound, "reconciliation report not found")
+		}
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving reconciliation report: "+err.Error())
+	}
+	return report, nil
+}
+
+func (s *ReconciliationService) GetVendorLine(ctx context.Context, reportID uint, vendorID uint) (*models.ReconciliationLine, *LineDetails, *models.HTTPError) {
+	line, err := s.repo.GetLine(ctx, reportID, vendorID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, models.NewHTTPError(http.StatusNotFound, "vendor not found in reconciliation report")
+		}
+		return nil, nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving reconciliation line: "+err.Error())
+	}
+
+	details := &LineDetails{}
+	if line.Details != nil {
+		if err := json.Unmarshal([]byte(*line.Details), details); err != nil {
+			return nil, nil, models.NewHTTPError(http.StatusInternalServerError, "error decoding reconciliation details: "+err.Error())
+		}
+	}
+	return line, details, nil
+}
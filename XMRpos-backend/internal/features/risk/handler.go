@@ -0,0 +1,98 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/utils"
+)
+
+type RiskHandler struct {
+	service *RiskService
+}
+
+func NewRiskHandler(service *RiskService) *RiskHandler {
+	return &RiskHandler{service: service}
+}
+
+type riskPolicyRequest struct {
+	MinConfirmations  int64  `json:"min_confirmations"`
+	MaxZeroConfAmount *int64 `json:"max_zero_conf_amount"`
+	MinFee            int64  `json:"min_fee"`
+	RejectDoubleSpend bool   `json:"reject_double_spend"`
+	RejectUnlockTime  bool   `json:"reject_unlock_time"`
+	ConfirmedDepth    int64  `json:"confirmed_depth"` // 0 keeps the configured depth
+	Reset             bool   `json:"reset"`           // Remove the vendor's policy and fall back to the default
+}
+
+func (h *RiskHandler) GetRiskPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	vendorID, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsVendorIDKey)
+	if !ok {
+		http.Error(w, "Unauthorized: vendorID not found", http.StatusUnauthorized)
+		return
+	}
+
+	policy, httpErr := h.service.GetRiskPolicy(ctx, *(vendorID.(*uint)))
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(policy)
+}
+
+func (h *RiskHandler) SetRiskPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	r = r.WithContext(ctx)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req riskPolicyRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vendorIDClaim, ok := utils.GetClaimFromContext(r.Context(), models.ClaimsVendorIDKey)
+	if !ok {
+		http.Error(w, "Unauthorized: vendorID not found", http.StatusUnauthorized)
+		return
+	}
+	vendorID := *(vendorIDClaim.(*uint))
+
+	var policy *RiskPolicy
+	var httpErr *models.HTTPError
+	if req.Reset {
+		if httpErr = h.service.ResetRiskPolicy(ctx, vendorID); httpErr == nil {
+			policy, httpErr = h.service.GetRiskPolicy(ctx, vendorID)
+		}
+	} else {
+		policy, httpErr = h.service.SetRiskPolicy(ctx, vendorID, RiskPolicy{
+			MinConfirmations:  req.MinConfirmations,
+			MaxZeroConfAmount: req.MaxZeroConfAmount,
+			MinFee:            req.MinFee,
+			RejectDoubleSpend: req.RejectDoubleSpend,
+			RejectUnlockTime:  req.RejectUnlockTime,
+			ConfirmedDepth:    req.ConfirmedDepth,
+		})
+	}
+	if httpErr != nil {
+		http.Error(w, httpErr.Message, httpErr.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(policy)
+	io.Copy(io.Discard, r.Body)
+}
@@ -0,0 +1,58 @@
+package risk
+
+import (
+	"context"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RiskRepository interface {
+	GetPolicy(ctx context.Context, vendorID uint) (*models.VendorRiskPolicy, error)
+	SavePolicy(ctx context.Context, policy *models.VendorRiskPolicy) error
+	DeletePolicy(ctx context.Context, vendorID uint) error
+}
+
+type riskRepository struct {
+	db *gorm.DB
+}
+
+func NewRiskRepository(db *gorm.DB) RiskRepository {
+	return &riskRepository{db: db}
+}
+
+func (r *riskRepository) GetPolicy(ctx context.Context, vendorID uint) (*models.VendorRiskPolicy, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var policy models.VendorRiskPolicy
+	err := r.db.WithContext(ctx).Where("vendor_id = ?", vendorID).First(&policy).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil // Vendor uses the default policy
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *riskRepository) SavePolicy(ctx context.Context, policy *models.VendorRiskPolicy) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "vendor_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"min_confirmations", "max_zero_conf_amount", "min_fee", "reject_double_spend", "reject_unlock_time", "confirmed_depth", "updated_at",
+		}),
+	}).Create(policy).Error
+}
+
+func (r *riskRepository) DeletePolicy(ctx context.Context, vendorID uint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Hard delete so the vendor can get a new policy without clashing with the unique index
+	return r.db.WithContext(ctx).Unscoped().Where("vendor_id = ?", vendorID).Delete(&models.VendorRiskPolicy{}).Error
+}
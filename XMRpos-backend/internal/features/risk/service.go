@@ -0,0 +1,202 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/config"
+	"github.com/monerokon/xmrpos/xmrpos-backend/internal/core/models"
+	"github.com/monerokon/xmrpos/xmrpos-backend/pkg/monero"
+)
+
+type RiskService struct {
+	repo   RiskRepository
+	config *config.Config
+}
+
+type RiskPolicy struct {
+	VendorID          uint   `json:"vendor_id"`
+	MinConfirmations  int64  `json:"min_confirmations"`
+	MaxZeroConfAmount *int64 `json:"max_zero_conf_amount"` // null for no limit
+	MinFee            int64  `json:"min_fee"`
+	RejectDoubleSpend bool   `json:"reject_double_spend"`
+	RejectUnlockTime  bool   `json:"reject_unlock_time"`
+	ConfirmedDepth    int64  `json:"confirmed_depth"`
+	Default           bool   `json:"default"` // True when the vendor has no policy of its own
+}
+
+// Assessment of a transaction's payments against a policy
+type Assessment struct {
+	Acceptable bool     // False when a payment must not be accepted yet, whatever its confirmations
+	Flags      []string // RiskFlag* reasons found on the payments
+}
+
+func NewRiskService(repo RiskRepository, cfg *config.Config) *RiskService {
+	return &RiskService{repo: repo, config: cfg}
+}
+
+// Policy returns the policy in effect for the vendor
+func (s *RiskService) Policy(ctx context.Context, vendorID uint) (*RiskPolicy, error) {
+	policy, err := s.repo.GetPolicy(ctx, vendorID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return &RiskPolicy{
+			VendorID:          vendorID,
+			MinConfirmations:  s.config.RiskMinConfirmations,
+			MaxZeroConfAmount: s.config.RiskMaxZeroConfAmount,
+			MinFee:            s.config.RiskMinFee,
+			RejectDoubleSpend: true,
+			RejectUnlockTime:  true,
+			ConfirmedDepth:    s.config.ConfirmedDepth,
+			Default:           true,
+		}, nil
+	}
+	confirmedDepth := s.config.ConfirmedDepth
+	if policy.ConfirmedDepth != nil {
+		confirmedDepth = *policy.ConfirmedDepth
+	}
+	return &RiskPolicy{
+		VendorID:          vendorID,
+		MinConfirmations:  policy.MinConfirmations,
+		MaxZeroConfAmount: policy.MaxZeroConfAmount,
+		MinFee:            policy.MinFee,
+		RejectDoubleSpend: policy.RejectDoubleSpend,
+		RejectUnlockTime:  policy.RejectUnlockTime,
+		ConfirmedDepth:    confirmedDepth,
+	}, nil
+}
+
+// RequiredConfirmations raises the confirmations a POS asked for to the policy's floor
+func (p *RiskPolicy) RequiredConfirmations(requested int64) int64 {
+	if requested < p.MinConfirmations {
+		return p.MinConfirmations
+	}
+	return requested
+}
+
+func (s *RiskService) GetRiskPolicy(ctx context.Context, vendorID uint) (*RiskPolicy, *models.HTTPError) {
+	policy, err := s.Policy(ctx, vendorID)
+	if err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error retrieving risk policy: "+err.Error())
+	}
+	return policy, nil
+}
+
+// SetRiskPolicy applies to payments checked from now on; the confirmation floor and the
+// confirmed depth only to new transactions. A confirmed depth of 0 keeps the configured one.
+func (s *RiskService) SetRiskPolicy(ctx context.Context, vendorID uint, policy RiskPolicy) (*RiskPolicy, *models.HTTPError) {
+	if policy.MinConfirmations < 0 || policy.MinConfirmations > 10 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "min_confirmations must be between 0 and 10")
+	}
+	if policy.MaxZeroConfAmount != nil && *policy.MaxZeroConfAmount < 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "max_zero_conf_amount must not be negative")
+	}
+	if policy.MinFee < 0 {
+		return nil, models.NewHTTPError(http.StatusBadRequest, "min_fee must not be negative")
+	}
+	// Outputs cannot be spent before they are SpendableAge blocks deep, so neither can they be paid out
+	if policy.ConfirmedDepth != 0 && policy.ConfirmedDepth < monero.SpendableAge {
+		return nil, models.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("confirmed_depth must be at least %d", monero.SpendableAge))
+	}
+
+	record := &models.VendorRiskPolicy{
+		VendorID:          vendorID,
+		MinConfirmations:  policy.MinConfirmations,
+		MaxZeroConfAmount: policy.MaxZeroConfAmount,
+		MinFee:            policy.MinFee,
+		RejectDoubleSpend: policy.RejectDoubleSpend,
+		RejectUnlockTime:  policy.RejectUnlockTime,
+	}
+	if policy.ConfirmedDepth != 0 {
+		record.ConfirmedDepth = &policy.ConfirmedDepth
+	} else {
+		policy.ConfirmedDepth = s.config.ConfirmedDepth
+	}
+	if err := s.repo.SavePolicy(ctx, record); err != nil {
+		return nil, models.NewHTTPError(http.StatusInternalServerError, "error saving risk policy: "+err.Error())
+	}
+
+	policy.VendorID = vendorID
+	policy.Default = false
+	return &policy, nil
+}
+
+// ResetRiskPolicy removes the vendor's policy so the configured default applies again
+func (s *RiskService) ResetRiskPolicy(ctx context.Context, vendorID uint) *models.HTTPError {
+	if err := s.repo.DeletePolicy(ctx, vendorID); err != nil {
+		return models.NewHTTPError(http.StatusInternalServerError, "error removing risk policy: "+err.Error())
+	}
+	return nil
+}
+
+// Assess checks the payments of a transaction. Confirmations are checked by the caller; this
+// only decides whether payments that reached them may be accepted.
+func (p *RiskPolicy) Assess(transaction *models.Transaction) Assessment {
+	assessment := Assessment{Acceptable: true}
+	flags := make(map[string]bool)
+
+	for _, subTx := range transaction.SubTransactions {
+		unconfirmed := subTx.Confirmations == 0
+
+		if subTx.DoubleSpendSeen {
+			flags[models.RiskFlagDoubleSpend] = true
+			if p.RejectDoubleSpend && unconfirmed {
+				assessment.Acceptable = false
+			}
+		}
+
+		if subTx.UnlockTime != 0 {
+			flags[models.RiskFlagUnlockTime] = true
+			if p.RejectUnlockTime && subTx.Locked {
+				assessment.Acceptable = false
+			}
+		}
+
+		// A low fee can leave the payment in the pool long enough to be replaced
+		if unconfirmed && subTx.Fee < p.MinFee {
+			flags[models.RiskFlagLowFee] = true
+			assessment.Acceptable = false
+		}
+
+		if unconfirmed && p.MaxZeroConfAmount != nil && transaction.Amount > *p.MaxZeroConfAmount {
+			flags[models.RiskFlagZeroConfLimit] = true
+			assessment.Acceptable = false
+		}
+	}
+
+	for flag := range flags {
+		assessment.Flags = append(assessment.Flags, flag)
+	}
+	sort.Strings(assessment.Flags)
+	return assessment
+}
+
+// MergeFlags adds flags to the comma separated flags already stored on a transaction, so a
+// payment that was flagged once stays flagged
+func MergeFlags(stored *string, flags []string) *string {
+	merged := make(map[string]bool)
+	if stored != nil && *stored != "" {
+		for _, flag := range strings.Split(*stored, ",") {
+			merged[flag] = true
+		}
+	}
+	for _, flag := range flags {
+		merged[flag] = true
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+
+	list := make([]string, 0, len(merged))
+	for flag := range merged {
+		list = append(list, flag)
+	}
+	sort.Strings(list)
+	joined := strings.Join(list, ",")
+	return &joined
+}
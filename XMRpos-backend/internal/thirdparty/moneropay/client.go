@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,6 +16,10 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// ErrTransferRefused is returned when MoneroPay answers a transfer with an error status, so
+// nothing was sent
+var ErrTransferRefused = errors.New("failed to create transfer")
+
 // ExternalAPIClient interacts with an external API
 type MoneroPayAPIClient struct {
 	BaseURL string
@@ -205,7 +210,7 @@ func (client *MoneroPayAPIClient) PostTransfer(ctx context.Context, req *Transfe
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to create transfer: %s: %s", resp.Status, strings.TrimSpace(string(bodyBytes)))
+		return nil, fmt.Errorf("%w: %s: %s", ErrTransferRefused, resp.Status, strings.TrimSpace(string(bodyBytes)))
 	}
 
 	var transferResp TransferResponse
@@ -0,0 +1,142 @@
+package monero
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+type Network string
+
+const (
+	Mainnet  Network = "mainnet"
+	Testnet  Network = "testnet"
+	Stagenet Network = "stagenet"
+)
+
+type AddressType string
+
+const (
+	StandardAddress   AddressType = "standard"
+	IntegratedAddress AddressType = "integrated"
+	Subaddress        AddressType = "subaddress"
+)
+
+const (
+	keySize       = 32
+	paymentIDSize = 8
+	checksumSize  = 4
+)
+
+type networkPrefix struct {
+	network     Network
+	addressType AddressType
+}
+
+// Network bytes as defined in cryptonote_config.h
+var prefixes = map[uint64]networkPrefix{
+	18: {Mainnet, StandardAddress},
+	19: {Mainnet, IntegratedAddress},
+	42: {Mainnet, Subaddress},
+	53: {Testnet, StandardAddress},
+	54: {Testnet, IntegratedAddress},
+	63: {Testnet, Subaddress},
+	24: {Stagenet, StandardAddress},
+	25: {Stagenet, IntegratedAddress},
+	36: {Stagenet, Subaddress},
+}
+
+var (
+	ErrInvalidChecksum = errors.New("invalid address checksum")
+	ErrUnknownPrefix   = errors.New("unknown address network byte")
+	ErrInvalidLength   = errors.New("invalid address length")
+	ErrWrongNetwork    = errors.New("address belongs to a different network")
+)
+
+type Address struct {
+	Network        Network
+	Type           AddressType
+	PublicSpendKey [keySize]byte
+	PublicViewKey  [keySize]byte
+	PaymentID      []byte // Only set for integrated addresses
+}
+
+// ParseNetwork accepts the network names reported by monerod; an empty name means mainnet
+func ParseNetwork(name string) (Network, error) {
+	switch Network(strings.ToLower(strings.TrimSpace(name))) {
+	case Mainnet, "":
+		return Mainnet, nil
+	case Testnet:
+		return Testnet, nil
+	case Stagenet:
+		return Stagenet, nil
+	default:
+		return "", fmt.Errorf("unknown Monero network %q", name)
+	}
+}
+
+// DecodeAddress decodes a standard, integrated or subaddress and verifies its checksum
+func DecodeAddress(encoded string) (*Address, error) {
+	data, err := DecodeBase58(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < checksumSize+1 {
+		return nil, ErrInvalidLength
+	}
+
+	payload := data[:len(data)-checksumSize]
+	// Monero hashes with the original Keccak-256 (0x01 padding), not the standardized SHA3-256
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(payload)
+	digest := hash.Sum(nil)
+	if !bytes.Equal(digest[:checksumSize], data[len(data)-checksumSize:]) {
+		return nil, ErrInvalidChecksum
+	}
+
+	tag, tagSize := binary.Uvarint(payload)
+	if tagSize <= 0 {
+		return nil, ErrUnknownPrefix
+	}
+	prefix, ok := prefixes[tag]
+	if !ok {
+		return nil, ErrUnknownPrefix
+	}
+
+	keys := payload[tagSize:]
+	expected := 2 * keySize
+	if prefix.addressType == IntegratedAddress {
+		expected += paymentIDSize
+	}
+	if len(keys) != expected {
+		return nil, ErrInvalidLength
+	}
+
+	address := &Address{
+		Network: prefix.network,
+		Type:    prefix.addressType,
+	}
+	copy(address.PublicSpendKey[:], keys[:keySize])
+	copy(address.PublicViewKey[:], keys[keySize:2*keySize])
+	if prefix.addressType == IntegratedAddress {
+		address.PaymentID = append([]byte(nil), keys[2*keySize:]...)
+	}
+
+	return address, nil
+}
+
+// ValidateAddress decodes the address and checks that it belongs to the given network
+func ValidateAddress(encoded string, network Network) (*Address, error) {
+	address, err := DecodeAddress(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if address.Network != network {
+		return nil, fmt.Errorf("%w: %s address on %s", ErrWrongNetwork, address.Network, network)
+	}
+	return address, nil
+}
@@ -0,0 +1,157 @@
+package monero
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+const (
+	mainnetStandard    = "44AFFq5kSiGBoZ4NMDwYtN18obc8AemS33DBLWs3H7otXft3XjrpDtQGv7SqSsaBYBb98uNbr2VBBEt7f2wfn3RVGQBEP3A"
+	mainnetIntegrated  = "4LL9oSLmtpccfufTMvppY6JwXNouMBzSkbLYfpAV5Usx3skxNgYeYTRj5UzqtReoS44qo9mtmXCqY45DJ852K5Jv2bYXZKKQePHES9khPK"
+	mainnetSubaddress  = "888tNkZrPN6JsEgekjMnABU4TBzc2Dt29EPAvkRxbANsAnjyPbb3iQ1YBRk1UXcdRsiKc9dhwMVgN5S9cQUiyoogDavup3H"
+	stagenetStandard   = "55LTR8KniP4LQGJSPtbYDacR7dz8RBFnsfAKMaMuwUNYX6aQbBcovzDPyrQF9KXF9tVU6Xk3K8no1BywnJX6GvZX8yJsXvt"
+	stagenetIntegrated = "5K8mwfjumVseCcQEjNbf59Um6R9NfVUNkHTLhhPCmNvgDLVS88YW5tScnm83rw9mfgYtchtDDTW5jEfMhygi27j1QYphX38hg6m4VMtN29"
+	stagenetSubaddress = "7BnERTpvL5MbCLtj5n9No7J5oE5hHiB3tVCK5cjSvCsYWD2WRJLFuWeKTLiXo5QJqt2ZwUaLy2Vh1Ad51K7FNgqcHgjW85o"
+	testnetStandard    = "9wviCeWe2D8XS82k2ovp5EUYLzBt9pYNW2LXUFsZiv8S3Mt21FZ5qQaAroko1enzw3eGr9qC7X1D7Geoo2RrAotYPwq9Gm8"
+	testnetIntegrated  = "A7dPDTL8dUeXS82k2ovp5EUYLzBt9pYNW2LXUFsZiv8S3Mt21FZ5qQaAroko1enzw3eGr9qC7X1D7Geoo2RrAotYaxQ3sSwqos2Tywj6GE"
+	testnetSubaddress  = "BbBjyYoYNNwFfL8RRVRTMiZUofBLpjRxdNnd5E4LyGcAK5CEsnL3gmE5QkrDRta7RPficGHcFdR6rUwWcjnwZVvCE3tLxhJ"
+)
+
+func TestDecodeAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		address     string
+		network     Network
+		addressType AddressType
+	}{
+		{"mainnet standard", mainnetStandard, Mainnet, StandardAddress},
+		{"mainnet integrated", mainnetIntegrated, Mainnet, IntegratedAddress},
+		{"mainnet subaddress", mainnetSubaddress, Mainnet, Subaddress},
+		{"stagenet standard", stagenetStandard, Stagenet, StandardAddress},
+		{"stagenet integrated", stagenetIntegrated, Stagenet, IntegratedAddress},
+		{"stagenet subaddress", stagenetSubaddress, Stagenet, Subaddress},
+		{"testnet standard", testnetStandard, Testnet, StandardAddress},
+		{"testnet integrated", testnetIntegrated, Testnet, IntegratedAddress},
+		{"testnet subaddress", testnetSubaddress, Testnet, Subaddress},
+		{"surrounding whitespace", " " + mainnetStandard + "\n", Mainnet, StandardAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, err := DecodeAddress(tt.address)
+			if err != nil {
+				t.Fatalf("DecodeAddress() error = %v", err)
+			}
+			if address.Network != tt.network {
+				t.Errorf("Network = %s, want %s", address.Network, tt.network)
+			}
+			if address.Type != tt.addressType {
+				t.Errorf("Type = %s, want %s", address.Type, tt.addressType)
+			}
+			if tt.addressType == IntegratedAddress && len(address.PaymentID) != paymentIDSize {
+				t.Errorf("PaymentID has %d bytes, want %d", len(address.PaymentID), paymentIDSize)
+			}
+			if tt.addressType != IntegratedAddress && address.PaymentID != nil {
+				t.Errorf("PaymentID = %x, want none", address.PaymentID)
+			}
+		})
+	}
+}
+
+func TestDecodeAddressKeys(t *testing.T) {
+	// The integrated address was built from the keys of the standard one
+	standard, err := DecodeAddress(testnetStandard)
+	if err != nil {
+		t.Fatalf("DecodeAddress(standard) error = %v", err)
+	}
+	integrated, err := DecodeAddress(testnetIntegrated)
+	if err != nil {
+		t.Fatalf("DecodeAddress(integrated) error = %v", err)
+	}
+
+	if standard.PublicSpendKey != integrated.PublicSpendKey || standard.PublicViewKey != integrated.PublicViewKey {
+		t.Error("integrated address does not carry the keys of its standard address")
+	}
+	if got := hex.EncodeToString(integrated.PaymentID); got != "0123456789abcdef" {
+		t.Errorf("PaymentID = %s, want 0123456789abcdef", got)
+	}
+}
+
+func TestDecodeAddressErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    error
+	}{
+		{"bad checksum", mainnetStandard[:len(mainnetStandard)-1] + "B", ErrInvalidChecksum},
+		{"changed key", mainnetStandard[:20] + "a" + mainnetStandard[21:], ErrInvalidChecksum},
+		{"truncated", mainnetStandard[:len(mainnetStandard)-11], ErrInvalidChecksum},
+		{"invalid character", "0" + mainnetStandard[1:], ErrInvalidBase58},
+		{"empty", "", ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeAddress(tt.address); !errors.Is(err, tt.want) {
+				t.Errorf("DecodeAddress() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		network Network
+		want    error
+	}{
+		{"mainnet on mainnet", mainnetSubaddress, Mainnet, nil},
+		{"stagenet on stagenet", stagenetIntegrated, Stagenet, nil},
+		{"testnet on testnet", testnetStandard, Testnet, nil},
+		{"stagenet on mainnet", stagenetStandard, Mainnet, ErrWrongNetwork},
+		{"mainnet on stagenet", mainnetStandard, Stagenet, ErrWrongNetwork},
+		{"mainnet on testnet", mainnetIntegrated, Testnet, ErrWrongNetwork},
+		{"testnet on stagenet", testnetSubaddress, Stagenet, ErrWrongNetwork},
+		{"bad checksum", testnetStandard[:len(testnetStandard)-1] + "9", Testnet, ErrInvalidChecksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateAddress(tt.address, tt.network)
+			if tt.want == nil && err != nil {
+				t.Fatalf("ValidateAddress() error = %v", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ValidateAddress() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Network
+		wantErr bool
+	}{
+		{"", Mainnet, false},
+		{"mainnet", Mainnet, false},
+		{" Stagenet ", Stagenet, false},
+		{"TESTNET", Testnet, false},
+		{"regtest", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNetwork(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNetwork() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseNetwork() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
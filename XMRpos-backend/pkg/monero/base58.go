@@ -0,0 +1,121 @@
+package monero
+
+import (
+	"errors"
+	"math/bits"
+	"strings"
+)
+
+// Monero's base58 differs from Bitcoin's: the data is split into 8 byte blocks which are
+// encoded independently into 11 characters, the last block using as few characters as needed.
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+const (
+	fullBlockSize        = 8
+	fullEncodedBlockSize = 11
+)
+
+// encodedBlockSizes maps a block length in bytes to its encoded length in characters
+var encodedBlockSizes = [fullBlockSize + 1]int{0, 2, 3, 5, 6, 7, 9, 10, 11}
+
+var ErrInvalidBase58 = errors.New("invalid base58")
+
+func decodedBlockSize(encodedSize int) int {
+	for size, encoded := range encodedBlockSizes {
+		if encoded == encodedSize {
+			return size
+		}
+	}
+	return -1
+}
+
+func decodeBlock(block string, out []byte) error {
+	size := decodedBlockSize(len(block))
+	if size <= 0 {
+		return ErrInvalidBase58
+	}
+
+	var num uint64
+	for i := 0; i < len(block); i++ {
+		digit := strings.IndexByte(base58Alphabet, block[i])
+		if digit < 0 {
+			return ErrInvalidBase58
+		}
+		hi, lo := bits.Mul64(num, 58)
+		if hi != 0 {
+			return ErrInvalidBase58
+		}
+		sum, carry := bits.Add64(lo, uint64(digit), 0)
+		if carry != 0 {
+			return ErrInvalidBase58
+		}
+		num = sum
+	}
+
+	if size < fullBlockSize && num>>(8*uint(size)) != 0 {
+		return ErrInvalidBase58
+	}
+
+	for i := size - 1; i >= 0; i-- {
+		out[i] = byte(num)
+		num >>= 8
+	}
+	return nil
+}
+
+// DecodeBase58 decodes a string in Monero's base58 variant
+func DecodeBase58(encoded string) ([]byte, error) {
+	fullBlocks := len(encoded) / fullEncodedBlockSize
+	lastBlockSize := len(encoded) % fullEncodedBlockSize
+
+	lastDecodedSize := 0
+	if lastBlockSize > 0 {
+		lastDecodedSize = decodedBlockSize(lastBlockSize)
+		if lastDecodedSize < 0 {
+			return nil, ErrInvalidBase58
+		}
+	}
+
+	out := make([]byte, fullBlocks*fullBlockSize+lastDecodedSize)
+	for i := 0; i < fullBlocks; i++ {
+		block := encoded[i*fullEncodedBlockSize : (i+1)*fullEncodedBlockSize]
+		if err := decodeBlock(block, out[i*fullBlockSize:(i+1)*fullBlockSize]); err != nil {
+			return nil, err
+		}
+	}
+	if lastBlockSize > 0 {
+		block := encoded[fullBlocks*fullEncodedBlockSize:]
+		if err := decodeBlock(block, out[fullBlocks*fullBlockSize:]); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func encodeBlock(block []byte, out []byte) {
+	var num uint64
+	for _, b := range block {
+		num = num<<8 | uint64(b)
+	}
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = base58Alphabet[num%58]
+		num /= 58
+	}
+}
+
+// EncodeBase58 encodes data in Monero's base58 variant
+func EncodeBase58(data []byte) string {
+	fullBlocks := len(data) / fullBlockSize
+	lastBlockSize := len(data) % fullBlockSize
+
+	out := make([]byte, fullBlocks*fullEncodedBlockSize+encodedBlockSizes[lastBlockSize])
+	for i := 0; i < fullBlocks; i++ {
+		encodeBlock(data[i*fullBlockSize:(i+1)*fullBlockSize], out[i*fullEncodedBlockSize:(i+1)*fullEncodedBlockSize])
+	}
+	if lastBlockSize > 0 {
+		encodeBlock(data[fullBlocks*fullBlockSize:], out[fullBlocks*fullEncodedBlockSize:])
+	}
+	return string(out)
+}
@@ -0,0 +1,6 @@
+package monero
+
+// SpendableAge is the number of blocks an output stays locked after it is mined
+// (CRYPTONOTE_DEFAULT_TX_SPENDABLE_AGE). A payment cannot be spent, and so cannot be paid
+// out, before it has this many confirmations.
+const SpendableAge = 10
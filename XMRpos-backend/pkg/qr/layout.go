@@ -0,0 +1,238 @@
+package qr
+
+// builder places the patterns and codewords of one code; function marks the modules that are
+// not data and are left alone by masking
+type builder struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func newBuilder(version int) *builder {
+	size := 17 + 4*version
+	b := &builder{version: version, size: size}
+	b.modules = make([][]bool, size)
+	b.function = make([][]bool, size)
+	for y := range b.modules {
+		b.modules[y] = make([]bool, size)
+		b.function[y] = make([]bool, size)
+	}
+	return b
+}
+
+func (b *builder) setFunction(x, y int, dark bool) {
+	b.modules[y][x] = dark
+	b.function[y][x] = true
+}
+
+func (b *builder) drawFunctionPatterns() {
+	// Timing patterns, partly overwritten by the finder patterns
+	for i := 0; i < b.size; i++ {
+		b.setFunction(6, i, i%2 == 0)
+		b.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	for _, center := range [][2]int{{3, 3}, {b.size - 4, 3}, {3, b.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || x >= b.size || y < 0 || y >= b.size {
+					continue
+				}
+				distance := max(abs(dx), abs(dy))
+				b.setFunction(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	// Alignment patterns, except where they would overlap the finder patterns
+	centers := versions[b.version].alignCenter
+	last := len(centers) - 1
+	for i, cy := range centers {
+		for j, cx := range centers {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					b.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas, drawn for real once the mask is known
+	b.drawFormatBits(0)
+
+	if b.version >= 7 {
+		rem := b.version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+		}
+		bits := b.version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 == 1
+			a, c := b.size-11+i%3, i/3
+			b.setFunction(a, c, dark)
+			b.setFunction(c, a, dark)
+		}
+	}
+}
+
+// drawFormatBits writes both copies of the format information for level M and the mask
+func (b *builder) drawFormatBits(mask int) {
+	const levelM = 0
+	data := levelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		b.setFunction(8, i, bit(i))
+	}
+	b.setFunction(8, 7, bit(6))
+	b.setFunction(8, 8, bit(7))
+	b.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		b.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		b.setFunction(b.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		b.setFunction(8, b.size-15+i, bit(i))
+	}
+	b.setFunction(8, b.size-8, true) // Dark module
+}
+
+// drawCodewords fills the data modules in the zigzag order, two columns at a time from the
+// bottom right. Modules left over are the remainder bits and stay light.
+func (b *builder) drawCodewords(codewords []byte) {
+	i := 0
+	for right := b.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		for vertical := 0; vertical < b.size; vertical++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vertical
+				if (right+1)&2 == 0 {
+					y = b.size - 1 - vertical // Upwards
+				}
+				if b.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				b.modules[y][x] = (codewords[i/8]>>(7-i%8))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+func (b *builder) applyMask(mask int) {
+	for y := 0; y < b.size; y++ {
+		for x := 0; x < b.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (y/2+x/3)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !b.function[y][x] {
+				b.modules[y][x] = !b.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the masked code is to read, following the four rules of the standard
+func (b *builder) penalty() int {
+	score := 0
+	at := func(x, y int, transposed bool) bool {
+		if transposed {
+			return b.modules[x][y]
+		}
+		return b.modules[y][x]
+	}
+
+	for _, transposed := range []bool{false, true} {
+		for y := 0; y < b.size; y++ {
+			// Runs of five or more modules of the same color
+			run := 1
+			for x := 1; x < b.size; x++ {
+				if at(x, y, transposed) == at(x-1, y, transposed) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+			if run >= 5 {
+				score += 3 + run - 5
+			}
+
+			// Patterns looking like a finder: 1011101 with four light modules on one side
+			for x := 0; x+11 <= b.size; x++ {
+				var line [11]bool
+				for k := range line {
+					line[k] = at(x+k, y, transposed)
+				}
+				if line == [11]bool{true, false, true, true, true, false, true, false, false, false, false} ||
+					line == [11]bool{false, false, false, false, true, false, true, true, true, false, true} {
+					score += 40
+				}
+			}
+		}
+	}
+
+	// Blocks of 2x2 modules of the same color
+	dark := 0
+	for y := 0; y < b.size; y++ {
+		for x := 0; x < b.size; x++ {
+			if b.modules[y][x] {
+				dark++
+			}
+			if x+1 < b.size && y+1 < b.size {
+				c := b.modules[y][x]
+				if c == b.modules[y][x+1] && c == b.modules[y+1][x] && c == b.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+
+	// Balance of dark and light modules, 10 points per 5% away from half
+	percent := dark * 100 / (b.size * b.size)
+	score += abs(percent-50) / 5 * 10
+
+	return score
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,82 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The golden matrices in testdata were produced by an independent encoder (byte mode, level M)
+// and hold one row per line, # for a dark module
+func TestEncodeGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"version1-single", "A"},
+		{"version1-hello", "hello world"},
+		{"version6-otpauth", "otpauth://totp/XMRpos:ops?algorithm=SHA1&digits=6&issuer=XMRpos&period=30&secret=JBSWY3DPEHPK3PXP"},
+		{"version8-repeat", strings.Repeat("x", 120)},
+		{"version10-digits", strings.Repeat("0123456789", 21)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			golden, err := os.ReadFile("testdata/" + tt.name + ".txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Split(strings.TrimSpace(string(golden)), "\n")
+
+			code, err := Encode(tt.text)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if code.Size != len(want) {
+				t.Fatalf("Size = %d, want %d", code.Size, len(want))
+			}
+			for y, row := range want {
+				for x := range row {
+					if code.Dark(x, y) != (row[x] == '#') {
+						t.Fatalf("module (%d, %d) differs from the golden matrix", x, y)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeCapacity(t *testing.T) {
+	code, err := Encode(strings.Repeat("a", 213))
+	if err != nil {
+		t.Fatalf("Encode(213 bytes) error = %v", err)
+	}
+	if code.Size != 57 {
+		t.Errorf("Size = %d, want 57 (version 10)", code.Size)
+	}
+	if _, err := Encode(strings.Repeat("a", 214)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode(214 bytes) error = %v, want %v", err, ErrTooLong)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode("hello world")
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	data, err := code.PNG(4)
+	if err != nil {
+		t.Fatalf("PNG() error = %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	// 21 modules and a quiet zone of 4 on each side, 4 pixels each
+	if size := img.Bounds().Dx(); size != (21+8)*4 || img.Bounds().Dy() != size {
+		t.Errorf("image is %v, want %dx%d", img.Bounds().Size(), (21+8)*4, (21+8)*4)
+	}
+}
@@ -0,0 +1,118 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// The SHA1 seed of RFC 6238 appendix B, "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B lists 8 digit codes; these are their last 6 digits
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			got, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+			if err != nil {
+				t.Fatalf("Code() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Code() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := Counter(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"current period", 0, true},
+		{"previous period", -1, true},
+		{"next period", 1, true},
+		{"two periods ago", -2, false},
+		{"two periods ahead", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, counter+tt.offset)
+			if err != nil {
+				t.Fatalf("Code() error = %v", err)
+			}
+			got, ok := Validate(rfcSecret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("Validate() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != counter+tt.offset {
+				t.Errorf("Validate() counter = %d, want %d", got, counter+tt.offset)
+			}
+		})
+	}
+}
+
+// Callers refuse a code whose counter is not past the last one used, so a code must map to the
+// same counter however often and whenever within the window it is submitted
+func TestValidateReplayCounter(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Counter(issued))
+	if err != nil {
+		t.Fatalf("Code() error = %v", err)
+	}
+
+	used, ok := Validate(rfcSecret, code, issued)
+	if !ok {
+		t.Fatal("Validate() rejected a fresh code")
+	}
+	for _, at := range []time.Time{issued, issued.Add(Period)} {
+		replayed, ok := Validate(rfcSecret, code, at)
+		if !ok || replayed != used {
+			t.Errorf("replay at %s: counter = %d, ok = %v, want %d, true", at.UTC().Format(time.TimeOnly), replayed, ok, used)
+		}
+	}
+	if _, ok := Validate(rfcSecret, code, issued.Add(2*Period)); ok {
+		t.Error("Validate() accepted the code two periods later")
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+	}{
+		{"spaces", rfcSecret, " 287 082 ", true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "287082", true},
+		{"wrong code", rfcSecret, "287083", false},
+		{"too short", rfcSecret, "28708", false},
+		{"eight digits", rfcSecret, "94287082", false},
+		{"invalid secret", "not base32!", "287082", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := Validate(tt.secret, tt.code, now); ok != tt.ok {
+				t.Errorf("Validate() ok = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}